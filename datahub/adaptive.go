@@ -0,0 +1,115 @@
+package datahub
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// adaptiveController tunes the batch size and in-flight requests of a shard writer
+// in AIMD style. A request within the latency target counts as a success, after
+// inflightLimit successes the batch size grows by minBatch and the in-flight limit
+// by one. A slow request halves the batch size and a limit exceeded error halves
+// the in-flight limit.
+type adaptiveController struct {
+	metaKey       string
+	minBatch      int
+	maxBatch      int
+	maxInflight   int
+	latencyTarget time.Duration
+	buffer        *bufferHelper
+	stats         *shardStatsCollector
+
+	mutex         sync.Mutex
+	cond          *sync.Cond
+	batchNum      int
+	inflightLimit int
+	active        int
+	successes     int
+}
+
+func newAdaptiveController(config *ProducerConfig, metaKey string, buffer *bufferHelper,
+	stats *shardStatsCollector) *adaptiveController {
+	maxBatch := config.MaxAsyncBufferNum
+	minBatch := min(max(config.AdaptiveMinBatchNum, 1), maxBatch)
+	maxInflight := max(config.AdaptiveMaxFlighting, 1)
+	if config.EnableStrictOrder {
+		maxInflight = 1
+	}
+
+	ac := &adaptiveController{
+		metaKey:       metaKey,
+		minBatch:      minBatch,
+		maxBatch:      maxBatch,
+		maxInflight:   maxInflight,
+		latencyTarget: config.AdaptiveLatency,
+		buffer:        buffer,
+		stats:         stats,
+		batchNum:      minBatch,
+		inflightLimit: 1,
+	}
+	ac.cond = sync.NewCond(&ac.mutex)
+	ac.apply()
+	return ac
+}
+
+// acquire blocks until the in-flight requests is under the limit
+func (ac *adaptiveController) acquire() {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	for ac.active >= ac.inflightLimit {
+		ac.cond.Wait()
+	}
+	ac.active++
+}
+
+func (ac *adaptiveController) release() {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	ac.active--
+	ac.cond.Broadcast()
+}
+
+// onResult is called after every request, including the retried ones
+func (ac *adaptiveController) onResult(latency time.Duration, err error) {
+	if ac == nil {
+		return
+	}
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	batchNum, inflightLimit := ac.batchNum, ac.inflightLimit
+	switch {
+	case err != nil && IsLimitExceedError(err):
+		ac.inflightLimit = max(ac.inflightLimit/2, 1)
+		ac.successes = 0
+	case err != nil:
+		return
+	case ac.latencyTarget > 0 && latency > ac.latencyTarget:
+		ac.batchNum = max(ac.batchNum/2, ac.minBatch)
+		ac.successes = 0
+	default:
+		ac.successes++
+		if ac.successes >= ac.inflightLimit {
+			ac.batchNum = min(ac.batchNum+ac.minBatch, ac.maxBatch)
+			ac.inflightLimit = min(ac.inflightLimit+1, ac.maxInflight)
+			ac.successes = 0
+		}
+	}
+
+	if batchNum != ac.batchNum || inflightLimit != ac.inflightLimit {
+		log.Infof("%s adaptive batch num:%d->%d, inflight limit:%d->%d, latency:%v, error:%v",
+			ac.metaKey, batchNum, ac.batchNum, inflightLimit, ac.inflightLimit, latency, err)
+		ac.apply()
+		ac.cond.Broadcast()
+	}
+}
+
+func (ac *adaptiveController) apply() {
+	ac.buffer.setBufferNum(ac.batchNum)
+	ac.stats.setLimits(ac.batchNum, ac.inflightLimit)
+}
@@ -0,0 +1,99 @@
+package datahub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAdaptiveControllerForTest(cfg *ProducerConfig) (*adaptiveController, *bufferHelper, *shardStatsCollector) {
+	buffer := newBufferHelper(cfg.MaxAsyncBufferNum, cfg.MaxAsyncFlightingNum, cfg.MaxAsyncBufferTime)
+	stats := newShardStatsCollector()
+	return newAdaptiveController(cfg, "test", buffer, stats), buffer, stats
+}
+
+func TestAdaptiveControllerIncrease(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.MaxAsyncBufferNum = 25
+	ac, buffer, stats := newAdaptiveControllerForTest(cfg)
+	defer buffer.close()
+
+	assert.Equal(t, int64(10), buffer.limit.Load())
+	assert.Equal(t, int64(1), stats.inflightLimit.Load())
+
+	ac.onResult(10*time.Millisecond, nil)
+	assert.Equal(t, 20, ac.batchNum)
+	assert.Equal(t, 2, ac.inflightLimit)
+
+	// increase after inflightLimit successes
+	ac.onResult(10*time.Millisecond, nil)
+	assert.Equal(t, 2, ac.inflightLimit)
+	ac.onResult(10*time.Millisecond, nil)
+	assert.Equal(t, 25, ac.batchNum)
+	assert.Equal(t, 3, ac.inflightLimit)
+	assert.Equal(t, int64(25), buffer.limit.Load())
+	assert.Equal(t, int64(3), stats.inflightLimit.Load())
+
+	// bounded
+	for i := 0; i < 100; i++ {
+		ac.onResult(10*time.Millisecond, nil)
+	}
+	assert.Equal(t, 25, ac.batchNum)
+	assert.Equal(t, 4, ac.inflightLimit)
+}
+
+func TestAdaptiveControllerDecrease(t *testing.T) {
+	cfg := NewProducerConfig()
+	ac, buffer, _ := newAdaptiveControllerForTest(cfg)
+	defer buffer.close()
+	ac.batchNum = 100
+	ac.inflightLimit = 4
+
+	ac.onResult(10*time.Millisecond, &LimitExceededError{})
+	assert.Equal(t, 2, ac.inflightLimit)
+	assert.Equal(t, 100, ac.batchNum)
+
+	ac.onResult(2*time.Second, nil)
+	assert.Equal(t, 50, ac.batchNum)
+	assert.Equal(t, int64(50), buffer.limit.Load())
+
+	// other errors are ignored
+	ac.onResult(10*time.Millisecond, newNetworkError(nil))
+	assert.Equal(t, 2, ac.inflightLimit)
+	assert.Equal(t, 50, ac.batchNum)
+}
+
+func TestAdaptiveControllerStrictOrder(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.EnableStrictOrder = true
+	ac, buffer, _ := newAdaptiveControllerForTest(cfg)
+	defer buffer.close()
+
+	for i := 0; i < 10; i++ {
+		ac.onResult(10*time.Millisecond, nil)
+	}
+	assert.Equal(t, 1, ac.inflightLimit)
+	assert.Equal(t, 110, ac.batchNum)
+}
+
+func TestShardWriterAdaptive(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.EnableAdaptive = true
+	cfg.MaxAsyncBufferTime = 10 * time.Millisecond
+	client := &producerMockClient{}
+	writer := newShardWriterForTest(cfg, client, nil)
+	writer.start()
+
+	for i := 0; i < 30; i++ {
+		writer.writeRecord(NewBlobRecord([]byte("test")))
+	}
+	writer.close()
+
+	assert.Equal(t, 10, len(client.batches[0]))
+	total := 0
+	for _, batch := range client.batches {
+		total += len(batch)
+	}
+	assert.Equal(t, 30, total)
+}
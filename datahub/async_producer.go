@@ -1,10 +1,10 @@
 package datahub
 
 import (
+	"context"
 	"fmt"
 	"math/rand/v2"
 	"sort"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,14 +17,18 @@ import (
 // or meet non-retryable errors, you can check Err fo specific reason,
 // you can choose to discard the data or try again.
 type ProduceError struct {
+	Project string
+	Topic   string
 	ShardId string
 	Records []IRecord
 	Latency time.Duration
 	Err     error
 }
 
-func newProduceError(shardId string, records []IRecord, latency time.Duration, err error) *ProduceError {
+func newProduceError(project, topic, shardId string, records []IRecord, latency time.Duration, err error) *ProduceError {
 	return &ProduceError{
+		Project: project,
+		Topic:   topic,
 		ShardId: shardId,
 		Records: records,
 		Latency: latency,
@@ -35,6 +39,8 @@ func newProduceError(shardId string, records []IRecord, latency time.Duration, e
 // ProduceSuccess is the result of single request,
 // It means that the records has been sent to the server.
 type ProduceSuccess struct {
+	Project   string
+	Topic     string
 	ShardId   string
 	RequestId string
 	ReqSize   int
@@ -43,8 +49,10 @@ type ProduceSuccess struct {
 	Latency   time.Duration
 }
 
-func newProduceSuccess(shardId, rid string, reqSize, rawSzie int, records []IRecord, latency time.Duration) *ProduceSuccess {
+func newProduceSuccess(project, topic, shardId, rid string, reqSize, rawSzie int, records []IRecord, latency time.Duration) *ProduceSuccess {
 	return &ProduceSuccess{
+		Project:   project,
+		Topic:     topic,
 		ShardId:   shardId,
 		RequestId: rid,
 		ReqSize:   reqSize,
@@ -73,20 +81,8 @@ func DefaultPartitionFunc(topic *GetTopicResult, shards []ShardEntry, record IRe
 			return ""
 		}
 
-		key, err := calculateMD5(record.GetBaseRecord().PartitionKey)
-		if err != nil {
-			panic(err) // There should be no error returned here
-		}
-
-		ukey := strings.ToUpper(key)
-		idx := sort.Search(len(shards), func(i int) bool {
-			return ukey < shards[i].BeginHashKey
-		})
-
 		// generally, idx cannot be 0, beacause the first shard beginHashKey is "00...00"
-		if idx > 0 {
-			idx = idx - 1
-		}
+		idx := searchHashKeyRange(shards, record.GetBaseRecord().PartitionKey)
 		return shards[idx].ShardId
 	}
 
@@ -120,6 +116,28 @@ type AsyncProducer interface {
 
 	GetActiveShards() []string
 
+	// GetShardBacklog return the number of records buffered or in flight for the shard,
+	// it can be used by NewLeastLoadedPartitioner. It does not take the producer lock,
+	// so it is safe to call from the partitioner.
+	GetShardBacklog(shardId string) int
+
+	// GetSpoolStats return the depth of the local spool,
+	// it is always empty if ProducerConfig.SpoolDir is not set.
+	GetSpoolStats() SpoolStats
+
+	// CloseWithContext stops accepting input and waits for the buffered records to be sent
+	// until ctx is done, then the sending is aborted and the unsent records are returned
+	// grouped by shard, records not routed to a shard yet are under the empty shard id.
+	// The requests in flight at the deadline are not waited, their records may have been
+	// written, so they are not returned but reported to the Errors channel with an error
+	// checked by IsProducerInterruptedError.
+	// The Successes and Errors channels must still be read until they are closed.
+	CloseWithContext(ctx context.Context) (map[string][]IRecord, error)
+
+	// Stats return a snapshot of the counters since the producer created,
+	// the spool stats are included.
+	Stats() ProducerStats
+
 	// Close current producer, it will write all buffer to server before closed,
 	// you also need to handle all errors if write to server failed.
 	Close() error
@@ -135,6 +153,7 @@ type asyncProducerImpl struct {
 	schemaCache        topicSchemaCache
 	shards             []ShardEntry
 	writers            map[string]*shardWriter
+	writerView         atomic.Pointer[map[string]*shardWriter] // copy of writers read without mutex, see GetShardBacklog
 	mutex              sync.RWMutex
 	buffer             *bufferHelper
 	input              chan IRecord
@@ -143,9 +162,24 @@ type asyncProducerImpl struct {
 	errors             chan *ProduceError
 	updateShardCh      chan bool
 	wg                 sync.WaitGroup
+	interceptors       interceptorChain
+	spool              *diskSpool
+	spoolCloseCh       chan struct{}
+	spoolWg            sync.WaitGroup
+	shared             *producerShared // not nil if owned by a MultiTopicProducer
+	stamper            *idempotentStamper
+	stats              *producerStatsCollector
+	validator          *schemaValidator
+	closing            *closeState
+	closeOnce          sync.Once
+	limiter            *rateLimiter
 }
 
 func NewAsyncProducer(cfg *ProducerConfig) AsyncProducer {
+	return newAsyncProducer(cfg, nil)
+}
+
+func newAsyncProducer(cfg *ProducerConfig, shared *producerShared) *asyncProducerImpl {
 	ap := &asyncProducerImpl{
 		config:             cfg,
 		project:            cfg.Project,
@@ -154,9 +188,26 @@ func NewAsyncProducer(cfg *ProducerConfig) AsyncProducer {
 		buffer:             newBufferHelper(cfg.MaxAsyncBufferNum, cfg.MaxAsyncFlightingNum, cfg.MaxAsyncBufferTime),
 		input:              make(chan IRecord, cfg.MaxAsyncBufferNum*2),
 		retries:            make(chan []IRecord, 64),
-		success:            make(chan *ProduceSuccess, 64),
-		errors:             make(chan *ProduceError, 64),
-		updateShardCh:      make(chan bool, 8),
+		interceptors:       cfg.Interceptors,
+		spoolCloseCh:       make(chan struct{}),
+		shared:             shared,
+		stats:              newProducerStatsCollector(),
+		closing:            newCloseState(),
+		limiter:            newRateLimiter(cfg.ShardRateLimit, cfg.TopicRateLimit),
+	}
+
+	if cfg.EnableIdempotence {
+		ap.stamper = newIdempotentStamper(cfg.ProducerId)
+	}
+
+	if shared != nil {
+		ap.success = shared.success
+		ap.errors = shared.errors
+		ap.updateShardCh = shared.updateShardCh
+	} else {
+		ap.success = make(chan *ProduceSuccess, 64)
+		ap.errors = make(chan *ProduceError, 64)
+		ap.updateShardCh = make(chan bool, 8)
 	}
 	return ap
 }
@@ -170,15 +221,71 @@ func (ap *asyncProducerImpl) Init() error {
 		return err
 	}
 
-	go withRecover(fmt.Sprintf("%s/%s-update-shard-task", ap.project, ap.topic), ap.updateShardRun)
+	if ap.spool != nil {
+		if err := ap.spool.recover(); err != nil {
+			return err
+		}
+		if !ap.config.EnableStrictOrder {
+			ap.spoolWg.Add(1)
+			go withRecover(fmt.Sprintf("%s/%s-spool-replay-task", ap.project, ap.topic), ap.spoolReplayRun)
+		}
+	}
+
+	// the shards of a MultiTopicProducer are refreshed by a shared task
+	if ap.shared == nil {
+		go withRecover(fmt.Sprintf("%s/%s-update-shard-task", ap.project, ap.topic), ap.updateShardRun)
+	}
 	ap.wg.Add(2)
 	go ap.dispatch()
 	go ap.dispatchBatch()
+
+	if ap.spool != nil && ap.config.EnableStrictOrder {
+		ap.requeueSpool()
+	}
 	return nil
 }
 
+// requeueSpool puts the recovered batches ahead of any new input, so that
+// they are sent before the later records of the same shard in strict order mode.
+func (ap *asyncProducerImpl) requeueSpool() {
+	for _, entry := range ap.spool.claimAll() {
+		records, err := ap.spool.load(entry)
+		if err != nil {
+			log.Errorf("%s/%s/%s load spool file %s failed, drop it, error:%v",
+				ap.project, ap.topic, entry.shardId, entry.path, err)
+			ap.spool.remove(entry)
+			continue
+		}
+
+		ap.mutex.RLock()
+		writer := ap.writers[entry.shardId]
+		ap.mutex.RUnlock()
+
+		if writer != nil {
+			ap.acquireBudget(records)
+			writer.writeSpooled(entry, records)
+			continue
+		}
+
+		// shard has been sealed, route the records again
+		ap.spool.remove(entry)
+		for _, record := range records {
+			record.SetShardId("")
+		}
+		ap.rerouteRecords(records)
+	}
+}
+
+func (ap *asyncProducerImpl) newClientConfig() *Config {
+	config := NewDefaultConfig()
+	if ap.shared != nil {
+		config.HttpClient = ap.shared.httpClient
+	}
+	return config
+}
+
 func (ap *asyncProducerImpl) initMeta() error {
-	tmpClient := NewClientWithConfig(ap.config.Endpoint, NewDefaultConfig(), ap.config.Account)
+	tmpClient := NewClientWithConfig(ap.config.Endpoint, ap.newClientConfig(), ap.config.Account)
 	var err error
 	ap.topicMeta, err = tmpClient.GetTopic(ap.project, ap.topic)
 	if err != nil {
@@ -189,7 +296,7 @@ func (ap *asyncProducerImpl) initMeta() error {
 		ap.freshShardInterval = ap.topicMeta.extraConfig.listShardInterval
 	}
 
-	config := NewDefaultConfig()
+	config := ap.newClientConfig()
 
 	if ap.topicMeta.extraConfig.compressType != NOCOMPRESS {
 		config.CompressorType = ap.topicMeta.extraConfig.compressType
@@ -213,6 +320,14 @@ func (ap *asyncProducerImpl) initMeta() error {
 	ap.client = NewClientWithConfig(ap.config.Endpoint, config, ap.config.Account)
 	ap.client.setUserAgent(userAgent)
 	ap.schemaCache = schemaClientInstance().getTopicSchemaCache(ap.project, ap.topic, ap.client)
+	if ap.config.EnableSchemaCheck || ap.config.EnableSchemaCoercion {
+		ap.validator = newSchemaValidator(ap.project, ap.topic, ap.schemaCache, ap.config.EnableSchemaCoercion)
+	}
+
+	if len(ap.config.SpoolDir) > 0 {
+		ap.spool = newDiskSpool(spoolDirOf(ap.config.SpoolDir, ap.project, ap.topic), ap.config.SpoolMaxBytes,
+			ap.project, ap.topic, ap.schemaCache, config.CompressorType)
+	}
 
 	log.Infof("Init %s/%s async producer success", ap.project, ap.topic)
 	return nil
@@ -266,8 +381,94 @@ func (ap *asyncProducerImpl) GetActiveShards() []string {
 	return shards
 }
 
+func (ap *asyncProducerImpl) getBudget() *bufferBudget {
+	if ap.shared == nil {
+		return nil
+	}
+	return ap.shared.budget
+}
+
+// acquireBudget is called for the records entering the producer again, the records
+// from Input are acquired by the MultiTopicProducer when accepted. The budget is released
+// when the records leave the shard writer or are dropped before reaching it.
+func (ap *asyncProducerImpl) acquireBudget(records []IRecord) {
+	if budget := ap.getBudget(); budget != nil {
+		budget.acquire(batchSize(records))
+	}
+}
+
+func (ap *asyncProducerImpl) releaseBudget(records []IRecord) {
+	if budget := ap.getBudget(); budget != nil {
+		budget.release(batchSize(records))
+	}
+}
+
+// GetShardBacklog reads writerView instead of writers, the partitioner is called by
+// writeRecord with mutex read locked and a recursive RLock deadlocks once freshShard waits for Lock.
+func (ap *asyncProducerImpl) GetShardBacklog(shardId string) int {
+	view := ap.writerView.Load()
+	if view == nil {
+		return 0
+	}
+
+	if writer := (*view)[shardId]; writer != nil {
+		return int(writer.backlog.Load())
+	}
+	return 0
+}
+
+func (ap *asyncProducerImpl) GetSpoolStats() SpoolStats {
+	if ap.spool == nil {
+		return SpoolStats{}
+	}
+	return ap.spool.stats()
+}
+
+func (ap *asyncProducerImpl) Stats() ProducerStats {
+	stats := ap.stats.snapshot(ap.GetShardBacklog)
+	stats.Spool = ap.GetSpoolStats()
+	return stats
+}
+
+func (ap *asyncProducerImpl) CloseWithContext(ctx context.Context) (map[string][]IRecord, error) {
+	closed := make(chan struct{})
+	go func() {
+		ap.Close()
+		close(closed)
+	}()
+
+	var err error
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Warnf("%s/%s close producer timeout, abort sending, error:%v", ap.project, ap.topic, err)
+		// the requests in flight are not waited after abort, so the buffered
+		// batches are abandoned without waiting for the network
+		ap.closing.abort()
+		<-closed
+	}
+	return ap.closing.takeUnsent(), err
+}
+
+// abandonRecords returns the records to the caller of CloseWithContext
+func (ap *asyncProducerImpl) abandonRecords(shardId string, records []IRecord) {
+	ap.closing.addUnsent(shardId, records)
+	ap.interceptors.onAcknowledgement(shardId, records, errProducerAborted)
+}
+
+// Close is called once, the later calls wait for the first one to finish
 func (ap *asyncProducerImpl) Close() error {
+	ap.closeOnce.Do(ap.close)
+	return nil
+}
+
+func (ap *asyncProducerImpl) close() {
 	start := time.Now()
+	// 0. stop spool replay, remained batches will be replayed after next Init
+	close(ap.spoolCloseCh)
+	ap.spoolWg.Wait()
+
 	// 1. stop input
 	close(ap.input)
 
@@ -278,17 +479,31 @@ func (ap *asyncProducerImpl) Close() error {
 	// 3. flush retry buffer to errors channel
 	close(ap.retries)
 	for batch := range ap.retries {
-		ap.errors <- newProduceError("", batch, time.Duration(0),
-			fmt.Errorf("%s/%s writer has been closed", ap.project, ap.topic))
+		if ap.closing.isAborted() {
+			ap.abandonRecords("", batch)
+			continue
+		}
+
+		err := fmt.Errorf("%s/%s writer has been closed", ap.project, ap.topic)
+		deliverDeadLetter(ap.config.DeadLetterSink, ap.project+"/"+ap.topic, "", batch, 0, err)
+		ap.interceptors.onAcknowledgement("", batch, err)
+		ap.errors <- newProduceError(ap.project, ap.topic, "", batch, time.Duration(0), err)
+	}
+
+	// 4. close all channel, the shared channels are closed by the MultiTopicProducer
+	if ap.shared == nil {
+		close(ap.errors)
+		close(ap.success)
+		close(ap.updateShardCh)
 	}
 
-	// 4. close all channel
-	close(ap.errors)
-	close(ap.success)
-	close(ap.updateShardCh)
+	if ap.spool != nil {
+		stats := ap.spool.stats()
+		log.Infof("%s/%s spool remains %d batches, %d records",
+			ap.project, ap.topic, stats.Batches, stats.Records)
+	}
 
 	log.Infof("%s/%s producer closed, cost: %v", ap.project, ap.topic, time.Since(start))
-	return nil
 }
 
 func (ap *asyncProducerImpl) freshShard() error {
@@ -344,6 +559,7 @@ func (ap *asyncProducerImpl) freshShard() error {
 
 	ap.mutex.RUnlock()
 	if len(addShards) == 0 {
+		ap.stats.onShardRefreshed()
 		log.Infof("%s/%s update shard success, no shard change", ap.project, ap.topic)
 		return nil
 	}
@@ -357,17 +573,31 @@ func (ap *asyncProducerImpl) freshShard() error {
 		ap.writers = make(map[string]*shardWriter)
 	}
 
+	// writers of sealed shards return the buffered records for rerouting
+	for shardId, writer := range ap.writers {
+		if !newShardMap[shardId] {
+			writer.seal()
+		}
+	}
+
 	for _, shardId := range addShards {
 		writer := ap.writers[shardId]
 		if writer == nil {
-			writer := newShardWriter(ap.config, shardId, ap.client,
+			writer := newShardWriter(ap.config, shardId, ap.client, ap.spool, ap.getBudget(), ap.stats.shard(shardId), ap.closing, ap.limiter,
 				ap.updateShardCh, ap.retries, ap.success, ap.errors)
 			writer.start()
 			ap.writers[shardId] = writer
 			newWriters = append(newWriters, shardId)
 		}
 	}
+
+	view := make(map[string]*shardWriter, len(ap.writers))
+	for shardId, writer := range ap.writers {
+		view[shardId] = writer
+	}
+	ap.writerView.Store(&view)
 	ap.shards = newShards
+	ap.stats.onShardRefreshed()
 	log.Infof("%s/%s update shard success, current shard num:%d, new shard writers:%v",
 		ap.project, ap.topic, len(newShards), newWriters)
 	return nil
@@ -412,6 +642,95 @@ func (ap *asyncProducerImpl) updateShardRun() {
 	}
 }
 
+// spoolReplayRun sends the spooled batches one by one in the order they were spooled
+func (ap *asyncProducerImpl) spoolReplayRun() {
+	defer ap.spoolWg.Done()
+	log.Infof("%s/%s spool replay task started", ap.project, ap.topic)
+
+	for {
+		select {
+		case <-ap.spoolCloseCh:
+			log.Infof("%s/%s spool replay task stopped", ap.project, ap.topic)
+			return
+		case <-ap.spool.notifyCh:
+		}
+
+		for entry := ap.spool.peek(); entry != nil; entry = ap.spool.peek() {
+			if ap.replaySpoolEntry(entry) {
+				continue
+			}
+
+			select {
+			case <-ap.spoolCloseCh:
+				log.Infof("%s/%s spool replay task stopped", ap.project, ap.topic)
+				return
+			case <-time.After(spoolReplayBackoff):
+			}
+		}
+	}
+}
+
+// replaySpoolEntry return false if the entry should be replayed again later
+func (ap *asyncProducerImpl) replaySpoolEntry(entry *spoolEntry) bool {
+	records, err := ap.spool.load(entry)
+	if err != nil {
+		log.Errorf("%s/%s/%s load spool file %s failed, drop it, error:%v",
+			ap.project, ap.topic, entry.shardId, entry.path, err)
+		ap.spool.remove(entry)
+		return true
+	}
+
+	stats := ap.stats.shard(entry.shardId)
+	start := time.Now()
+	stats.beginRequest()
+	res, err := ap.closing.putRecords(ap.client, ap.project, ap.topic, entry.shardId, records)
+	stats.endRequest()
+	latency := time.Since(start)
+	if err == nil {
+		stats.onSuccess(len(records), res.ReqSize, res.RawSize, latency)
+		ap.spool.remove(entry)
+		log.Infof("%s/%s/%s replay spooled records %d success, cost:%v, rid:%s",
+			ap.project, ap.topic, entry.shardId, len(records), latency, res.RequestId)
+		ap.interceptors.onAcknowledgement(entry.shardId, records, nil)
+		if ap.config.EnableSuccessCh {
+			ap.success <- newProduceSuccess(ap.project, ap.topic, entry.shardId, res.RequestId, res.ReqSize, res.RawSize, records, latency)
+		}
+		return true
+	}
+
+	// the entry is kept in spool and replayed after next Init
+	if IsProducerAbortedError(err) || IsProducerInterruptedError(err) {
+		return false
+	}
+
+	if IsShardSealedError(err) {
+		ap.spool.remove(entry)
+		for _, record := range records {
+			record.SetShardId("")
+		}
+		ap.updateShardCh <- true
+		ap.retries <- records
+		return true
+	}
+
+	if IsRetryableError(err) {
+		log.Warnf("%s/%s/%s replay spooled records %d failed, cost:%v, error:%v",
+			ap.project, ap.topic, entry.shardId, len(records), latency, err)
+		ap.spool.addAttempts(entry, 1)
+		return false
+	}
+
+	log.Errorf("%s/%s/%s replay spooled records %d failed, cost:%v, error:%v",
+		ap.project, ap.topic, entry.shardId, len(records), latency, err)
+	ap.spool.remove(entry)
+	deliverDeadLetter(ap.config.DeadLetterSink, ap.project+"/"+ap.topic, entry.shardId, records, entry.attempts+1, err)
+	ap.interceptors.onAcknowledgement(entry.shardId, records, err)
+	if ap.config.EnableErrorCh {
+		ap.errors <- newProduceError(ap.project, ap.topic, entry.shardId, records, latency, err)
+	}
+	return true
+}
+
 func (ap *asyncProducerImpl) dispatchBatch() {
 	defer ap.wg.Done()
 
@@ -444,21 +763,146 @@ func (ap *asyncProducerImpl) dispatch() {
 				return
 			}
 
+			// retried records are older than the input, handle them first
+			// to keep the per-key order where possible
+			ap.drainRetries()
+
 			if record == nil {
 				log.Warnf("%s/%s record is nil, ingore it", ap.project, ap.topic)
 				continue
 			}
 
-			ap.writeRecord(record)
+			acquired := 0
+			if ap.getBudget() != nil {
+				acquired = record.GetSize()
+			}
+
+			newRecord, err := ap.interceptors.onSend(record)
+			if err == nil {
+				newRecord, err = ap.validator.validate(newRecord)
+			}
+			if err != nil {
+				if budget := ap.getBudget(); budget != nil {
+					budget.release(int64(acquired))
+				}
+				log.Warnf("%s/%s record rejected, error:%v", ap.project, ap.topic, err)
+				deliverDeadLetter(ap.config.DeadLetterSink, ap.project+"/"+ap.topic, "", []IRecord{record}, 0, err)
+				ap.interceptors.onAcknowledgement("", []IRecord{record}, err)
+				if ap.config.EnableErrorCh {
+					ap.errors <- newProduceError(ap.project, ap.topic, "", []IRecord{record}, time.Duration(0), err)
+				}
+				continue
+			}
+			ap.stamper.stamp(newRecord)
+			if budget := ap.getBudget(); budget != nil {
+				budget.adjust(int64(newRecord.GetSize() - acquired))
+			}
+
+			if err := ap.writeRecord(newRecord); err != nil {
+				ap.reportRouteError([]IRecord{newRecord}, err)
+			}
 		case batch := <-ap.retries:
-			for _, record := range batch {
-				ap.writeRecord(record)
+			ap.rerouteRecords(batch)
+		}
+	}
+}
+
+func (ap *asyncProducerImpl) drainRetries() {
+	for {
+		select {
+		case batch := <-ap.retries:
+			ap.rerouteRecords(batch)
+		default:
+			return
+		}
+	}
+}
+
+// rerouteRecords runs the partitioner again for the records returned by the
+// writers of sealed shards, the shard list is refreshed first if it is stale.
+//
+// EnableStrictOrder does not cover the rerouted records: the later records of the same
+// key may have been routed to the new shards and written before them, and the records
+// failed to route after rerouteMaxAttempts are reported while the later ones are still
+// sent. The spooled batches are not replayed in the background in strict order mode,
+// they are only queued ahead of the new input by Init, see requeueSpool.
+func (ap *asyncProducerImpl) rerouteRecords(records []IRecord) {
+	ap.acquireBudget(records)
+	var lastErr error
+	for attempt := 0; attempt < rerouteMaxAttempts && len(records) > 0; attempt++ {
+		if attempt > 0 {
+			ap.closing.sleep(ap.config.RetryInterval)
+		}
+
+		if ap.closing.isAborted() {
+			ap.releaseBudget(records)
+			ap.abandonRecords("", records)
+			return
+		}
+
+		if ap.hasSealedShard() {
+			if err := ap.freshShard(); err != nil {
+				lastErr = err
+				continue
 			}
 		}
+
+		failed := make([]IRecord, 0)
+		for _, record := range records {
+			ap.clearSealedShardId(record)
+			if err := ap.writeRecord(record); err != nil {
+				failed = append(failed, record)
+				lastErr = err
+			}
+		}
+		records = failed
+	}
+
+	if len(records) > 0 {
+		ap.reportRouteError(records, lastErr)
+	}
+}
+
+func (ap *asyncProducerImpl) hasSealedShard() bool {
+	ap.mutex.RLock()
+	defer ap.mutex.RUnlock()
+
+	for _, se := range ap.shards {
+		if writer := ap.writers[se.ShardId]; writer == nil || writer.isSealed() {
+			return true
+		}
+	}
+	return false
+}
+
+// clearSealedShardId let the partitioner choose a new shard if the
+// record is bound to a sealed shard
+func (ap *asyncProducerImpl) clearSealedShardId(record IRecord) {
+	shardId := record.GetBaseRecord().ShardId
+	if len(shardId) == 0 {
+		return
+	}
+
+	ap.mutex.RLock()
+	writer := ap.writers[shardId]
+	ap.mutex.RUnlock()
+
+	if writer != nil && writer.isSealed() {
+		record.SetShardId("")
+	}
+}
+
+func (ap *asyncProducerImpl) reportRouteError(records []IRecord, err error) {
+	ap.releaseBudget(records)
+	log.Errorf("%s/%s route records %d failed, error:%v", ap.project, ap.topic, len(records), err)
+	deliverDeadLetter(ap.config.DeadLetterSink, ap.project+"/"+ap.topic, "", records, 0, err)
+	ap.interceptors.onAcknowledgement("", records, err)
+	if ap.config.EnableErrorCh {
+		ap.errors <- newProduceError(ap.project, ap.topic, "", records, time.Duration(0), err)
 	}
 }
 
-func (ap *asyncProducerImpl) writeRecord(record IRecord) {
+func (ap *asyncProducerImpl) writeRecord(record IRecord) error {
 	ap.mutex.RLock()
 	defer ap.mutex.RUnlock()
 
@@ -469,10 +913,16 @@ func (ap *asyncProducerImpl) writeRecord(record IRecord) {
 
 	if len(shardId) == 0 {
 		ap.buffer.input() <- record
-	} else {
-		writer := ap.writers[shardId]
-		writer.writeRecord(record)
+		return nil
 	}
+
+	writer := ap.writers[shardId]
+	if writer == nil || writer.isSealed() {
+		return fmt.Errorf("%s/%s shard %s is not writable", ap.project, ap.topic, shardId)
+	}
+
+	writer.writeRecord(record)
+	return nil
 }
 
 type shardWriter struct {
@@ -482,16 +932,26 @@ type shardWriter struct {
 	shardId       string
 	metaKey       string
 	client        DataHubApi
+	spool         *diskSpool
+	budget        *bufferBudget
+	stats         *shardStatsCollector
+	closing       *closeState
+	adaptive      *adaptiveController // nil if adaptive mode is disabled
+	limiter       *rateLimiter
 	updateShardCh chan bool
 	parentRetrys  chan []IRecord
 	parentSuccess chan *ProduceSuccess
 	parentErrors  chan *ProduceError
 	buffer        *bufferHelper
 	wg            sync.WaitGroup
+	spooled       []*spoolEntry // recovered batches queued ahead of the new batches
+	mutex         sync.Mutex
+	sealed        atomic.Bool
+	backlog       atomic.Int64 // records buffered or in flight
 }
 
 func newShardWriter(config *ProducerConfig, shardId string,
-	client DataHubApi, shardCh chan bool, retrys chan []IRecord,
+	client DataHubApi, spool *diskSpool, budget *bufferBudget, stats *shardStatsCollector, closing *closeState, limiter *rateLimiter, shardCh chan bool, retrys chan []IRecord,
 	success chan *ProduceSuccess, errors chan *ProduceError) *shardWriter {
 	ss := &shardWriter{
 		config:        config,
@@ -500,12 +960,23 @@ func newShardWriter(config *ProducerConfig, shardId string,
 		shardId:       shardId,
 		metaKey:       fmt.Sprintf("%s/%s/%s", config.Project, config.Topic, shardId),
 		client:        client,
+		spool:         spool,
+		budget:        budget,
+		stats:         stats,
+		closing:       closing,
+		limiter:       limiter,
 		updateShardCh: shardCh,
 		parentSuccess: success,
 		parentRetrys:  retrys,
 		parentErrors:  errors,
 		buffer:        newBufferHelper(config.MaxAsyncBufferNum, config.MaxAsyncFlightingNum, config.MaxAsyncBufferTime),
 	}
+
+	if config.EnableAdaptive {
+		ss.adaptive = newAdaptiveController(config, ss.metaKey, ss.buffer, stats)
+	} else {
+		stats.setLimits(config.MaxAsyncBufferNum, 1)
+	}
 	return ss
 }
 
@@ -521,56 +992,232 @@ func (ss *shardWriter) close() {
 	log.Infof("%s writer stop", ss.metaKey)
 }
 
+// seal stops sending, the buffered records are returned to the producer for rerouting
+func (ss *shardWriter) seal() {
+	if ss.sealed.CompareAndSwap(false, true) {
+		log.Infof("%s writer sealed", ss.metaKey)
+		ss.buffer.flush()
+	}
+}
+
+func (ss *shardWriter) isSealed() bool {
+	return ss.sealed.Load()
+}
+
+// writeRecord takes the record whose budget has been acquired, see asyncProducerImpl.acquireBudget
 func (ss *shardWriter) writeRecord(record IRecord) {
+	ss.backlog.Add(1)
 	ss.buffer.input() <- record
 }
 
 func (ss *shardWriter) writeBatch(batch []IRecord) {
+	ss.backlog.Add(int64(len(batch)))
 	ss.buffer.batchInput() <- batch
 }
 
+// releaseBatch is called when the batch leaves the writer
+func (ss *shardWriter) releaseBatch(batch []IRecord) {
+	ss.backlog.Add(-int64(len(batch)))
+	if ss.budget != nil {
+		ss.budget.release(batchSize(batch))
+	}
+}
+
+func (ss *shardWriter) writeSpooled(entry *spoolEntry, batch []IRecord) {
+	ss.mutex.Lock()
+	ss.spooled = append(ss.spooled, entry)
+	ss.mutex.Unlock()
+	ss.writeBatch(batch)
+}
+
+func (ss *shardWriter) popSpooled() *spoolEntry {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if len(ss.spooled) == 0 {
+		return nil
+	}
+	entry := ss.spooled[0]
+	ss.spooled = ss.spooled[1:]
+	return entry
+}
+
+// sendRun sends batches one by one, so there is at most one in-flight request
+// per shard and a failed batch blocks the later ones until it succeeds or is abandoned,
+// whether EnableStrictOrder is set or not. In adaptive mode the batches may be sent
+// concurrently up to the in-flight limit, which is 1 with EnableStrictOrder.
 func (ss *shardWriter) sendRun() {
 	defer ss.wg.Done()
 
 	for batch := range ss.buffer.output() {
-		res, latency, err := ss.sendWithRetry(batch)
-		if err == nil && ss.config.EnableSuccessCh {
-			ss.parentSuccess <- newProduceSuccess(ss.shardId, res.RequestId, res.ReqSize, res.RawSize, batch, latency)
-		} else {
-			if IsShardSealedError(err) {
-				ss.updateShardCh <- true
-				ss.parentRetrys <- batch // maybe out of order
-			} else {
-				if ss.config.EnableErrorCh {
-					ss.parentErrors <- newProduceError(ss.shardId, batch, latency, err)
-				}
+		entry := ss.popSpooled()
+		if ss.closing.isAborted() {
+			if entry != nil {
+				ss.spool.remove(entry)
+			}
+			ss.releaseBatch(batch)
+			ss.abandonBatch(batch)
+			continue
+		}
+
+		if ss.isSealed() {
+			if entry != nil {
+				ss.spool.remove(entry)
+			}
+			ss.releaseBatch(batch)
+			ss.parentRetrys <- batch
+			continue
+		}
+
+		if entry == nil && ss.spool != nil && ss.config.SpoolDurable {
+			var err error
+			if entry, err = ss.spool.append(ss.shardId, batch, 0, true); err != nil {
+				log.Warnf("%s spool records %d failed, error:%v", ss.metaKey, len(batch), err)
 			}
 		}
+
+		if ss.adaptive == nil {
+			ss.send(batch, entry)
+			continue
+		}
+
+		ss.adaptive.acquire()
+		ss.wg.Add(1)
+		go func(batch []IRecord, entry *spoolEntry) {
+			defer ss.wg.Done()
+			defer ss.adaptive.release()
+			ss.send(batch, entry)
+		}(batch, entry)
 	}
 }
 
-func (ss *shardWriter) sendWithRetry(records []IRecord) (*PutRecordsByShardResult, time.Duration, error) {
+func (ss *shardWriter) send(batch []IRecord, entry *spoolEntry) {
+	res, latency, attempts, err := ss.sendWithRetry(batch)
+	ss.releaseBatch(batch)
+	ss.handleResult(batch, entry, res, latency, attempts, err)
+}
+
+func (ss *shardWriter) handleResult(batch []IRecord, entry *spoolEntry,
+	res *PutRecordsByShardResult, latency time.Duration, attempts int, err error) {
+	if err == nil {
+		if entry != nil {
+			ss.spool.remove(entry)
+		}
+		interceptorChain(ss.config.Interceptors).onAcknowledgement(ss.shardId, batch, nil)
+		if ss.config.EnableSuccessCh {
+			ss.parentSuccess <- newProduceSuccess(ss.project, ss.topic, ss.shardId, res.RequestId, res.ReqSize, res.RawSize, batch, latency)
+		}
+		return
+	}
+
+	// the records may have been written, they are reported as failed instead of unsent
+	if IsProducerInterruptedError(err) {
+		if entry != nil {
+			ss.spool.remove(entry)
+		}
+		interceptorChain(ss.config.Interceptors).onAcknowledgement(ss.shardId, batch, err)
+		if ss.config.EnableErrorCh {
+			ss.parentErrors <- newProduceError(ss.project, ss.topic, ss.shardId, batch, latency, err)
+		}
+		return
+	}
+
+	// returned to the caller of CloseWithContext
+	if IsProducerAbortedError(err) {
+		if entry != nil {
+			ss.spool.remove(entry)
+		}
+		ss.abandonBatch(batch)
+		return
+	}
+
+	if IsShardSealedError(err) {
+		if entry != nil {
+			ss.spool.remove(entry)
+		}
+		ss.seal()
+		ss.updateShardCh <- true
+		ss.parentRetrys <- batch
+		return
+	}
+
+	// retry exhausted, keep the batch in spool and replay it later.
+	// In strict order mode the batch is abandoned, replay would overtake the later batches
+	if ss.spool != nil && IsRetryableError(err) && !ss.config.EnableStrictOrder {
+		if entry != nil {
+			ss.spool.addAttempts(entry, attempts)
+			ss.spool.release(entry)
+			return
+		}
+
+		_, serr := ss.spool.append(ss.shardId, batch, attempts, false)
+		if serr == nil {
+			log.Warnf("%s send records %d failed, spool it, error:%v", ss.metaKey, len(batch), err)
+			return
+		}
+		log.Errorf("%s spool records %d failed, error:%v", ss.metaKey, len(batch), serr)
+	} else if entry != nil {
+		ss.spool.remove(entry)
+	}
+
+	// the recovered batch has been sent before it was spooled
+	if entry != nil {
+		attempts += entry.attempts
+	}
+	deliverDeadLetter(ss.config.DeadLetterSink, ss.metaKey, ss.shardId, batch, attempts, err)
+	interceptorChain(ss.config.Interceptors).onAcknowledgement(ss.shardId, batch, err)
+	if ss.config.EnableErrorCh {
+		ss.parentErrors <- newProduceError(ss.project, ss.topic, ss.shardId, batch, latency, err)
+	}
+}
+
+func (ss *shardWriter) abandonBatch(batch []IRecord) {
+	ss.closing.addUnsent(ss.shardId, batch)
+	interceptorChain(ss.config.Interceptors).onAcknowledgement(ss.shardId, batch, errProducerAborted)
+}
+
+func (ss *shardWriter) sendWithRetry(records []IRecord) (*PutRecordsByShardResult, time.Duration, int, error) {
 	var returnErr error = nil
 	var latency time.Duration = 0
+	attempts := 0
 	for i := 0; ss.config.MaxRetry < 0 || i <= ss.config.MaxRetry; i++ {
+		if delay := ss.limiter.reserve(ss.shardId, len(records), int(batchSize(records))); delay > 0 {
+			if !ss.closing.sleep(delay) {
+				return nil, latency, attempts, errProducerAborted
+			}
+		}
+
 		start := time.Now()
-		res, err := ss.client.PutRecordsByShard(ss.project, ss.topic, ss.shardId, records)
+		ss.stats.beginRequest()
+		attempts++
+		res, err := ss.closing.putRecords(ss.client, ss.project, ss.topic, ss.shardId, records)
+		ss.stats.endRequest()
 		latency = time.Since(start)
+		ss.adaptive.onResult(latency, err)
+		if IsProducerAbortedError(err) || IsProducerInterruptedError(err) {
+			return nil, latency, attempts, err
+		}
+
 		if err == nil {
 			if log.IsLevelEnabled(log.DebugLevel) {
 				log.Debugf("%s send records %d success, cost: %v, rid:%s",
 					ss.metaKey, len(records), latency, res.RequestId)
 			}
-			return res, latency, nil
+			ss.stats.onSuccess(len(records), res.ReqSize, res.RawSize, latency)
+			return res, latency, attempts, nil
 		}
 
 		if !IsRetryableError(err) {
 			log.Errorf("%s send records %d failed, cost:%v, error:%v",
 				ss.metaKey, len(records), latency, err)
-			return nil, latency, err
+			ss.stats.onFailure(len(records), err)
+			return nil, latency, attempts, err
 		}
 
 		returnErr = err
+		if i < ss.config.MaxRetry || ss.config.MaxRetry < 0 {
+			ss.stats.onRetry(err)
+		}
 		sleepTime := ss.config.RetryInterval
 		if IsNetworkError(err) {
 			if log.IsLevelEnabled(log.DebugLevel) {
@@ -585,17 +1232,24 @@ func (ss *shardWriter) sendWithRetry(records []IRecord) (*PutRecordsByShardResul
 			log.Warnf("%s send records %d failed, cost:%v, error:%v",
 				ss.metaKey, len(records), latency, err)
 		}
-		time.Sleep(sleepTime)
+		if !ss.closing.sleep(sleepTime) {
+			return nil, latency, attempts, errProducerAborted
+		}
 	}
-	return nil, latency, returnErr
+	ss.stats.onFailure(len(records), returnErr)
+	return nil, latency, attempts, returnErr
 }
 
+const rerouteMaxAttempts = 3
+
 type bufferHelper struct {
 	bufferNum  int
+	limit      atomic.Int64 // current batch size, <= bufferNum
 	bufferTime time.Duration
 	wg         sync.WaitGroup
 	batchCh    chan []IRecord
 	recordCh   chan IRecord
+	flushCh    chan struct{}
 }
 
 func newBufferHelper(bufferNum, flightingNum int, bufferTime time.Duration) *bufferHelper {
@@ -604,7 +1258,9 @@ func newBufferHelper(bufferNum, flightingNum int, bufferTime time.Duration) *buf
 		bufferTime: bufferTime,
 		recordCh:   make(chan IRecord, bufferNum),
 		batchCh:    make(chan []IRecord, flightingNum),
+		flushCh:    make(chan struct{}, 1),
 	}
+	bh.limit.Store(int64(bufferNum))
 
 	bh.wg.Add(1)
 	go withRecover("buffer-helper-task", bh.runInner)
@@ -638,7 +1294,7 @@ func (bh *bufferHelper) runInner() {
 
 			batch = append(batch, record)
 
-			if len(batch) >= bh.bufferNum {
+			if int64(len(batch)) >= bh.limit.Load() {
 				if timer != nil {
 					timer.Stop()
 					timer = nil
@@ -648,6 +1304,17 @@ func (bh *bufferHelper) runInner() {
 				bh.batchInput() <- batch
 				batch = make([]IRecord, 0, bh.bufferNum)
 			}
+		case <-bh.flushCh:
+			if timer != nil {
+				timer.Stop()
+				timer = nil
+				timerCh = nil
+			}
+
+			if len(batch) > 0 {
+				bh.batchCh <- batch
+				batch = make([]IRecord, 0, bh.bufferNum)
+			}
 		case <-timerCh:
 			if timer != nil {
 				timer.Stop()
@@ -675,6 +1342,19 @@ func (bh *bufferHelper) output() <-chan []IRecord {
 	return bh.batchCh
 }
 
+// setBufferNum changes the batch size, it takes effect from the next record
+func (bh *bufferHelper) setBufferNum(num int) {
+	bh.limit.Store(int64(min(num, bh.bufferNum)))
+}
+
+// flush emits the buffered records as a batch without waiting for the buffer time
+func (bh *bufferHelper) flush() {
+	select {
+	case bh.flushCh <- struct{}{}:
+	default:
+	}
+}
+
 func (bh *bufferHelper) close() {
 	close(bh.recordCh)
 	bh.wg.Wait()
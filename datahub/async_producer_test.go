@@ -1,6 +1,8 @@
 package datahub
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -115,3 +117,234 @@ func TestBufferHelper(t *testing.T) {
 	batch2 := <-buffer.output()
 	assert.Equal(t, len(batch2), 1)
 }
+
+type producerMockClient struct {
+	DataHubApi
+	mu       sync.Mutex
+	putErr   error
+	shards   []ShardEntry
+	batches  [][]IRecord
+	batchIds []string
+}
+
+func (m *producerMockClient) PutRecordsByShard(projectName, topicName, shardId string, records []IRecord) (*PutRecordsByShardResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, records)
+	m.batchIds = append(m.batchIds, shardId)
+	if m.putErr != nil {
+		return nil, m.putErr
+	}
+	return &PutRecordsByShardResult{}, nil
+}
+
+func (m *producerMockClient) ListShard(projectName, topicName string) (*ListShardResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	shards := make([]ShardEntry, len(m.shards))
+	copy(shards, m.shards)
+	return &ListShardResult{Shards: shards}, nil
+}
+
+func newShardWriterForTest(cfg *ProducerConfig, client DataHubApi, spool *diskSpool) *shardWriter {
+	return newShardWriter(cfg, "0", client, spool, nil, newShardStatsCollector(), newCloseState(), nil, make(chan bool, 8),
+		make(chan []IRecord, 8), make(chan *ProduceSuccess, 8), make(chan *ProduceError, 8))
+}
+
+func TestShardWriterSpoolFailedBatch(t *testing.T) {
+	spool, dhSchema := newSpoolForTest(t.TempDir(), 0)
+	assert.Nil(t, spool.recover())
+
+	cfg := NewProducerConfig()
+	cfg.MaxRetry = 0
+	client := &producerMockClient{putErr: newNetworkError(fmt.Errorf("timeout"))}
+	writer := newShardWriterForTest(cfg, client, spool)
+
+	batch := []IRecord{genTupleRecord(dhSchema)}
+	res, latency, attempts, err := writer.sendWithRetry(batch)
+	writer.handleResult(batch, nil, res, latency, attempts, err)
+	assert.Equal(t, 0, len(writer.parentErrors))
+	assert.Equal(t, 1, spool.stats().Batches)
+}
+
+func TestShardWriterStrictOrderAbandonBatch(t *testing.T) {
+	spool, dhSchema := newSpoolForTest(t.TempDir(), 0)
+	assert.Nil(t, spool.recover())
+
+	cfg := NewProducerConfig()
+	cfg.MaxRetry = 0
+	cfg.SpoolDurable = true
+	cfg.EnableStrictOrder = true
+	client := &producerMockClient{putErr: newNetworkError(fmt.Errorf("timeout"))}
+	writer := newShardWriterForTest(cfg, client, spool)
+	writer.start()
+
+	writer.writeBatch([]IRecord{genTupleRecord(dhSchema)})
+	writer.close()
+	assert.Equal(t, 1, len(writer.parentErrors))
+	assert.Equal(t, 0, spool.stats().Batches)
+}
+
+func TestShardWriterSendSpooledFirst(t *testing.T) {
+	spool, dhSchema := newSpoolForTest(t.TempDir(), 0)
+	assert.Nil(t, spool.recover())
+
+	spooled := []IRecord{genTupleRecord(dhSchema)}
+	_, err := spool.append("0", spooled, 0, false)
+	assert.Nil(t, err)
+
+	cfg := NewProducerConfig()
+	cfg.SpoolDurable = true
+	cfg.EnableStrictOrder = true
+	client := &producerMockClient{}
+	writer := newShardWriterForTest(cfg, client, spool)
+	writer.start()
+
+	for _, entry := range spool.claimAll() {
+		records, err := spool.load(entry)
+		assert.Nil(t, err)
+		writer.writeSpooled(entry, records)
+	}
+	writer.writeBatch([]IRecord{genTupleRecord(dhSchema), genTupleRecord(dhSchema)})
+	writer.close()
+
+	assert.Equal(t, 2, len(client.batches))
+	assert.Equal(t, 1, len(client.batches[0]))
+	assert.Equal(t, spooled[0].GetData(), client.batches[0][0].GetData())
+	assert.Equal(t, 2, len(client.batches[1]))
+	assert.Equal(t, SpoolStats{}, spool.stats())
+	assert.Equal(t, 2, len(writer.parentSuccess))
+}
+
+func TestAsyncProducerRerouteSealedShard(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.EnableSuccessCh = false
+	client := &producerMockClient{
+		shards: []ShardEntry{
+			{ShardId: "0", State: ACTIVE, BeginHashKey: "00000000000000000000000000000000"},
+			{ShardId: "1", State: ACTIVE, BeginHashKey: "80000000000000000000000000000000"},
+		},
+	}
+
+	ap := NewAsyncProducer(cfg).(*asyncProducerImpl)
+	ap.client = client
+	ap.topicMeta = &GetTopicResult{ExpandMode: SPLIT_EXTEND}
+	assert.Nil(t, ap.freshShard())
+	assert.Equal(t, 2, len(ap.writers))
+
+	// shard 0 is split into 2 and 3
+	client.shards = []ShardEntry{
+		{ShardId: "0", State: CLOSED, BeginHashKey: "00000000000000000000000000000000"},
+		{ShardId: "1", State: ACTIVE, BeginHashKey: "80000000000000000000000000000000"},
+		{ShardId: "2", State: ACTIVE, BeginHashKey: "00000000000000000000000000000000"},
+		{ShardId: "3", State: ACTIVE, BeginHashKey: "40000000000000000000000000000000"},
+	}
+	ap.writers["0"].seal()
+
+	records := make([]IRecord, 0)
+	for i := 0; i < 10; i++ {
+		record := NewBlobRecord([]byte("test"))
+		record.SetShardId("0")
+		record.SetPartitionKey(fmt.Sprintf("key%d", i))
+		records = append(records, record)
+	}
+	ap.rerouteRecords(records)
+	assert.Equal(t, 0, len(ap.errors))
+	assert.Equal(t, 3, len(ap.shards))
+	assert.False(t, ap.hasSealedShard())
+
+	for _, writer := range ap.writers {
+		writer.close()
+	}
+
+	total := 0
+	for idx, batch := range client.batches {
+		assert.NotEqual(t, "0", client.batchIds[idx])
+		total += len(batch)
+	}
+	assert.Equal(t, len(records), total)
+}
+
+func TestAsyncProducerRerouteFailed(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.RetryInterval = time.Millisecond
+	client := &producerMockClient{
+		shards: []ShardEntry{{ShardId: "0", State: ACTIVE}},
+	}
+
+	ap := NewAsyncProducer(cfg).(*asyncProducerImpl)
+	ap.client = client
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	assert.Nil(t, ap.freshShard())
+
+	// server still reports the sealed shard as active
+	ap.writers["0"].seal()
+	record := NewBlobRecord([]byte("test"))
+	record.SetPartitionKey("key")
+	ap.rerouteRecords([]IRecord{record})
+
+	assert.Equal(t, 1, len(ap.errors))
+	perr := <-ap.errors
+	assert.Equal(t, 1, len(perr.Records))
+	assert.NotNil(t, perr.Err)
+	ap.writers["0"].close()
+}
+
+func TestAsyncProducerLeastLoadedDuringShardRefresh(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.EnableSuccessCh = false
+	client := &producerMockClient{
+		shards: []ShardEntry{{ShardId: "0", State: ACTIVE}, {ShardId: "1", State: ACTIVE}},
+	}
+
+	ap := NewAsyncProducer(cfg).(*asyncProducerImpl)
+	ap.client = client
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+
+	// the first partition call waits until freshShard is blocked on Lock, a recursive
+	// RLock in GetShardBacklog would deadlock here
+	var refreshWg sync.WaitGroup
+	var once sync.Once
+	backlog := NewLeastLoadedPartitioner(ap.GetShardBacklog)
+	cfg.Parittioner = func(topic *GetTopicResult, shards []ShardEntry, record IRecord) string {
+		once.Do(func() {
+			refreshWg.Add(1)
+			go func() {
+				defer refreshWg.Done()
+				assert.Nil(t, ap.freshShard())
+			}()
+			time.Sleep(50 * time.Millisecond)
+		})
+		return backlog(topic, shards, record)
+	}
+	assert.Nil(t, ap.freshShard())
+	client.mu.Lock()
+	client.shards = append(client.shards, ShardEntry{ShardId: "2", State: ACTIVE})
+	client.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, ap.writeRecord(NewBlobRecord([]byte("test"))))
+		}
+		refreshWg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write records deadlocked with shard refresh")
+	}
+
+	assert.Equal(t, 3, len(ap.GetActiveShards()))
+	for _, writer := range ap.writers {
+		writer.close()
+	}
+
+	total := 0
+	for _, batch := range client.batches {
+		total += len(batch)
+	}
+	assert.Equal(t, 100, total)
+}
@@ -29,6 +29,22 @@ type ProducerConfig struct {
 	MaxAsyncBufferTime   time.Duration
 	EnableSuccessCh      bool
 	EnableErrorCh        bool
+	SpoolDir             string                // local spool directory for failed batches, the files are in <SpoolDir>/<project>/<topic>, empty means disabled
+	SpoolMaxBytes        int64                 // max total size of the spool directory, <= 0 means unlimited, default 1GB
+	SpoolDurable         bool                  // persist every batch before sending instead of only the failed ones
+	EnableStrictOrder    bool                  // with SpoolDir send the recovered batches first and report the failed ones instead of spooling, with EnableAdaptive limit the in-flight requests per shard to 1. The order is not kept for the records rerouted after a shard split or merge
+	Interceptors         []ProducerInterceptor // called in order before partitioning and after the request
+	EnableIdempotence    bool                  // stamp records with producer id and sequence for consumer side deduplication
+	ProducerId           string                // producer id of the idempotent producer, a random one is generated if empty
+	EnableSchemaCheck    bool                  // validate records against the topic schema before buffering or sending
+	EnableSchemaCoercion bool                  // map records of other schema versions to the latest one by field name, implies EnableSchemaCheck
+	EnableAdaptive       bool                  // adjust batch size and in-flight requests of each shard by latency and limit exceeded errors
+	AdaptiveMinBatchNum  int                   // min batch size in adaptive mode, MaxAsyncBufferNum is the max, default 10
+	AdaptiveMaxFlighting int                   // max in-flight requests per shard in adaptive mode, default 4, always 1 with EnableStrictOrder
+	AdaptiveLatency      time.Duration         // batch size decreases when request latency exceeds it in adaptive mode, default 1s
+	ShardRateLimit       RateLimit             // max throughput of every shard, unlimited by default
+	TopicRateLimit       RateLimit             // max throughput of the topic, unlimited by default
+	DeadLetterSink       DeadLetterSink        // receives the records failed finally in AsyncProducer, they are still reported on Errors
 }
 
 func NewProducerConfig() *ProducerConfig {
@@ -45,6 +61,10 @@ func NewProducerConfig() *ProducerConfig {
 		MaxAsyncBufferTime:   5 * time.Second,
 		EnableSuccessCh:      true,
 		EnableErrorCh:        true,
+		SpoolMaxBytes:        1024 * 1024 * 1024,
+		AdaptiveMinBatchNum:  10,
+		AdaptiveMaxFlighting: 4,
+		AdaptiveLatency:      time.Second,
 	}
 }
 
@@ -70,6 +90,13 @@ type ConsumerConfig struct {
 	FetchStrategy    FetchStrategy // shard selection strategy, default FetchRoundRobin
 	CommitInterval   time.Duration // offset commit interval, default 30s
 	SessionTimeout   time.Duration // consumer group session timeout, default 60s
+	EnableDedup      bool          // drop the replays of idempotent producers, see ProducerConfig.EnableIdempotence
+	DedupWindow      int64         // sequences remembered per producer and shard, default 100000
+	DedupStateDir    string        // directory to persist dedup state on commit, empty means not persisted
+	ShardRateLimit   RateLimit     // max throughput of every shard, unlimited by default
+	TopicRateLimit   RateLimit     // max throughput of the topic, unlimited by default
+	EnableProjection bool          // project tuple records of every schema version onto ProjectVersion by field name
+	ProjectVersion   int           // target schema version of the projection, -1 means the latest, default -1
 }
 
 // NewConsumerConfig creates a new ConsumerConfig with default values
@@ -87,5 +114,7 @@ func NewConsumerConfig() *ConsumerConfig {
 		FetchStrategy:    FetchRoundRobin,
 		CommitInterval:   30 * time.Second,
 		SessionTimeout:   60 * time.Second,
+		DedupWindow:      100000,
+		ProjectVersion:   -1,
 	}
 }
@@ -0,0 +1,319 @@
+// Package columnar converts the datahub tuple records to Apache Arrow record batches and Parquet files.
+// It is a separate module, so the users of the datahub package do not depend on arrow.
+package columnar
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/shopspring/decimal"
+
+	"github.com/aliyun/aliyun-datahub-sdk-go/datahub"
+)
+
+const (
+	ShardIdColumn    = "__shard_id__"
+	SequenceColumn   = "__sequence__"
+	SystemTimeColumn = "__system_time__"
+	AttributesColumn = "__attributes__"
+
+	// FieldTypeMetadataKey is the arrow field metadata of the datahub field type
+	FieldTypeMetadataKey = "datahub.type"
+	// FieldCommentMetadataKey is the arrow field metadata of the datahub field comment
+	FieldCommentMetadataKey = "datahub.comment"
+)
+
+type WriterConfig struct {
+	WithMetadata     bool                 // add the metadata columns of BaseRecord: shard, sequence, system time and attributes
+	DecimalPrecision int32                // precision of the DECIMAL fields without precision, default 38
+	DecimalScale     int32                // scale of the DECIMAL fields without precision, default 18
+	Compression      compress.Compression // compression of the parquet file, default snappy
+	Allocator        memory.Allocator     // allocator of the arrow arrays, default memory.DefaultAllocator
+}
+
+func NewWriterConfig() *WriterConfig {
+	return &WriterConfig{
+		WithMetadata:     false,
+		DecimalPrecision: 38,
+		DecimalScale:     18,
+		Compression:      compress.Codecs.Snappy,
+		Allocator:        memory.DefaultAllocator,
+	}
+}
+
+// ArrowSchema returns the arrow schema of the record schema: the integers and floats map to
+// the arrow types of the same width, TIMESTAMP is timestamp[us, UTC], DECIMAL is decimal128 of
+// the field precision and scale or the config ones if the field has none, JSON is utf8 with the FieldTypeMetadataKey metadata.
+func ArrowSchema(schema *datahub.RecordSchema, config *WriterConfig) (*arrow.Schema, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+	if config == nil {
+		config = NewWriterConfig()
+	}
+
+	fields := make([]arrow.Field, 0, schema.Size()+4)
+	for _, field := range schema.Fields {
+		dataType, err := arrowType(&field, schema.GetDecimalProp(field.Name), config)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", field.Name, err)
+		}
+
+		keys := []string{FieldTypeMetadataKey}
+		values := []string{field.Type.String()}
+		if len(field.Comment) > 0 {
+			keys = append(keys, FieldCommentMetadataKey)
+			values = append(values, field.Comment)
+		}
+
+		fields = append(fields, arrow.Field{
+			Name:     field.Name,
+			Type:     dataType,
+			Nullable: field.AllowNull,
+			Metadata: arrow.NewMetadata(keys, values),
+		})
+	}
+
+	if config.WithMetadata {
+		for _, name := range []string{ShardIdColumn, SequenceColumn, SystemTimeColumn, AttributesColumn} {
+			if schema.GetFieldIndex(name) >= 0 {
+				return nil, fmt.Errorf("field [%s] conflicts with the metadata column", name)
+			}
+		}
+
+		fields = append(fields,
+			arrow.Field{Name: ShardIdColumn, Type: arrow.BinaryTypes.String, Nullable: true},
+			arrow.Field{Name: SequenceColumn, Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+			arrow.Field{Name: SystemTimeColumn, Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}, Nullable: true},
+			arrow.Field{Name: AttributesColumn, Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.BinaryTypes.String), Nullable: true},
+		)
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+func arrowType(field *datahub.Field, prop datahub.DecimalProp, config *WriterConfig) (arrow.DataType, error) {
+	switch field.Type {
+	case datahub.BIGINT:
+		return arrow.PrimitiveTypes.Int64, nil
+	case datahub.INTEGER:
+		return arrow.PrimitiveTypes.Int32, nil
+	case datahub.SMALLINT:
+		return arrow.PrimitiveTypes.Int16, nil
+	case datahub.TINYINT:
+		return arrow.PrimitiveTypes.Int8, nil
+	case datahub.DOUBLE:
+		return arrow.PrimitiveTypes.Float64, nil
+	case datahub.FLOAT:
+		return arrow.PrimitiveTypes.Float32, nil
+	case datahub.BOOLEAN:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case datahub.STRING, datahub.JSON:
+		return arrow.BinaryTypes.String, nil
+	case datahub.TIMESTAMP:
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, nil
+	case datahub.DECIMAL:
+		precision, scale := config.DecimalPrecision, config.DecimalScale
+		if prop.Precision > 0 {
+			precision, scale = int32(prop.Precision), int32(prop.Scale)
+		}
+		if precision < 1 || precision > 38 || scale < 0 || scale > precision {
+			return nil, fmt.Errorf("decimal(%d,%d) illegal", precision, scale)
+		}
+		return &arrow.Decimal128Type{Precision: precision, Scale: scale}, nil
+	default:
+		return nil, fmt.Errorf("field type %s not support", field.Type)
+	}
+}
+
+// RecordBatchBuilder appends the tuple records of a schema to arrow record batches
+type RecordBatchBuilder struct {
+	schema      *datahub.RecordSchema
+	config      *WriterConfig
+	arrowSchema *arrow.Schema
+	builder     *array.RecordBuilder
+}
+
+func NewRecordBatchBuilder(schema *datahub.RecordSchema, config *WriterConfig) (*RecordBatchBuilder, error) {
+	if config == nil {
+		config = NewWriterConfig()
+	}
+
+	arrowSchema, err := ArrowSchema(schema, config)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := config.Allocator
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	return &RecordBatchBuilder{
+		schema:      schema,
+		config:      config,
+		arrowSchema: arrowSchema,
+		builder:     array.NewRecordBuilder(mem, arrowSchema),
+	}, nil
+}
+
+func (rb *RecordBatchBuilder) Schema() *arrow.Schema {
+	return rb.arrowSchema
+}
+
+// Append appends the record, the record schema must be the schema of the builder
+func (rb *RecordBatchBuilder) Append(record *datahub.TupleRecord) error {
+	if record == nil || record.RecordSchema == nil {
+		return fmt.Errorf("record schema is nil")
+	}
+	if record.RecordSchema != rb.schema && record.RecordSchema.HashCode() != rb.schema.HashCode() {
+		return fmt.Errorf("record schema %s not match %s", record.RecordSchema.String(), rb.schema.String())
+	}
+
+	// check the values before appending, so that a failed record appends nothing
+	values := make([]any, rb.schema.Size())
+	for idx, field := range rb.schema.Fields {
+		if idx >= len(record.Values) || record.Values[idx] == nil {
+			if !field.AllowNull {
+				return fmt.Errorf("[%s] not allow null", field.Name)
+			}
+			continue
+		}
+
+		val, err := rb.arrowValue(idx, record.Values[idx])
+		if err != nil {
+			return fmt.Errorf("[%s] %v", field.Name, err)
+		}
+		values[idx] = val
+	}
+
+	for idx, val := range values {
+		appendValue(rb.builder.Field(idx), val)
+	}
+
+	if rb.config.WithMetadata {
+		rb.appendMetadata(record)
+	}
+	return nil
+}
+
+func (rb *RecordBatchBuilder) arrowValue(idx int, val datahub.DataType) (any, error) {
+	switch v := val.(type) {
+	case datahub.Bigint:
+		return int64(v), nil
+	case datahub.Integer:
+		return int32(v), nil
+	case datahub.Smallint:
+		return int16(v), nil
+	case datahub.Tinyint:
+		return int8(v), nil
+	case datahub.Double:
+		return float64(v), nil
+	case datahub.Float:
+		return float32(v), nil
+	case datahub.Boolean:
+		return bool(v), nil
+	case datahub.String:
+		return string(v), nil
+	case datahub.Json:
+		return string(v), nil
+	case datahub.Timestamp:
+		return arrow.Timestamp(int64(v)), nil
+	case datahub.Decimal:
+		if dt, ok := rb.arrowSchema.Field(idx).Type.(*arrow.Decimal128Type); ok {
+			return toDecimal128(decimal.Decimal(v), dt.Precision, dt.Scale)
+		}
+	}
+	return nil, fmt.Errorf("value type[%T] not match field type[%s]", val, rb.schema.Fields[idx].Type)
+}
+
+// toDecimal128 converts the value without loss, the value must fit the precision and scale
+func toDecimal128(val decimal.Decimal, precision, scale int32) (decimal128.Num, error) {
+	shifted := val.Shift(scale)
+	if !shifted.IsInteger() {
+		return decimal128.Num{}, fmt.Errorf("decimal %s exceeds scale %d", val.String(), scale)
+	}
+
+	unscaled := shifted.BigInt()
+	if unscaled.BitLen() > 127 {
+		return decimal128.Num{}, fmt.Errorf("decimal %s exceeds precision %d", val.String(), precision)
+	}
+
+	num := decimal128.FromBigInt(unscaled)
+	if !num.FitsInPrecision(precision) {
+		return decimal128.Num{}, fmt.Errorf("decimal %s exceeds precision %d", val.String(), precision)
+	}
+	return num, nil
+}
+
+func appendValue(builder array.Builder, val any) {
+	switch v := val.(type) {
+	case nil:
+		builder.AppendNull()
+	case int64:
+		builder.(*array.Int64Builder).Append(v)
+	case int32:
+		builder.(*array.Int32Builder).Append(v)
+	case int16:
+		builder.(*array.Int16Builder).Append(v)
+	case int8:
+		builder.(*array.Int8Builder).Append(v)
+	case float64:
+		builder.(*array.Float64Builder).Append(v)
+	case float32:
+		builder.(*array.Float32Builder).Append(v)
+	case bool:
+		builder.(*array.BooleanBuilder).Append(v)
+	case string:
+		builder.(*array.StringBuilder).Append(v)
+	case arrow.Timestamp:
+		builder.(*array.TimestampBuilder).Append(v)
+	case decimal128.Num:
+		builder.(*array.Decimal128Builder).Append(v)
+	}
+}
+
+func (rb *RecordBatchBuilder) appendMetadata(record *datahub.TupleRecord) {
+	base := rb.schema.Size()
+	rb.builder.Field(base).(*array.StringBuilder).Append(record.ShardId)
+	rb.builder.Field(base + 1).(*array.Int64Builder).Append(record.Sequence)
+	rb.builder.Field(base + 2).(*array.TimestampBuilder).Append(arrow.Timestamp(record.SystemTime))
+
+	mapBuilder := rb.builder.Field(base + 3).(*array.MapBuilder)
+	mapBuilder.Append(true)
+	keyBuilder := mapBuilder.KeyBuilder().(*array.StringBuilder)
+	itemBuilder := mapBuilder.ItemBuilder().(*array.StringBuilder)
+	for key, val := range record.Attributes {
+		keyBuilder.Append(key)
+		itemBuilder.Append(val)
+	}
+}
+
+// NewRecordBatch returns the record batch of the appended records and resets the builder,
+// the caller must release the record batch.
+func (rb *RecordBatchBuilder) NewRecordBatch() arrow.Record {
+	return rb.builder.NewRecord()
+}
+
+func (rb *RecordBatchBuilder) Release() {
+	rb.builder.Release()
+}
+
+// ToRecordBatch converts the records sharing the schema to an arrow record batch,
+// the caller must release the record batch.
+func ToRecordBatch(schema *datahub.RecordSchema, records []*datahub.TupleRecord, config *WriterConfig) (arrow.Record, error) {
+	builder, err := NewRecordBatchBuilder(schema, config)
+	if err != nil {
+		return nil, err
+	}
+	defer builder.Release()
+
+	for _, record := range records {
+		if err := builder.Append(record); err != nil {
+			return nil, err
+		}
+	}
+	return builder.NewRecordBatch(), nil
+}
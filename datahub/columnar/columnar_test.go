@@ -0,0 +1,171 @@
+package columnar
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun-datahub-sdk-go/datahub"
+)
+
+func newTestSchema() *datahub.RecordSchema {
+	schema := datahub.NewRecordSchema()
+	schema.AddField(datahub.Field{Name: "f1", Type: datahub.BIGINT, AllowNull: false})
+	schema.AddField(datahub.Field{Name: "f2", Type: datahub.INTEGER, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f3", Type: datahub.SMALLINT, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f4", Type: datahub.TINYINT, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f5", Type: datahub.DOUBLE, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f6", Type: datahub.FLOAT, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f7", Type: datahub.BOOLEAN, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f8", Type: datahub.STRING, AllowNull: true, Comment: "name"})
+	schema.AddField(datahub.Field{Name: "f9", Type: datahub.TIMESTAMP, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f10", Type: datahub.DECIMAL, AllowNull: true})
+	schema.AddField(datahub.Field{Name: "f11", Type: datahub.JSON, AllowNull: true})
+	return schema
+}
+
+func newTestRecords(t *testing.T, schema *datahub.RecordSchema) []*datahub.TupleRecord {
+	record1 := datahub.NewTupleRecord(schema)
+	assert.Nil(t, record1.SetValues([]datahub.DataType{
+		datahub.Bigint(1), datahub.Integer(2), datahub.Smallint(3), datahub.Tinyint(4),
+		datahub.Double(5.5), datahub.Float(6.5), datahub.Boolean(true), datahub.String("abc"),
+		datahub.Timestamp(1748599432750123), datahub.Decimal(decimal.RequireFromString("-12.345")),
+		datahub.Json(`{"a":1}`),
+	}))
+	record1.ShardId = "0"
+	record1.Sequence = 100
+	record1.SystemTime = 1748599432750
+	record1.SetAttribute("k", "v")
+
+	record2 := datahub.NewTupleRecord(schema)
+	assert.Nil(t, record2.SetValues([]datahub.DataType{
+		datahub.Bigint(2), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+	}))
+	record2.ShardId = "1"
+	record2.Sequence = 200
+	return []*datahub.TupleRecord{record1, record2}
+}
+
+func TestArrowSchema(t *testing.T) {
+	schema, err := ArrowSchema(newTestSchema(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, schema.NumFields())
+	assert.Equal(t, arrow.PrimitiveTypes.Int64, schema.Field(0).Type)
+	assert.False(t, schema.Field(0).Nullable)
+	assert.Equal(t, arrow.PrimitiveTypes.Int8, schema.Field(3).Type)
+	assert.Equal(t, &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, schema.Field(8).Type)
+	assert.Equal(t, &arrow.Decimal128Type{Precision: 38, Scale: 18}, schema.Field(9).Type)
+	assert.Equal(t, arrow.BinaryTypes.String, schema.Field(10).Type)
+
+	val, _ := schema.Field(10).Metadata.GetValue(FieldTypeMetadataKey)
+	assert.Equal(t, "JSON", val)
+	val, _ = schema.Field(7).Metadata.GetValue(FieldCommentMetadataKey)
+	assert.Equal(t, "name", val)
+
+	config := NewWriterConfig()
+	config.WithMetadata = true
+	schema, err = ArrowSchema(newTestSchema(), config)
+	assert.Nil(t, err)
+	assert.Equal(t, 15, schema.NumFields())
+	assert.Equal(t, AttributesColumn, schema.Field(14).Name)
+
+	config.DecimalScale = 39
+	_, err = ArrowSchema(newTestSchema(), config)
+	assert.NotNil(t, err)
+
+	// the field precision and scale take precedence over the config
+	withPrecision := datahub.NewRecordSchema()
+	withPrecision.AddDecimalField(datahub.Field{Name: "f1", Type: datahub.DECIMAL, AllowNull: true}, datahub.DecimalProp{Precision: 10, Scale: 2})
+	schema, err = ArrowSchema(withPrecision, config)
+	assert.Nil(t, err)
+	assert.Equal(t, &arrow.Decimal128Type{Precision: 10, Scale: 2}, schema.Field(0).Type)
+
+	record := datahub.NewTupleRecord(withPrecision)
+	assert.Nil(t, record.SetValueByName("f1", "12.5"))
+	batch, err := ToRecordBatch(withPrecision, []*datahub.TupleRecord{record}, nil)
+	assert.Nil(t, err)
+	defer batch.Release()
+	assert.Equal(t, "12.5", batch.Column(0).(*array.Decimal128).ValueStr(0))
+}
+
+func TestToRecordBatch(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	schema := newTestSchema()
+	config := NewWriterConfig()
+	config.WithMetadata = true
+	config.DecimalPrecision = 10
+	config.DecimalScale = 3
+	config.Allocator = mem
+
+	batch, err := ToRecordBatch(schema, newTestRecords(t, schema), config)
+	assert.Nil(t, err)
+	defer batch.Release()
+
+	assert.Equal(t, int64(2), batch.NumRows())
+	assert.Equal(t, []int64{1, 2}, batch.Column(0).(*array.Int64).Int64Values())
+	assert.True(t, batch.Column(1).IsNull(1))
+	assert.Equal(t, "-12.345", batch.Column(9).(*array.Decimal128).ValueStr(0))
+	assert.Equal(t, arrow.Timestamp(1748599432750123), batch.Column(8).(*array.Timestamp).Value(0))
+	assert.Equal(t, `{"a":1}`, batch.Column(10).(*array.String).Value(0))
+	assert.Equal(t, "1", batch.Column(11).(*array.String).Value(1))
+	assert.Equal(t, int64(200), batch.Column(12).(*array.Int64).Value(1))
+	assert.Equal(t, `[{"key":"k","value":"v"}]`, batch.Column(14).(*array.Map).ValueStr(0))
+
+	// the value exceeding the scale is not rounded
+	record := datahub.NewTupleRecord(schema)
+	assert.Nil(t, record.SetValueByName("f1", 1))
+	assert.Nil(t, record.SetValueByName("f10", decimal.RequireFromString("1.2345")))
+	_, err = ToRecordBatch(schema, []*datahub.TupleRecord{record}, config)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, record.SetValueByName("f10", decimal.RequireFromString("123456789")))
+	_, err = ToRecordBatch(schema, []*datahub.TupleRecord{record}, config)
+	assert.NotNil(t, err)
+}
+
+func TestParquetWriter(t *testing.T) {
+	schema := newTestSchema()
+	config := NewWriterConfig()
+	config.WithMetadata = true
+
+	var buf bytes.Buffer
+	writer, err := NewParquetWriter(&buf, schema, config)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Write(newTestRecords(t, schema)))
+
+	// the failed batch writes nothing
+	other := datahub.NewRecordSchema()
+	other.AddField(datahub.Field{Name: "f1", Type: datahub.BIGINT})
+	assert.NotNil(t, writer.Write([]*datahub.TupleRecord{newTestRecords(t, schema)[0], datahub.NewTupleRecord(other)}))
+	assert.Nil(t, writer.Close())
+
+	reader, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	defer reader.Close()
+	assert.Equal(t, int64(2), reader.NumRows())
+
+	fileReader, err := pqarrow.NewFileReader(reader, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	assert.Nil(t, err)
+	table, err := fileReader.ReadTable(context.Background())
+	assert.Nil(t, err)
+	defer table.Release()
+
+	assert.Equal(t, int64(15), table.NumCols())
+	assert.Equal(t, "f9", table.Schema().Field(8).Name)
+	assert.Equal(t, &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, table.Schema().Field(8).Type)
+	assert.Equal(t, &arrow.Decimal128Type{Precision: 38, Scale: 18}, table.Schema().Field(9).Type)
+
+	decimals := table.Column(9).Data().Chunk(0).(*array.Decimal128)
+	assert.Equal(t, "-12.345", decimals.ValueStr(0))
+	assert.True(t, decimals.IsNull(1))
+}
@@ -0,0 +1,63 @@
+package columnar
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	"github.com/aliyun/aliyun-datahub-sdk-go/datahub"
+)
+
+// ParquetWriter writes the tuple records of a schema to a parquet file, every Write is a row group
+type ParquetWriter struct {
+	builder *RecordBatchBuilder
+	writer  *pqarrow.FileWriter
+}
+
+func NewParquetWriter(w io.Writer, schema *datahub.RecordSchema, config *WriterConfig) (*ParquetWriter, error) {
+	if config == nil {
+		config = NewWriterConfig()
+	}
+
+	builder, err := NewRecordBatchBuilder(schema, config)
+	if err != nil {
+		return nil, err
+	}
+
+	props := parquet.NewWriterProperties(parquet.WithCompression(config.Compression))
+	writer, err := pqarrow.NewFileWriter(builder.Schema(), w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		builder.Release()
+		return nil, err
+	}
+
+	return &ParquetWriter{
+		builder: builder,
+		writer:  writer,
+	}, nil
+}
+
+// Write writes the records as a row group, nothing is written if any record fails
+func (pw *ParquetWriter) Write(records []*datahub.TupleRecord) error {
+	for _, record := range records {
+		if err := pw.builder.Append(record); err != nil {
+			// drop the appended records
+			pw.builder.NewRecordBatch().Release()
+			return err
+		}
+	}
+
+	batch := pw.builder.NewRecordBatch()
+	defer batch.Release()
+	if batch.NumRows() == 0 {
+		return nil
+	}
+	return pw.writer.Write(batch)
+}
+
+// Close writes the footer of the parquet file and closes the underlying writer if it is an io.Closer
+func (pw *ParquetWriter) Close() error {
+	defer pw.builder.Release()
+	return pw.writer.Close()
+}
@@ -10,6 +10,9 @@ import (
 // Consumer provides high-level consumption API.
 type Consumer interface {
 	Init() error
+
+	// Read returns the next record, or nil if there is none in the timeout. A record that
+	// can not be projected onto the target schema is acked and returned in a *SchemaProjectionError.
 	Read(timeout time.Duration) (IRecord, error)
 	GetCurrentShards() []string
 	Close() error
@@ -69,6 +72,13 @@ func (ci *consumerImpl) Init() error {
 	ci.groupManager = newGroupManager(ci.project, ci.topic, ci.config.SubId, ci.client, ci.config.SessionTimeout)
 	ci.offsetManager = newOffsetManager(ci.project, ci.topic, ci.config.SubId, ci.client,
 		ci.config.CommitInterval)
+	if ci.config.EnableDedup {
+		var store *dedupStore
+		if len(ci.config.DedupStateDir) > 0 {
+			store = newDedupStore(ci.config.DedupStateDir, ci.project, ci.topic, ci.config.SubId)
+		}
+		ci.offsetManager.setDedup(ci.config.DedupWindow, store)
+	}
 	ci.shardGroupReader = newShardGroupReader(ci.project, ci.topic, ci.client,
 		ci.offsetManager, ci.config)
 
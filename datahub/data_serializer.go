@@ -184,10 +184,14 @@ func (ad *avroDataDeserializer) getSchema(header *batchHeader) (*RecordSchema, a
 
 	truncated := false
 	dhSchema := schema
+	if dhSchema != nil && int(header.schemaColumnNum) > dhSchema.Size() {
+		return nil, nil, fmt.Errorf("schema version %d has %d fields, but the record has %d",
+			header.schemaVersion, dhSchema.Size(), header.schemaColumnNum)
+	}
 	if dhSchema != nil && header.schemaColumnNum != 0 && int(header.schemaColumnNum) != dhSchema.Size() {
 		dhSchema = NewRecordSchema()
 		for i := 0; i < int(header.schemaColumnNum); i++ {
-			dhSchema.AddField(schema.Fields[i])
+			dhSchema.AddDecimalField(schema.Fields[i], schema.GetDecimalProp(schema.Fields[i].Name))
 		}
 		truncated = true
 	}
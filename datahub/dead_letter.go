@@ -0,0 +1,155 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The attributes of the records delivered to DeadLetterSink
+const (
+	DeadLetterErrorCodeAttribute    = "__dh_dlq_error_code__"
+	DeadLetterErrorMessageAttribute = "__dh_dlq_error_message__"
+	DeadLetterShardIdAttribute      = "__dh_dlq_shard_id__"
+	DeadLetterAttemptsAttribute     = "__dh_dlq_attempts__"
+)
+
+// DeadLetterSink receives the records failed finally in AsyncProducer, the records
+// are copies of the failed ones with the dead letter attributes. Deliver is called
+// before the error is sent to the Errors channel, the error is still sent after delivered.
+// Deliver is called synchronously by the goroutine sending the shard or replaying the
+// spool, the later batches wait until it returns, so a slow sink should hand the records
+// over to its own goroutine.
+type DeadLetterSink interface {
+	Deliver(records []IRecord) error
+}
+
+// DeadLetterFunc is an adapter to use a function as DeadLetterSink
+type DeadLetterFunc func(records []IRecord) error
+
+func (f DeadLetterFunc) Deliver(records []IRecord) error {
+	return f(records)
+}
+
+type deadLetterTopicSink struct {
+	producer Producer
+}
+
+// NewDeadLetterTopicSink writes the failed records to another topic by the producer,
+// the topic must accept the records, e.g. a topic of the same schema.
+func NewDeadLetterTopicSink(producer Producer) DeadLetterSink {
+	return &deadLetterTopicSink{producer: producer}
+}
+
+func (ds *deadLetterTopicSink) Deliver(records []IRecord) error {
+	_, err := ds.producer.Send(records)
+	return err
+}
+
+// DeadLetterFileSink appends the failed records to a local file in JSON lines,
+// every line has the Data and Attributes of a record.
+type DeadLetterFileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewDeadLetterFileSink(path string) (*DeadLetterFileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterFileSink{file: file}, nil
+}
+
+func (fs *DeadLetterFileSink) Deliver(records []IRecord) error {
+	buf := make([]byte, 0)
+	for _, record := range records {
+		line, err := json.Marshal(struct {
+			Data       any               `json:"Data"`
+			Attributes map[string]string `json:"Attributes"`
+		}{
+			Data:       record.GetData(),
+			Attributes: record.GetAttributes(),
+		})
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	_, err := fs.file.Write(buf)
+	return err
+}
+
+func (fs *DeadLetterFileSink) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.file.Close()
+}
+
+// errorCode returns the DataHub error code, or the client side error class
+func errorCode(err error) string {
+	if ec, ok := err.(interface{ errorCode() string }); ok && len(ec.errorCode()) > 0 {
+		return ec.errorCode()
+	}
+
+	if IsNetworkError(err) {
+		return "NetworkError"
+	}
+	return "ClientError"
+}
+
+// deliverDeadLetter sends the copies of the records to the sink, attempts is
+// the number of requests sent for the records.
+func deliverDeadLetter(sink DeadLetterSink, metaKey, shardId string, records []IRecord, attempts int, err error) {
+	if sink == nil || len(records) == 0 {
+		return
+	}
+
+	copies := make([]IRecord, 0, len(records))
+	for _, record := range records {
+		newRecord, cerr := copyRecord(record)
+		if cerr != nil {
+			log.Errorf("%s copy dead letter record failed, error:%v", metaKey, cerr)
+			continue
+		}
+
+		newRecord.SetShardId("")
+		newRecord.SetAttribute(DeadLetterErrorCodeAttribute, errorCode(err))
+		newRecord.SetAttribute(DeadLetterErrorMessageAttribute, err.Error())
+		newRecord.SetAttribute(DeadLetterShardIdAttribute, shardId)
+		newRecord.SetAttribute(DeadLetterAttemptsAttribute, strconv.Itoa(attempts))
+		copies = append(copies, newRecord)
+	}
+
+	if derr := sink.Deliver(copies); derr != nil {
+		log.Errorf("%s deliver %d records to dead letter sink failed, error:%v", metaKey, len(copies), derr)
+	}
+}
+
+// copyRecord copies the record with its own attributes
+func copyRecord(record IRecord) (IRecord, error) {
+	baseRecord := record.GetBaseRecord()
+	attributes := make(map[string]string, len(baseRecord.Attributes))
+	for k, v := range baseRecord.Attributes {
+		attributes[k] = v
+	}
+	baseRecord.Attributes = attributes
+
+	switch realRecord := record.(type) {
+	case *BlobRecord:
+		return &BlobRecord{RawData: realRecord.RawData, BaseRecord: baseRecord}, nil
+	case *TupleRecord:
+		values := make([]DataType, len(realRecord.Values))
+		copy(values, realRecord.Values)
+		return &TupleRecord{RecordSchema: realRecord.RecordSchema, Values: values, BaseRecord: baseRecord}, nil
+	default:
+		return nil, fmt.Errorf("unknown record type %T", record)
+	}
+}
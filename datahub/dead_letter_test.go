@@ -0,0 +1,134 @@
+package datahub
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterNonRetryableError(t *testing.T) {
+	var delivered []IRecord
+	cfg := NewProducerConfig()
+	cfg.DeadLetterSink = DeadLetterFunc(func(records []IRecord) error {
+		delivered = append(delivered, records...)
+		return nil
+	})
+	putErr := &MalformedRecordError{DatahubError{StatusCode: 400, Code: "MalformedRecord", Message: "bad record"}}
+	client := &producerMockClient{putErr: putErr}
+	writer := newShardWriterForTest(cfg, client, nil)
+
+	record := NewBlobRecord([]byte("hello"))
+	record.SetShardId("0")
+	record.SetAttribute("key", "val")
+	batch := []IRecord{record}
+	res, latency, attempts, err := writer.sendWithRetry(batch)
+	writer.handleResult(batch, nil, res, latency, attempts, err)
+
+	assert.Equal(t, 1, len(writer.parentErrors))
+	assert.Equal(t, 1, len(delivered))
+	attrs := delivered[0].GetAttributes()
+	assert.Equal(t, "MalformedRecord", attrs[DeadLetterErrorCodeAttribute])
+	assert.Equal(t, putErr.Error(), attrs[DeadLetterErrorMessageAttribute])
+	assert.Equal(t, "0", attrs[DeadLetterShardIdAttribute])
+	assert.Equal(t, "1", attrs[DeadLetterAttemptsAttribute])
+	assert.Equal(t, "val", attrs["key"])
+	assert.Equal(t, "", delivered[0].GetBaseRecord().ShardId)
+
+	// the original record is not changed
+	assert.Equal(t, 1, len(record.GetAttributes()))
+	assert.Equal(t, "0", record.ShardId)
+}
+
+func TestDeadLetterRetryExhausted(t *testing.T) {
+	var delivered []IRecord
+	cfg := NewProducerConfig()
+	cfg.MaxRetry = 2
+	cfg.RetryInterval = 0
+	cfg.EnableErrorCh = false
+	cfg.DeadLetterSink = DeadLetterFunc(func(records []IRecord) error {
+		delivered = append(delivered, records...)
+		return nil
+	})
+	client := &producerMockClient{putErr: newNetworkError(fmt.Errorf("timeout"))}
+	writer := newShardWriterForTest(cfg, client, nil)
+
+	batch := []IRecord{NewBlobRecord([]byte("a")), NewBlobRecord([]byte("b"))}
+	res, latency, attempts, err := writer.sendWithRetry(batch)
+	writer.handleResult(batch, nil, res, latency, attempts, err)
+
+	assert.Equal(t, 0, len(writer.parentErrors))
+	assert.Equal(t, 2, len(delivered))
+	assert.Equal(t, "NetworkError", delivered[0].GetAttributes()[DeadLetterErrorCodeAttribute])
+	assert.Equal(t, "3", delivered[1].GetAttributes()[DeadLetterAttemptsAttribute])
+}
+
+func TestDeadLetterSpoolReplayAttempts(t *testing.T) {
+	var delivered []IRecord
+	cfg := NewProducerConfig()
+	cfg.EnableErrorCh = false
+	cfg.DeadLetterSink = DeadLetterFunc(func(records []IRecord) error {
+		delivered = append(delivered, records...)
+		return nil
+	})
+
+	dir := t.TempDir()
+	spool, dhSchema := newSpoolForTest(dir, 0)
+	assert.Nil(t, spool.recover())
+	entry, err := spool.append("0", []IRecord{genTupleRecord(dhSchema)}, 3, false)
+	assert.Nil(t, err)
+
+	client := &producerMockClient{putErr: newNetworkError(fmt.Errorf("timeout"))}
+	ap := newAsyncProducer(cfg, nil)
+	ap.client = client
+	ap.spool = spool
+	assert.False(t, ap.replaySpoolEntry(entry))
+	assert.Equal(t, 4, entry.attempts)
+
+	// the attempts survive the restart
+	newSpool, _ := newSpoolForTest(dir, 0)
+	assert.Nil(t, newSpool.recover())
+	entry = newSpool.peek()
+	assert.Equal(t, 4, entry.attempts)
+
+	ap.spool = newSpool
+	client.putErr = &MalformedRecordError{DatahubError{StatusCode: 400, Code: "MalformedRecord", Message: "bad record"}}
+	assert.True(t, ap.replaySpoolEntry(entry))
+	assert.Equal(t, 1, len(delivered))
+	assert.Equal(t, "5", delivered[0].GetAttributes()[DeadLetterAttemptsAttribute])
+	assert.Equal(t, 0, newSpool.stats().Batches)
+}
+
+func TestDeadLetterFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	sink, err := NewDeadLetterFileSink(path)
+	assert.Nil(t, err)
+
+	deliverDeadLetter(sink, "test", "1", []IRecord{NewBlobRecord([]byte("a")), NewBlobRecord([]byte("b"))},
+		2, fmt.Errorf("failed"))
+	assert.Nil(t, sink.Close())
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line struct {
+			Data       []byte
+			Attributes map[string]string
+		}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+		assert.Equal(t, "ClientError", line.Attributes[DeadLetterErrorCodeAttribute])
+		assert.Equal(t, "failed", line.Attributes[DeadLetterErrorMessageAttribute])
+		assert.Equal(t, "1", line.Attributes[DeadLetterShardIdAttribute])
+		assert.Equal(t, "2", line.Attributes[DeadLetterAttemptsAttribute])
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
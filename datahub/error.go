@@ -175,6 +175,11 @@ type DatahubError struct {
 	Detail     string `json:"ErrorDetail"`  // Error detail
 }
 
+// errorCode is promoted to the typed errors embedding DatahubError
+func (err *DatahubError) errorCode() string {
+	return err.Code
+}
+
 func (err *DatahubError) Error() string {
 	return fmt.Sprintf("HttpCode: %d, RequestId: %s, ErrCode: %s, ErrMsg: %s, ErrDetail: %s",
 		err.StatusCode, err.RequestId, err.Code, err.Message, err.Detail)
@@ -0,0 +1,219 @@
+package datahub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// The attributes stamped by the idempotent producer, see ProducerConfig.EnableIdempotence
+const (
+	ProducerIdAttribute       = "__dh_producer_id__"
+	ProducerSequenceAttribute = "__dh_producer_seq__"
+)
+
+// idempotentStamper stamps records with the producer id and a monotonically
+// increasing sequence, the sequence is kept by retries since the same record
+// objects are sent again.
+type idempotentStamper struct {
+	producerId string
+	sequence   atomic.Int64
+}
+
+func newIdempotentStamper(producerId string) *idempotentStamper {
+	if len(producerId) == 0 {
+		producerId = newProducerId()
+	}
+	return &idempotentStamper{producerId: producerId}
+}
+
+func newProducerId() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err) // There should be no error returned here
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (is *idempotentStamper) stamp(record IRecord) {
+	if is == nil {
+		return
+	}
+
+	// records sent again by the user after a failure keep their sequence,
+	// the failed request may have been written actually
+	if _, ok := record.GetAttributes()[ProducerSequenceAttribute]; ok {
+		return
+	}
+	record.SetAttribute(ProducerIdAttribute, is.producerId)
+	record.SetAttribute(ProducerSequenceAttribute, strconv.FormatInt(is.sequence.Add(1), 10))
+}
+
+func (is *idempotentStamper) stampBatch(records []IRecord) {
+	for _, record := range records {
+		is.stamp(record)
+	}
+}
+
+// getProducerSequence returns the producer id and sequence stamped by the idempotent producer
+func getProducerSequence(record IRecord) (string, int64, bool) {
+	attrs := record.GetAttributes()
+	producerId, ok := attrs[ProducerIdAttribute]
+	if !ok {
+		return "", 0, false
+	}
+
+	seq, err := strconv.ParseInt(attrs[ProducerSequenceAttribute], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return producerId, seq, true
+}
+
+// dedupWindow remembers the latest sequences of each producer, a sequence is a
+// duplicate if it has been seen and is within window of the largest sequence of the
+// producer. Older sequences are always passed since they cannot be told apart.
+type dedupWindow struct {
+	mutex     sync.Mutex
+	window    int64
+	producers map[string]*producerSeen
+}
+
+type producerSeen struct {
+	max  int64
+	seen map[int64]struct{}
+}
+
+func newDedupWindow(window int64) *dedupWindow {
+	return &dedupWindow{
+		window:    window,
+		producers: make(map[string]*producerSeen),
+	}
+}
+
+// check records the sequence and returns true if it has been seen before
+func (dw *dedupWindow) check(producerId string, seq int64) bool {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	ps, ok := dw.producers[producerId]
+	if !ok {
+		ps = &producerSeen{max: seq, seen: make(map[int64]struct{})}
+		dw.producers[producerId] = ps
+	}
+
+	if seq <= ps.max-dw.window {
+		return false
+	}
+
+	if _, ok := ps.seen[seq]; ok {
+		return true
+	}
+
+	ps.seen[seq] = struct{}{}
+	if seq > ps.max {
+		ps.max = seq
+	}
+
+	// prune lazily to amortize the cost
+	if int64(len(ps.seen)) > 2*dw.window {
+		for s := range ps.seen {
+			if s <= ps.max-dw.window {
+				delete(ps.seen, s)
+			}
+		}
+	}
+	return false
+}
+
+func (dw *dedupWindow) clone() *dedupWindow {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	newWindow := newDedupWindow(dw.window)
+	for producerId, ps := range dw.producers {
+		seen := make(map[int64]struct{}, len(ps.seen))
+		for s := range ps.seen {
+			seen[s] = struct{}{}
+		}
+		newWindow.producers[producerId] = &producerSeen{max: ps.max, seen: seen}
+	}
+	return newWindow
+}
+
+// dedupStore persists the dedup state of every shard to <dir>/<shardId>.json
+type dedupStore struct {
+	dir string
+}
+
+type dedupState struct {
+	Sequence  int64              `json:"Sequence"`
+	Producers map[string][]int64 `json:"Producers"`
+}
+
+func newDedupStore(dir, project, topic, subId string) *dedupStore {
+	return &dedupStore{dir: filepath.Join(dir, project, topic, subId)}
+}
+
+func (ds *dedupStore) path(shardId string) string {
+	return filepath.Join(ds.dir, shardId+".json")
+}
+
+// load returns an empty window if the state of the shard does not exist
+func (ds *dedupStore) load(shardId string, window int64) (*dedupWindow, error) {
+	dw := newDedupWindow(window)
+	buf, err := os.ReadFile(ds.path(shardId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dw, nil
+		}
+		return dw, err
+	}
+
+	state := &dedupState{}
+	if err := json.Unmarshal(buf, state); err != nil {
+		return dw, err
+	}
+
+	for producerId, seqs := range state.Producers {
+		for _, seq := range seqs {
+			dw.check(producerId, seq)
+		}
+	}
+	return dw, nil
+}
+
+// save writes the window of the shard, sequence is the committed offset it belongs to
+func (ds *dedupStore) save(shardId string, sequence int64, dw *dedupWindow) error {
+	state := &dedupState{
+		Sequence:  sequence,
+		Producers: make(map[string][]int64),
+	}
+
+	dw.mutex.Lock()
+	for producerId, ps := range dw.producers {
+		seqs := make([]int64, 0, len(ps.seen))
+		for s := range ps.seen {
+			if s > ps.max-dw.window {
+				seqs = append(seqs, s)
+			}
+		}
+		state.Producers[producerId] = seqs
+	}
+	dw.mutex.Unlock()
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ds.dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(ds.path(shardId), buf)
+}
@@ -0,0 +1,109 @@
+package datahub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotentStamper(t *testing.T) {
+	stamper := newIdempotentStamper("p1")
+	records := []IRecord{NewBlobRecord([]byte("a")), NewBlobRecord([]byte("b"))}
+	stamper.stampBatch(records)
+
+	producerId, seq, ok := getProducerSequence(records[1])
+	assert.True(t, ok)
+	assert.Equal(t, "p1", producerId)
+	assert.Equal(t, int64(2), seq)
+
+	// sent again keeps the sequence
+	stamper.stamp(records[0])
+	_, seq, _ = getProducerSequence(records[0])
+	assert.Equal(t, int64(1), seq)
+
+	var disabled *idempotentStamper
+	record := NewBlobRecord([]byte("c"))
+	disabled.stamp(record)
+	_, _, ok = getProducerSequence(record)
+	assert.False(t, ok)
+	assert.Equal(t, 32, len(newIdempotentStamper("").producerId))
+}
+
+func TestDedupWindow(t *testing.T) {
+	dw := newDedupWindow(3)
+	assert.False(t, dw.check("p1", 1))
+	assert.False(t, dw.check("p1", 3))
+	assert.False(t, dw.check("p1", 2))
+	assert.True(t, dw.check("p1", 3))
+	assert.False(t, dw.check("p2", 3))
+
+	// out of window
+	assert.False(t, dw.check("p1", 10))
+	assert.False(t, dw.check("p1", 3))
+	assert.True(t, dw.check("p1", 10))
+}
+
+func TestDedupStore(t *testing.T) {
+	store := newDedupStore(t.TempDir(), "test_project", "test_topic", "sub")
+	dw, err := store.load("0", 10)
+	assert.Nil(t, err)
+	dw.check("p1", 5)
+	dw.check("p1", 6)
+	assert.Nil(t, store.save("0", 100, dw))
+
+	newDw, err := store.load("0", 10)
+	assert.Nil(t, err)
+	assert.True(t, newDw.check("p1", 5))
+	assert.False(t, newDw.check("p1", 7))
+}
+
+func TestOffsetManagerDedup(t *testing.T) {
+	dir := t.TempDir()
+	mockClient := newOffsetManagerMockClient()
+	om := newOffsetManager("test-project", "test-topic", "test-sub", mockClient, 10*time.Second)
+	om.setDedup(100, newDedupStore(dir, "test-project", "test-topic", "test-sub"))
+	om.addShards([]string{"0"})
+
+	stamper := newIdempotentStamper("p1")
+	genRecords := func(start int64) []IRecord {
+		records := make([]IRecord, 0)
+		for i := int64(0); i < 2; i++ {
+			record := NewBlobRecord([]byte("test"))
+			stamper.stamp(record)
+			rk := newRecordKey("0", start+i, 0, 0)
+			om.appendRecordKey(rk)
+			record.setRecordKey(rk)
+			records = append(records, record)
+		}
+		return records
+	}
+
+	records := genRecords(1)
+	assert.Len(t, om.filterDuplicates("0", records), 2)
+
+	// replay of the same records
+	replays := make([]IRecord, 0)
+	for i, record := range records {
+		replay := NewBlobRecord([]byte("test"))
+		for k, v := range record.GetAttributes() {
+			replay.SetAttribute(k, v)
+		}
+		rk := newRecordKey("0", int64(3+i), 0, 0)
+		om.appendRecordKey(rk)
+		replay.setRecordKey(rk)
+		replays = append(replays, replay)
+	}
+	assert.Len(t, om.filterDuplicates("0", replays), 0)
+	assert.True(t, replays[0].GetRecordKey().(*recordKeyImpl).isAcked())
+
+	// only the committed records are persisted
+	records[0].GetRecordKey().Ack()
+	om.doCommit()
+
+	newOm := newOffsetManager("test-project", "test-topic", "test-sub", mockClient, 10*time.Second)
+	newOm.setDedup(100, newDedupStore(dir, "test-project", "test-topic", "test-sub"))
+	newOm.addShards([]string{"0"})
+	assert.True(t, newOm.shardInfos["0"].dedup.check("p1", 1))
+	assert.False(t, newOm.shardInfos["0"].dedup.check("p1", 2))
+}
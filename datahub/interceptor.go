@@ -0,0 +1,56 @@
+package datahub
+
+import "fmt"
+
+// ProducerInterceptor intercepts the records of Producer and AsyncProducer,
+// it can be used to enrich or validate records in one place.
+type ProducerInterceptor interface {
+	// OnSend is called before the record is partitioned, the returned record is
+	// sent instead of the input one. Return an error to reject the record.
+	OnSend(record IRecord) (IRecord, error)
+
+	// OnAcknowledgement is called once for every record passed OnSend or rejected by it,
+	// after the request of the records succeeded (err is nil) or finally failed.
+	OnAcknowledgement(shardId string, records []IRecord, err error)
+}
+
+type interceptorChain []ProducerInterceptor
+
+// onSend calls interceptors in order, the record returned by an interceptor
+// is the input of the next one.
+func (ic interceptorChain) onSend(record IRecord) (IRecord, error) {
+	var err error
+	for _, interceptor := range ic {
+		record, err = interceptor.OnSend(record)
+		if err != nil {
+			return nil, err
+		}
+
+		if record == nil {
+			return nil, fmt.Errorf("interceptor %T returned nil record", interceptor)
+		}
+	}
+	return record, nil
+}
+
+func (ic interceptorChain) onSendBatch(records []IRecord) ([]IRecord, error) {
+	if len(ic) == 0 {
+		return records, nil
+	}
+
+	newRecords := make([]IRecord, 0, len(records))
+	for _, record := range records {
+		newRecord, err := ic.onSend(record)
+		if err != nil {
+			return nil, err
+		}
+		newRecords = append(newRecords, newRecord)
+	}
+	return newRecords, nil
+}
+
+func (ic interceptorChain) onAcknowledgement(shardId string, records []IRecord, err error) {
+	for _, interceptor := range ic {
+		interceptor.OnAcknowledgement(shardId, records, err)
+	}
+}
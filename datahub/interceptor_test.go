@@ -0,0 +1,87 @@
+package datahub
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type attributeInterceptor struct {
+	acked  atomic.Int32
+	failed atomic.Int32
+}
+
+func (ai *attributeInterceptor) OnSend(record IRecord) (IRecord, error) {
+	if _, ok := record.GetAttributes()["invalid"]; ok {
+		return nil, fmt.Errorf("invalid record")
+	}
+	record.SetAttribute("service", "test")
+	return record, nil
+}
+
+func (ai *attributeInterceptor) OnAcknowledgement(shardId string, records []IRecord, err error) {
+	if err != nil {
+		ai.failed.Add(int32(len(records)))
+	} else {
+		ai.acked.Add(int32(len(records)))
+	}
+}
+
+func newProducerForTest(cfg *ProducerConfig, client DataHubApi) *producerImpl {
+	pi := NewProducer(cfg).(*producerImpl)
+	pi.client = client
+	pi.shards = []string{"0"}
+	pi.nextFreshShardTime.Store(time.Now().Add(time.Hour))
+	return pi
+}
+
+func TestProducerInterceptor(t *testing.T) {
+	interceptor := &attributeInterceptor{}
+	cfg := NewProducerConfig()
+	cfg.Interceptors = []ProducerInterceptor{interceptor}
+	client := &producerMockClient{}
+	producer := newProducerForTest(cfg, client)
+
+	_, err := producer.Send([]IRecord{NewBlobRecord([]byte("test")), NewBlobRecord([]byte("test"))})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), interceptor.acked.Load())
+	assert.Equal(t, "test", client.batches[0][0].GetAttributes()["service"])
+
+	invalid := NewBlobRecord([]byte("test"))
+	invalid.SetAttribute("invalid", "true")
+	_, err = producer.SendByShard([]IRecord{NewBlobRecord([]byte("test")), invalid}, "0")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), interceptor.failed.Load())
+	assert.Equal(t, 1, len(client.batches))
+}
+
+func TestAsyncProducerInterceptorReject(t *testing.T) {
+	interceptor := &attributeInterceptor{}
+	cfg := NewProducerConfig()
+	cfg.Interceptors = []ProducerInterceptor{interceptor}
+	client := &producerMockClient{shards: []ShardEntry{{ShardId: "0", State: ACTIVE}}}
+
+	ap := NewAsyncProducer(cfg).(*asyncProducerImpl)
+	ap.client = client
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	assert.Nil(t, ap.freshShard())
+	ap.wg.Add(2)
+	go ap.dispatch()
+	go ap.dispatchBatch()
+
+	invalid := NewBlobRecord([]byte("test"))
+	invalid.SetAttribute("invalid", "true")
+	ap.Input() <- invalid
+	ap.Input() <- NewBlobRecord([]byte("test"))
+	perr := <-ap.Errors()
+	assert.Equal(t, invalid, perr.Records[0])
+
+	assert.Nil(t, ap.Close())
+	suc := <-ap.Successes()
+	assert.Equal(t, "test", suc.Records[0].GetAttributes()["service"])
+	assert.Equal(t, int32(1), interceptor.acked.Load())
+	assert.Equal(t, int32(1), interceptor.failed.Load())
+}
@@ -1,9 +1,15 @@
 package datahub
 
 import (
+	"fmt"
+	"time"
+
 	jsoniter "github.com/json-iterator/go"
 )
 
+// TupleRecordMetadataKey is the json key of the BaseRecord metadata, see WithMetadata
+const TupleRecordMetadataKey = "__meta__"
+
 var parser = jsoniter.Config{
 	UseNumber: true,
 }.Froze()
@@ -18,11 +24,15 @@ func parseJson(buf []byte) (map[string]any, error) {
 	return obj, nil
 }
 
+// JsonParseOption is the option of the json encoding and parsing of tuple records
 type JsonParseOption func(*jsonParseConfig) error
 
 func newDefaultJsonParseConfig() *jsonParseConfig {
 	return &jsonParseConfig{
 		ignoreNotExistKey: false,
+		timestampLayout:   "",
+		timestampLocation: time.UTC,
+		withMetadata:      false,
 	}
 }
 
@@ -38,6 +48,9 @@ func getJsonParseConfig(opts ...JsonParseOption) (*jsonParseConfig, error) {
 
 type jsonParseConfig struct {
 	ignoreNotExistKey bool
+	timestampLayout   string
+	timestampLocation *time.Location
+	withMetadata      bool
 }
 
 func WithIgnoreNotExistKey(b bool) JsonParseOption {
@@ -46,3 +59,31 @@ func WithIgnoreNotExistKey(b bool) JsonParseOption {
 		return nil
 	}
 }
+
+// WithTimestampLayout formats and parses the TIMESTAMP fields by the time layout,
+// empty means the microseconds since epoch.
+func WithTimestampLayout(layout string) JsonParseOption {
+	return func(o *jsonParseConfig) error {
+		o.timestampLayout = layout
+		return nil
+	}
+}
+
+// WithTimestampLocation is the location of the formatted TIMESTAMP fields, default UTC
+func WithTimestampLocation(loc *time.Location) JsonParseOption {
+	return func(o *jsonParseConfig) error {
+		if loc == nil {
+			return fmt.Errorf("timestamp location is nil")
+		}
+		o.timestampLocation = loc
+		return nil
+	}
+}
+
+// WithMetadata includes the BaseRecord metadata under TupleRecordMetadataKey
+func WithMetadata(b bool) JsonParseOption {
+	return func(o *jsonParseConfig) error {
+		o.withMetadata = b
+		return nil
+	}
+}
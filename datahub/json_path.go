@@ -0,0 +1,142 @@
+package datahub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JsonPathNotFoundError is returned by the json path accessors if the path does not exist
+type JsonPathNotFoundError struct {
+	Field string
+	Path  string
+}
+
+func (e *JsonPathNotFoundError) Error() string {
+	return fmt.Sprintf("[%s] json path %q not found", e.Field, e.Path)
+}
+
+func IsJsonPathNotFoundError(err error) bool {
+	_, ok := err.(*JsonPathNotFoundError)
+	return ok
+}
+
+// parseJsonPath parses the path like a.b[0].c to the jsoniter path, the keys are string and
+// the indexes are int, the empty path is the whole document.
+func parseJsonPath(path string) ([]any, error) {
+	result := make([]any, 0)
+	if len(path) == 0 {
+		return result, nil
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		if pos := strings.IndexByte(part, '['); pos >= 0 {
+			key = part[:pos]
+			part = part[pos:]
+		} else {
+			part = ""
+		}
+
+		if len(key) > 0 {
+			result = append(result, key)
+		} else if len(part) == 0 {
+			return nil, fmt.Errorf("json path %q has empty key", path)
+		}
+
+		for len(part) > 0 {
+			end := strings.IndexByte(part, ']')
+			if part[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("json path %q illegal", path)
+			}
+
+			idx, err := strconv.Atoi(part[1:end])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("json path %q has illegal index %q", path, part[1:end])
+			}
+			result = append(result, idx)
+			part = part[end+1:]
+		}
+	}
+	return result, nil
+}
+
+// getJsonPathRaw returns the raw json at the path of the JSON field
+func (tr *TupleRecord) getJsonPathRaw(name, path string) ([]byte, error) {
+	val, err := tr.GetValueByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := tr.RecordSchema.GetFieldIndex(name)
+	if ft := tr.RecordSchema.Fields[idx].Type; ft != JSON {
+		return nil, fmt.Errorf("[%s] field type %s is not JSON", name, ft)
+	}
+
+	if val == nil {
+		return nil, &JsonPathNotFoundError{Field: name, Path: path}
+	}
+
+	jsonPath, err := parseJsonPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	node := parser.Get([]byte(val.(Json)), jsonPath...)
+	if node.ValueType() == jsoniter.InvalidValue {
+		return nil, &JsonPathNotFoundError{Field: name, Path: path}
+	}
+	return parser.Marshal(node)
+}
+
+// GetJsonPath returns the value at the path like "a.b[0]" of the JSON field, the objects are
+// map[string]any, the arrays are []any and the numbers are json.Number.
+func (tr *TupleRecord) GetJsonPath(name, path string) (any, error) {
+	raw, err := tr.getJsonPathRaw(name, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result any
+	if err := parser.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnmarshalJsonPath stores the value at the path of the JSON field in the value pointed by v
+func (tr *TupleRecord) UnmarshalJsonPath(name, path string, v any) error {
+	raw, err := tr.getJsonPathRaw(name, path)
+	if err != nil {
+		return err
+	}
+
+	if err := parser.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("[%s] unmarshal json path %q failed, error:%v", name, path, err)
+	}
+	return nil
+}
+
+// SetJsonValue sets the JSON field by the json encoding of v, e.g. a map or a struct
+func (tr *TupleRecord) SetJsonValue(name string, v any) error {
+	idx := tr.RecordSchema.GetFieldIndex(name)
+	if idx < 0 {
+		return newFieldNotExistsError(fmt.Sprintf("field[%s] not exist", name))
+	}
+
+	if ft := tr.RecordSchema.Fields[idx].Type; ft != JSON {
+		return fmt.Errorf("[%s] field type %s is not JSON", name, ft)
+	}
+
+	if v == nil {
+		return tr.SetValueByIdx(idx, nil)
+	}
+
+	buf, err := parser.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("[%s] marshal json failed, error:%v", name, err)
+	}
+	return tr.SetValueByIdx(idx, Json(buf))
+}
@@ -0,0 +1,117 @@
+package datahub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJsonPath(t *testing.T) {
+	cases := map[string][]any{
+		"":            {},
+		"a":           {"a"},
+		"a.b[0]":      {"a", "b", 0},
+		"[1][2].c":    {1, 2, "c"},
+		"a[10].b_c":   {"a", 10, "b_c"},
+		"a.b.c[0][1]": {"a", "b", "c", 0, 1},
+	}
+	for path, expected := range cases {
+		result, err := parseJsonPath(path)
+		assert.Nil(t, err, path)
+		assert.Equal(t, expected, result, path)
+	}
+
+	for _, path := range []string{"a..b", "a[", "a[x]", "a[-1]", "a[0]b", ".a"} {
+		_, err := parseJsonPath(path)
+		assert.NotNil(t, err, path)
+	}
+}
+
+func TestGetJsonPath(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "js", Type: JSON, AllowNull: true})
+	schema.AddField(Field{Name: "str", Type: STRING, AllowNull: true})
+
+	record := NewTupleRecord(schema)
+	assert.Nil(t, record.SetValueByName("js", `{"a":{"b":[10,{"c":"x"}],"d":12345678901234567890},"e":null}`))
+
+	val, err := record.GetJsonPath("js", "a.b[0]")
+	assert.Nil(t, err)
+	assert.Equal(t, json.Number("10"), val)
+
+	val, err = record.GetJsonPath("js", "a.b[1].c")
+	assert.Nil(t, err)
+	assert.Equal(t, "x", val)
+
+	val, err = record.GetJsonPath("js", "a.d")
+	assert.Nil(t, err)
+	assert.Equal(t, json.Number("12345678901234567890"), val)
+
+	val, err = record.GetJsonPath("js", "a.b[1]")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"c": "x"}, val)
+
+	val, err = record.GetJsonPath("js", "e")
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+
+	var items []any
+	assert.Nil(t, record.UnmarshalJsonPath("js", "a.b", &items))
+	assert.Len(t, items, 2)
+
+	var c struct {
+		C string `json:"c"`
+	}
+	assert.Nil(t, record.UnmarshalJsonPath("js", "a.b[1]", &c))
+	assert.Equal(t, "x", c.C)
+
+	_, err = record.GetJsonPath("js", "a.b[2]")
+	assert.True(t, IsJsonPathNotFoundError(err))
+	_, err = record.GetJsonPath("js", "a.x")
+	assert.True(t, IsJsonPathNotFoundError(err))
+	_, err = record.GetJsonPath("str", "a")
+	assert.NotNil(t, err)
+	_, err = record.GetJsonPath("none", "a")
+	assert.True(t, IsFieldNotExistsError(err))
+
+	assert.Nil(t, record.SetValueByName("js", nil))
+	_, err = record.GetJsonPath("js", "a")
+	assert.True(t, IsJsonPathNotFoundError(err))
+}
+
+func TestSetJsonValue(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "js", Type: JSON, AllowNull: true})
+	schema.AddField(Field{Name: "str", Type: STRING, AllowNull: true})
+
+	record := NewTupleRecord(schema)
+	assert.Nil(t, record.SetJsonValue("js", struct {
+		Name string `json:"name"`
+		Tags []int  `json:"tags"`
+	}{Name: "n", Tags: []int{1, 2}}))
+	val, _ := record.GetValueByName("js")
+	assert.Equal(t, Json(`{"name":"n","tags":[1,2]}`), val)
+
+	assert.Nil(t, record.SetJsonValue("js", map[string]int{"a": 1}))
+	val, _ = record.GetValueByName("js")
+	assert.Equal(t, Json(`{"a":1}`), val)
+
+	assert.Nil(t, record.SetJsonValue("js", nil))
+	val, _ = record.GetValueByName("js")
+	assert.Nil(t, val)
+
+	assert.NotNil(t, record.SetJsonValue("str", map[string]int{"a": 1}))
+	assert.True(t, IsFieldNotExistsError(record.SetJsonValue("none", 1)))
+	assert.NotNil(t, record.SetJsonValue("js", make(chan int)))
+
+	// the json values are validated on set
+	assert.NotNil(t, record.SetValueByName("js", `{"a":`))
+	assert.NotNil(t, record.SetValueByName("js", []byte(`[1,`)))
+	assert.Nil(t, record.SetValueByName("js", []any{1, "x"}))
+	val, _ = record.GetValueByName("js")
+	assert.Equal(t, Json(`[1,"x"]`), val)
+	assert.Nil(t, record.SetValueByName("js", json.RawMessage(`{"b":true}`)))
+	val, _ = record.GetValueByName("js")
+	assert.Equal(t, Json(`{"b":true}`), val)
+}
@@ -0,0 +1,422 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	decimalType    = reflect.TypeOf(decimal.Decimal{})
+	dhDecimalType  = reflect.TypeOf(Decimal{})
+	bytesType      = reflect.TypeOf([]byte(nil))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// structField is a struct field mapped to a tuple field
+type structField struct {
+	name      string // the tuple field name, in lower case
+	goName    string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+	comment   string
+}
+
+// structPlan is the fields of a struct type, it is cached by type
+type structPlan struct {
+	fields []structField
+}
+
+var structPlanCache sync.Map // map[reflect.Type]*structPlan
+
+// getStructPlan parses the `datahub:"name,omitempty"` tags of the struct type.
+// A field without tag is mapped by its lower case name, "-" skips the field,
+// the fields of an embedded struct without tag are promoted. The `comment` tag is
+// the field comment used by SchemaFromStruct.
+func getStructPlan(t reflect.Type) (*structPlan, error) {
+	if plan, ok := structPlanCache.Load(t); ok {
+		return plan.(*structPlan), nil
+	}
+
+	plan := &structPlan{}
+	if err := plan.addFields(t, nil, make(map[string]string)); err != nil {
+		return nil, err
+	}
+
+	actual, _ := structPlanCache.LoadOrStore(t, plan)
+	return actual.(*structPlan), nil
+}
+
+func (sp *structPlan) addFields(t reflect.Type, index []int, names map[string]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("datahub")
+		if tag == "-" {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		if sf.Anonymous && !hasTag && sf.Type.Kind() == reflect.Struct && !isValueStruct(sf.Type) {
+			if err := sp.addFields(sf.Type, fieldIndex, names); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		if len(name) == 0 {
+			name = sf.Name
+		}
+		name = strings.ToLower(name)
+		if goName, exists := names[name]; exists {
+			return fmt.Errorf("struct %s: field %s and %s are both mapped to [%s]", t, goName, sf.Name, name)
+		}
+		names[name] = sf.Name
+
+		sp.fields = append(sp.fields, structField{
+			name:      name,
+			goName:    sf.Name,
+			index:     fieldIndex,
+			typ:       sf.Type,
+			omitEmpty: omitEmpty,
+			comment:   sf.Tag.Get("comment"),
+		})
+	}
+	return nil
+}
+
+// isValueStruct returns true if the struct type is mapped to a single value
+func isValueStruct(t reflect.Type) bool {
+	return t == timeType || t == decimalType || t == dhDecimalType
+}
+
+func getStructValue(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("struct pointer is nil")
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("value type[%T] is not struct", v)
+	}
+	return rv, nil
+}
+
+// Marshal converts the struct v to a tuple record of the schema by the `datahub` tags,
+// a nil pointer or an empty field with omitempty is null.
+// Every mapped struct field must exist in the schema.
+func Marshal(schema *RecordSchema, v any) (*TupleRecord, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+
+	rv, err := getStructValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := getStructPlan(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	record := NewTupleRecord(schema)
+	for _, sf := range plan.fields {
+		idx := schema.GetFieldIndex(sf.name)
+		if idx < 0 {
+			return nil, newFieldNotExistsError(fmt.Sprintf("struct field %s: field[%s] not exist", sf.goName, sf.name))
+		}
+
+		fv := rv.FieldByIndex(sf.index)
+		if sf.omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		field := schema.Fields[idx]
+		val, err := toFieldValue(field.Type, fv)
+		if err != nil {
+			return nil, fmt.Errorf("struct field %s to [%s]: %v", sf.goName, field.Name, err)
+		}
+
+		if val == nil {
+			if !field.AllowNull {
+				return nil, fmt.Errorf("struct field %s to [%s]: not allow null", sf.goName, field.Name)
+			}
+			continue
+		}
+
+		if err = record.SetValueByIdx(idx, val); err != nil {
+			return nil, fmt.Errorf("struct field %s to [%s]: %v", sf.goName, field.Name, err)
+		}
+	}
+	return record, nil
+}
+
+// toFieldValue returns a value accepted by validateFieldValue, or nil for null
+func toFieldValue(ft FieldType, fv reflect.Value) (any, error) {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		fv = fv.Elem()
+	}
+
+	if ft == JSON {
+		return toJsonValue(fv)
+	}
+
+	switch fv.Type() {
+	case timeType:
+		if ft != TIMESTAMP {
+			return nil, fmt.Errorf("value type[%s] not match field type[%s]", fv.Type(), ft)
+		}
+		return fv.Interface().(time.Time).UnixMicro(), nil
+	case decimalType:
+		return fv.Interface(), nil
+	case dhDecimalType:
+		return decimal.Decimal(fv.Interface().(Decimal)), nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fv.Uint(), nil
+	case reflect.Float32:
+		if ft == DOUBLE {
+			return fv.Float(), nil
+		}
+		return float32(fv.Float()), nil
+	case reflect.Float64:
+		if ft == FLOAT {
+			return nil, fmt.Errorf("value type[%s] not match field type[FLOAT]", fv.Type())
+		}
+		return fv.Float(), nil
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return fv.Bool(), nil
+	default:
+		return nil, fmt.Errorf("value type[%s] not match field type[%s]", fv.Type(), ft)
+	}
+}
+
+func toJsonValue(fv reflect.Value) (any, error) {
+	switch {
+	case fv.Kind() == reflect.String:
+		return fv.String(), nil
+	case fv.Type() == bytesType || fv.Type() == rawMessageType:
+		return string(fv.Bytes()), nil
+	}
+
+	buf, err := parser.Marshal(fv.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+// Unmarshal fills the struct pointed by v with the values of the record by the `datahub` tags,
+// a null value sets the zero value. The struct fields not in the record schema are not changed,
+// so a struct can read the records of the older schema versions.
+func Unmarshal(record *TupleRecord, v any) error {
+	if record == nil || record.RecordSchema == nil {
+		return fmt.Errorf("record or record schema is nil")
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("value type[%T] is not a non-nil struct pointer", v)
+	}
+
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("value type[%T] is not a non-nil struct pointer", v)
+	}
+
+	plan, err := getStructPlan(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, sf := range plan.fields {
+		idx := record.RecordSchema.GetFieldIndex(sf.name)
+		if idx < 0 {
+			continue
+		}
+
+		var val DataType
+		if idx < len(record.Values) {
+			val = record.Values[idx]
+		}
+
+		if err := fromFieldValue(val, rv.FieldByIndex(sf.index)); err != nil {
+			return fmt.Errorf("[%s] to struct field %s: %v", record.RecordSchema.Fields[idx].Name, sf.goName, err)
+		}
+	}
+	return nil
+}
+
+func fromFieldValue(val DataType, fv reflect.Value) error {
+	if val == nil {
+		fv.SetZero()
+		return nil
+	}
+
+	if fv.Kind() == reflect.Pointer {
+		elem := reflect.New(fv.Type().Elem())
+		if err := fromFieldValue(val, elem.Elem()); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	}
+
+	if js, ok := val.(Json); ok {
+		return fromJsonValue(js, fv)
+	}
+
+	if fv.Kind() == reflect.Interface {
+		rv := reflect.ValueOf(val)
+		if !rv.Type().AssignableTo(fv.Type()) {
+			return fmt.Errorf("value type[%T] not match struct field type[%s]", val, fv.Type())
+		}
+		fv.Set(rv)
+		return nil
+	}
+
+	switch v := val.(type) {
+	case Bigint:
+		return setIntValue(int64(v), fv, val)
+	case Integer:
+		return setIntValue(int64(v), fv, val)
+	case Smallint:
+		return setIntValue(int64(v), fv, val)
+	case Tinyint:
+		return setIntValue(int64(v), fv, val)
+	case Timestamp:
+		if fv.Type() == timeType {
+			fv.Set(reflect.ValueOf(time.UnixMicro(int64(v))))
+			return nil
+		}
+		if uint64(v) > math.MaxInt64 {
+			return fmt.Errorf("value %d overflow struct field type[%s]", v, fv.Type())
+		}
+		return setIntValue(int64(v), fv, val)
+	case String:
+		if fv.Kind() != reflect.String {
+			return fmt.Errorf("value type[%T] not match struct field type[%s]", val, fv.Type())
+		}
+		fv.SetString(string(v))
+	case Boolean:
+		if fv.Kind() != reflect.Bool {
+			return fmt.Errorf("value type[%T] not match struct field type[%s]", val, fv.Type())
+		}
+		fv.SetBool(bool(v))
+	case Double:
+		return setFloatValue(float64(v), fv, val)
+	case Float:
+		return setFloatValue(float64(v), fv, val)
+	case Decimal:
+		switch {
+		case fv.Type() == decimalType:
+			fv.Set(reflect.ValueOf(decimal.Decimal(v)))
+		case fv.Type() == dhDecimalType:
+			fv.Set(reflect.ValueOf(v))
+		case fv.Kind() == reflect.String:
+			fv.SetString(v.String())
+		case fv.CanInt() || fv.CanUint():
+			return setDecimalIntValue(decimal.Decimal(v), fv)
+		default:
+			return fmt.Errorf("value type[%T] not match struct field type[%s]", val, fv.Type())
+		}
+	default:
+		return fmt.Errorf("value type[%T] not supported", val)
+	}
+	return nil
+}
+
+func setIntValue(val int64, fv reflect.Value, ori DataType) error {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.OverflowInt(val) {
+			return fmt.Errorf("value %d overflow struct field type[%s]", val, fv.Type())
+		}
+		fv.SetInt(val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if val < 0 || fv.OverflowUint(uint64(val)) {
+			return fmt.Errorf("value %d overflow struct field type[%s]", val, fv.Type())
+		}
+		fv.SetUint(uint64(val))
+	default:
+		return fmt.Errorf("value type[%T] not match struct field type[%s]", ori, fv.Type())
+	}
+	return nil
+}
+
+// setDecimalIntValue sets an integral decimal to an integer field, used by the uint64 fields
+func setDecimalIntValue(val decimal.Decimal, fv reflect.Value) error {
+	if !val.IsInteger() {
+		return fmt.Errorf("value %s is not integer for struct field type[%s]", val, fv.Type())
+	}
+
+	bi := val.BigInt()
+	switch {
+	case fv.CanInt() && bi.IsInt64() && !fv.OverflowInt(bi.Int64()):
+		fv.SetInt(bi.Int64())
+	case fv.CanUint() && bi.IsUint64() && !fv.OverflowUint(bi.Uint64()):
+		fv.SetUint(bi.Uint64())
+	default:
+		return fmt.Errorf("value %s overflow struct field type[%s]", val, fv.Type())
+	}
+	return nil
+}
+
+func setFloatValue(val float64, fv reflect.Value, ori DataType) error {
+	switch fv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if fv.OverflowFloat(val) {
+			return fmt.Errorf("value %v overflow struct field type[%s]", val, fv.Type())
+		}
+		fv.SetFloat(val)
+	default:
+		return fmt.Errorf("value type[%T] not match struct field type[%s]", ori, fv.Type())
+	}
+	return nil
+}
+
+func fromJsonValue(js Json, fv reflect.Value) error {
+	switch {
+	case fv.Kind() == reflect.String:
+		fv.SetString(string(js))
+		return nil
+	case fv.Type() == bytesType || fv.Type() == rawMessageType:
+		fv.SetBytes([]byte(js))
+		return nil
+	}
+	return parser.Unmarshal([]byte(js), fv.Addr().Interface())
+}
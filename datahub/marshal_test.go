@@ -0,0 +1,177 @@
+package datahub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type marshalBase struct {
+	Id int64 `datahub:"id"`
+}
+
+type marshalEvent struct {
+	marshalBase
+	Name     string            `datahub:"name"`
+	Age      *int32            `datahub:"age"`
+	Score    float64           `datahub:"score"`
+	Ratio    float32           `datahub:"ratio"`
+	Level    int8              `datahub:"level"`
+	Count    uint16            `datahub:"count"`
+	Valid    bool              `datahub:"valid"`
+	Time     time.Time         `datahub:"time,omitempty"`
+	Amount   decimal.Decimal   `datahub:"amount"`
+	Extra    map[string]string `datahub:"extra,omitempty"`
+	Ignored  string            `datahub:"-"`
+	internal string
+}
+
+func genMarshalSchema() *RecordSchema {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "id", Type: BIGINT})
+	schema.AddField(Field{Name: "name", Type: STRING, AllowNull: true})
+	schema.AddField(Field{Name: "age", Type: INTEGER, AllowNull: true})
+	schema.AddField(Field{Name: "score", Type: DOUBLE, AllowNull: true})
+	schema.AddField(Field{Name: "ratio", Type: FLOAT, AllowNull: true})
+	schema.AddField(Field{Name: "level", Type: TINYINT, AllowNull: true})
+	schema.AddField(Field{Name: "count", Type: SMALLINT, AllowNull: true})
+	schema.AddField(Field{Name: "valid", Type: BOOLEAN, AllowNull: true})
+	schema.AddField(Field{Name: "time", Type: TIMESTAMP, AllowNull: true})
+	schema.AddField(Field{Name: "amount", Type: DECIMAL, AllowNull: true})
+	schema.AddField(Field{Name: "extra", Type: JSON, AllowNull: true})
+	return schema
+}
+
+func TestMarshalAndUnmarshal(t *testing.T) {
+	schema := genMarshalSchema()
+	age := int32(18)
+	event := marshalEvent{
+		marshalBase: marshalBase{Id: 1},
+		Name:        "test",
+		Age:         &age,
+		Score:       1.5,
+		Ratio:       0.5,
+		Level:       -1,
+		Count:       100,
+		Valid:       true,
+		Time:        time.UnixMicro(1700000000000000),
+		Amount:      decimal.RequireFromString("12.34"),
+		Extra:       map[string]string{"k": "v"},
+		Ignored:     "ignored",
+	}
+
+	record, err := Marshal(schema, &event)
+	assert.Nil(t, err)
+	assert.Equal(t, Bigint(1), record.Values[0])
+	assert.Equal(t, String("test"), record.Values[1])
+	assert.Equal(t, Integer(18), record.Values[2])
+	assert.Equal(t, Float(0.5), record.Values[4])
+	assert.Equal(t, Timestamp(1700000000000000), record.Values[8])
+	assert.Equal(t, Json(`{"k":"v"}`), record.Values[10])
+
+	var result marshalEvent
+	assert.Nil(t, Unmarshal(record, &result))
+	assert.Equal(t, int64(1), result.Id)
+	assert.Equal(t, "test", result.Name)
+	assert.Equal(t, int32(18), *result.Age)
+	assert.Equal(t, 1.5, result.Score)
+	assert.Equal(t, float32(0.5), result.Ratio)
+	assert.Equal(t, int8(-1), result.Level)
+	assert.Equal(t, uint16(100), result.Count)
+	assert.True(t, result.Valid)
+	assert.True(t, event.Time.Equal(result.Time))
+	assert.True(t, event.Amount.Equal(result.Amount))
+	assert.Equal(t, "v", result.Extra["k"])
+	assert.Equal(t, "", result.Ignored)
+}
+
+func TestMarshalNull(t *testing.T) {
+	schema := genMarshalSchema()
+	record, err := Marshal(schema, marshalEvent{marshalBase: marshalBase{Id: 2}})
+	assert.Nil(t, err)
+	assert.Nil(t, record.Values[2])
+	assert.Nil(t, record.Values[10])
+
+	result := marshalEvent{Age: new(int32), Extra: map[string]string{"a": "b"}}
+	assert.Nil(t, Unmarshal(record, &result))
+	assert.Nil(t, result.Age)
+	assert.Nil(t, result.Extra)
+}
+
+func TestMarshalMismatch(t *testing.T) {
+	schema := genMarshalSchema()
+
+	_, err := Marshal(schema, struct {
+		Id      int64 `datahub:"id"`
+		Unknown string
+	}{})
+	assert.True(t, IsFieldNotExistsError(err))
+
+	_, err = Marshal(schema, struct {
+		Name int64 `datahub:"name"`
+	}{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "struct field Name to [name]")
+
+	_, err = Marshal(schema, struct {
+		Level int `datahub:"level"`
+	}{Level: 1000})
+	assert.NotNil(t, err)
+
+	_, err = Marshal(schema, struct {
+		A string `datahub:"name"`
+		B string `datahub:"name"`
+	}{})
+	assert.NotNil(t, err)
+
+	_, err = Marshal(schema, 1)
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalMismatch(t *testing.T) {
+	schema := genMarshalSchema()
+	record := NewTupleRecord(schema)
+	assert.Nil(t, record.SetValueByName("id", 1000))
+	assert.Nil(t, record.SetValueByName("name", "test"))
+
+	var overflow struct {
+		Id int8 `datahub:"id"`
+	}
+	err := Unmarshal(record, &overflow)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "[id] to struct field Id")
+
+	var wrongType struct {
+		Name int `datahub:"name"`
+	}
+	assert.NotNil(t, Unmarshal(record, &wrongType))
+
+	var notPointer marshalEvent
+	assert.NotNil(t, Unmarshal(record, notPointer))
+
+	var notInSchema struct {
+		Id    int64  `datahub:"id"`
+		Other string `datahub:"other"`
+	}
+	notInSchema.Other = "keep"
+	assert.Nil(t, Unmarshal(record, &notInSchema))
+	assert.Equal(t, int64(1000), notInSchema.Id)
+	assert.Equal(t, "keep", notInSchema.Other)
+}
+
+func TestUnmarshalJsonNumber(t *testing.T) {
+	schema := genMarshalSchema()
+	record := NewTupleRecord(schema)
+	assert.Nil(t, record.SetValueByName("id", 1))
+	assert.Nil(t, record.SetValueByName("extra", `{"big":12345678901234567890}`))
+
+	// the json fields are parsed like GetJsonPath, the numbers keep their precision
+	var result struct {
+		Extra map[string]any `datahub:"extra"`
+	}
+	assert.Nil(t, Unmarshal(record, &result))
+	assert.Equal(t, json.Number("12345678901234567890"), result.Extra["big"])
+}
@@ -0,0 +1,391 @@
+package datahub
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TopicRecord is the input of MultiTopicProducer, Record is written to Project/Topic
+type TopicRecord struct {
+	Project string
+	Topic   string
+	Record  IRecord
+}
+
+type MultiTopicProducerConfig struct {
+	ProducerConfig       // Project and Topic are ignored
+	MaxBufferBytes int64 // max size of records buffered or in flight of all topics, <= 0 means unlimited, default 256MB
+}
+
+func NewMultiTopicProducerConfig() *MultiTopicProducerConfig {
+	return &MultiTopicProducerConfig{
+		ProducerConfig: *NewProducerConfig(),
+		MaxBufferBytes: 256 * 1024 * 1024,
+	}
+}
+
+// MultiTopicProducer writes records to multiple topics. The shard metadata and schema
+// are kept per topic, while the http connection pool and the buffer memory limit are
+// shared by all topics. The topic is initialized when its first record arrives, the
+// records of a topic are dispatched by its own goroutine so that a slow init does not
+// block the other topics. The buffer memory is acquired when a record is read from Input.
+type MultiTopicProducer interface {
+	Init() error
+
+	// Input is the input channel for the user to write record
+	Input() chan<- *TopicRecord
+
+	// Successes is the successful request output channel of all topics, see AsyncProducer.Successes
+	Successes() <-chan *ProduceSuccess
+
+	// Errors is the error output channel of all topics, see AsyncProducer.Errors.
+	// The records of a topic which failed to initialize are also returned here, the init
+	// is retried by the next record after a backoff from 1s doubling up to 1min.
+	Errors() <-chan *ProduceError
+
+	// GetSchema return the schema for the specified topic, the topic is initialized if needed
+	GetSchema(project, topic string) (*RecordSchema, error)
+
+	// Close all topics, it will write all buffer to server before closed
+	Close() error
+}
+
+// producerShared holds the resources shared by the topics of a MultiTopicProducer
+type producerShared struct {
+	httpClient    *http.Client
+	budget        *bufferBudget
+	success       chan *ProduceSuccess
+	errors        chan *ProduceError
+	updateShardCh chan bool
+}
+
+const (
+	// a topic failed to initialize is retried after the backoff, which doubles on every failure
+	topicInitBackoff    = time.Second
+	topicInitMaxBackoff = time.Minute
+
+	// the shared task checks the shard refresh time of the topics every tick
+	multiTopicRefreshTick = 10 * time.Second
+)
+
+// topicProducer is the producer of a topic, ready is closed when the init is done
+type topicProducer struct {
+	ready     chan struct{}
+	ap        *asyncProducerImpl
+	err       error
+	failures  int
+	retryTime time.Time
+}
+
+func newReadyTopicProducer(ap *asyncProducerImpl) *topicProducer {
+	tp := &topicProducer{ready: make(chan struct{}), ap: ap}
+	close(tp.ready)
+	return tp
+}
+
+// retryable returns true if the init failed and the backoff has passed
+func (tp *topicProducer) retryable(now time.Time) bool {
+	select {
+	case <-tp.ready:
+		return tp.err != nil && now.After(tp.retryTime)
+	default:
+		return false
+	}
+}
+
+type multiTopicProducerImpl struct {
+	config    *MultiTopicProducerConfig
+	shared    *producerShared
+	input     chan *TopicRecord
+	mutex     sync.Mutex
+	producers map[string]*topicProducer
+	wg        sync.WaitGroup
+	refreshWg sync.WaitGroup
+}
+
+func NewMultiTopicProducer(cfg *MultiTopicProducerConfig) MultiTopicProducer {
+	return &multiTopicProducerImpl{
+		config: cfg,
+		shared: &producerShared{
+			httpClient:    DefaultHttpClient(),
+			budget:        newBufferBudget(cfg.MaxBufferBytes),
+			success:       make(chan *ProduceSuccess, 64),
+			errors:        make(chan *ProduceError, 64),
+			updateShardCh: make(chan bool, 8),
+		},
+		input:     make(chan *TopicRecord, cfg.MaxAsyncBufferNum*2),
+		producers: make(map[string]*topicProducer),
+	}
+}
+
+func (mp *multiTopicProducerImpl) Init() error {
+	mp.refreshWg.Add(1)
+	go withRecover("multi-topic-update-shard-task", mp.updateShardRun)
+	mp.wg.Add(1)
+	go mp.dispatch()
+	return nil
+}
+
+func (mp *multiTopicProducerImpl) Input() chan<- *TopicRecord {
+	return mp.input
+}
+
+func (mp *multiTopicProducerImpl) Successes() <-chan *ProduceSuccess {
+	return mp.shared.success
+}
+
+func (mp *multiTopicProducerImpl) Errors() <-chan *ProduceError {
+	return mp.shared.errors
+}
+
+func (mp *multiTopicProducerImpl) GetSchema(project, topic string) (*RecordSchema, error) {
+	ap, err := mp.getProducer(project, topic)
+	if err != nil {
+		return nil, err
+	}
+	return ap.GetSchema()
+}
+
+func (mp *multiTopicProducerImpl) Close() error {
+	start := time.Now()
+	close(mp.input)
+	mp.wg.Wait()
+
+	// the shard refresh task is still running while the topics are closing
+	producers := mp.listProducers()
+	for _, ap := range producers {
+		ap.Close()
+	}
+
+	close(mp.shared.updateShardCh)
+	mp.refreshWg.Wait()
+	close(mp.shared.errors)
+	close(mp.shared.success)
+	log.Infof("multi topic producer closed, topic num:%d, cost: %v", len(producers), time.Since(start))
+	return nil
+}
+
+// getProducer returns the producer of the topic, it is created and initialized on first use.
+// The init runs outside mutex and only once at a time per topic, the error of a failed init is
+// returned without a new attempt until the backoff has passed.
+func (mp *multiTopicProducerImpl) getProducer(project, topic string) (*asyncProducerImpl, error) {
+	key := project + "/" + topic
+
+	mp.mutex.Lock()
+	tp, ok := mp.producers[key]
+	if ok && !tp.retryable(time.Now()) {
+		mp.mutex.Unlock()
+		<-tp.ready
+		return tp.ap, tp.err
+	}
+
+	failures := 0
+	if ok {
+		failures = tp.failures
+	}
+	tp = &topicProducer{ready: make(chan struct{}), failures: failures}
+	mp.producers[key] = tp
+	mp.mutex.Unlock()
+
+	mp.initProducer(key, project, topic, tp)
+	return tp.ap, tp.err
+}
+
+func (mp *multiTopicProducerImpl) initProducer(key, project, topic string, tp *topicProducer) {
+	defer close(tp.ready)
+
+	cfg := mp.config.ProducerConfig
+	cfg.Project = project
+	cfg.Topic = topic
+
+	ap := newAsyncProducer(&cfg, mp.shared)
+	if err := ap.Init(); err != nil {
+		backoff := min(topicInitBackoff<<min(tp.failures, 16), topicInitMaxBackoff)
+		tp.failures++
+		tp.err = err
+		tp.retryTime = time.Now().Add(backoff)
+		log.Errorf("%s init producer failed, retry after %v, error:%v", key, backoff, err)
+		return
+	}
+
+	tp.ap = ap
+	log.Infof("%s producer created", key)
+}
+
+// dispatch acquires the buffer memory of the records and hands them to the goroutine of their topic
+func (mp *multiTopicProducerImpl) dispatch() {
+	defer mp.wg.Done()
+
+	topicInputs := make(map[string]chan IRecord)
+	for tr := range mp.input {
+		if tr == nil || tr.Record == nil {
+			continue
+		}
+
+		mp.shared.budget.acquire(int64(tr.Record.GetSize()))
+		key := tr.Project + "/" + tr.Topic
+		topicInput, ok := topicInputs[key]
+		if !ok {
+			topicInput = make(chan IRecord, mp.config.MaxAsyncBufferNum)
+			topicInputs[key] = topicInput
+			mp.wg.Add(1)
+			go withRecover(key+"-dispatch-task", func() {
+				mp.dispatchTopic(tr.Project, tr.Topic, topicInput)
+			})
+		}
+		topicInput <- tr.Record
+	}
+
+	for _, topicInput := range topicInputs {
+		close(topicInput)
+	}
+}
+
+// dispatchTopic initializes the producer of the topic and writes the records to it
+func (mp *multiTopicProducerImpl) dispatchTopic(project, topic string, topicInput <-chan IRecord) {
+	defer mp.wg.Done()
+
+	for record := range topicInput {
+		ap, err := mp.getProducer(project, topic)
+		if err != nil {
+			mp.shared.budget.release(int64(record.GetSize()))
+			if mp.config.EnableErrorCh {
+				mp.shared.errors <- newProduceError(project, topic, "", []IRecord{record}, time.Duration(0), err)
+			}
+			continue
+		}
+		ap.input <- record
+	}
+}
+
+// updateShardRun refreshes the shards of every topic by its own refresh interval, and
+// the topics with sealed shards when a writer found its shard sealed
+func (mp *multiTopicProducerImpl) updateShardRun() {
+	defer mp.refreshWg.Done()
+	log.Infof("multi topic update shard task started")
+	ticker := time.NewTicker(multiTopicRefreshTick)
+	defer ticker.Stop()
+
+	nextFreshTimes := make(map[*asyncProducerImpl]time.Time)
+	for {
+		select {
+		case <-ticker.C:
+			mp.freshShardOnTime(nextFreshTimes, time.Now())
+		case _, ok := <-mp.shared.updateShardCh:
+			if !ok {
+				log.Infof("multi topic update shard task stopped")
+				return
+			}
+
+			for _, ap := range mp.listProducers() {
+				if ap.hasSealedShard() {
+					ap.freshShard()
+				}
+			}
+		}
+	}
+}
+
+// freshShardOnTime refreshes the topics whose next refresh time has passed, the first
+// refresh time of a topic is randomized like AsyncProducer does
+func (mp *multiTopicProducerImpl) freshShardOnTime(nextFreshTimes map[*asyncProducerImpl]time.Time, now time.Time) {
+	for _, ap := range mp.listProducers() {
+		next, ok := nextFreshTimes[ap]
+		if !ok {
+			rm := rand.IntN(int(ap.freshShardInterval.Milliseconds()))
+			nextFreshTimes[ap] = now.Add(ap.freshShardInterval).Add(time.Duration(rm) * time.Millisecond)
+			continue
+		}
+
+		if now.Before(next) {
+			continue
+		}
+
+		if err := ap.freshShard(); err == nil {
+			nextFreshTimes[ap] = now.Add(ap.freshShardInterval)
+		} else {
+			nextFreshTimes[ap] = now.Add(time.Second * 30)
+		}
+	}
+}
+
+// listProducers returns the initialized producers
+func (mp *multiTopicProducerImpl) listProducers() []*asyncProducerImpl {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	producers := make([]*asyncProducerImpl, 0, len(mp.producers))
+	for _, tp := range mp.producers {
+		select {
+		case <-tp.ready:
+			if tp.ap != nil {
+				producers = append(producers, tp.ap)
+			}
+		default:
+		}
+	}
+	return producers
+}
+
+// bufferBudget limits the total size of records buffered or in flight
+type bufferBudget struct {
+	limit int64
+	used  int64
+	mutex sync.Mutex
+	cond  *sync.Cond
+}
+
+func newBufferBudget(limit int64) *bufferBudget {
+	bb := &bufferBudget{limit: limit}
+	bb.cond = sync.NewCond(&bb.mutex)
+	return bb
+}
+
+// acquire blocks until there is enough budget, a record larger than
+// the limit is admitted when nothing else is buffered
+func (bb *bufferBudget) acquire(size int64) {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+
+	for bb.limit > 0 && bb.used > 0 && bb.used+size > bb.limit {
+		bb.cond.Wait()
+	}
+	bb.used += size
+}
+
+// adjust changes the used size without blocking, e.g. the record is modified by interceptors
+func (bb *bufferBudget) adjust(delta int64) {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+
+	bb.used += delta
+	if delta < 0 {
+		bb.cond.Broadcast()
+	}
+}
+
+func (bb *bufferBudget) release(size int64) {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+
+	bb.used -= size
+	bb.cond.Broadcast()
+}
+
+func (bb *bufferBudget) usedBytes() int64 {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+	return bb.used
+}
+
+func batchSize(records []IRecord) int64 {
+	var size int64
+	for _, record := range records {
+		size += int64(record.GetSize())
+	}
+	return size
+}
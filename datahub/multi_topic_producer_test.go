@@ -0,0 +1,217 @@
+package datahub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferBudget(t *testing.T) {
+	budget := newBufferBudget(10)
+	budget.acquire(8)
+
+	done := make(chan bool)
+	go func() {
+		budget.acquire(5)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+		assert.Fail(t, "acquire should block when the budget is exhausted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	budget.release(8)
+	<-done
+	assert.Equal(t, int64(5), budget.usedBytes())
+
+	// a record larger than the limit is admitted when nothing is buffered
+	budget.release(5)
+	budget.acquire(100)
+	assert.Equal(t, int64(100), budget.usedBytes())
+}
+
+func TestMultiTopicProducerSharedChannels(t *testing.T) {
+	cfg := NewMultiTopicProducerConfig()
+	cfg.MaxAsyncBufferTime = 10 * time.Millisecond
+	mp := NewMultiTopicProducer(cfg).(*multiTopicProducerImpl)
+
+	for _, topic := range []string{"topic1", "topic2"} {
+		pcfg := cfg.ProducerConfig
+		pcfg.Project = "test_project"
+		pcfg.Topic = topic
+		ap := newAsyncProducer(&pcfg, mp.shared)
+		ap.client = &producerMockClient{shards: []ShardEntry{{ShardId: "0", State: ACTIVE}}}
+		ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+		assert.Nil(t, ap.freshShard())
+		ap.wg.Add(2)
+		go ap.dispatch()
+		go ap.dispatchBatch()
+		mp.producers["test_project/"+topic] = newReadyTopicProducer(ap)
+	}
+	mp.refreshWg.Add(1)
+	go mp.updateShardRun()
+	mp.wg.Add(1)
+	go mp.dispatch()
+
+	mp.Input() <- &TopicRecord{Project: "test_project", Topic: "topic1", Record: NewBlobRecord([]byte("test1"))}
+	mp.Input() <- &TopicRecord{Project: "test_project", Topic: "topic2", Record: NewBlobRecord([]byte("test2"))}
+
+	topics := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		suc := <-mp.Successes()
+		assert.Equal(t, "test_project", suc.Project)
+		topics[suc.Topic] = true
+	}
+	assert.Equal(t, map[string]bool{"topic1": true, "topic2": true}, topics)
+
+	assert.Nil(t, mp.Close())
+	assert.Equal(t, int64(0), mp.shared.budget.usedBytes())
+	_, ok := <-mp.Errors()
+	assert.False(t, ok)
+}
+
+func TestMultiTopicProducerDispatchPerTopic(t *testing.T) {
+	cfg := NewMultiTopicProducerConfig()
+	cfg.MaxAsyncBufferTime = 10 * time.Millisecond
+	mp := NewMultiTopicProducer(cfg).(*multiTopicProducerImpl)
+
+	pcfg := cfg.ProducerConfig
+	pcfg.Project = "test_project"
+	pcfg.Topic = "topic1"
+	ap := newAsyncProducer(&pcfg, mp.shared)
+	ap.client = &producerMockClient{shards: []ShardEntry{{ShardId: "0", State: ACTIVE}}}
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	assert.Nil(t, ap.freshShard())
+	ap.wg.Add(2)
+	go ap.dispatch()
+	go ap.dispatchBatch()
+	mp.producers["test_project/topic1"] = newReadyTopicProducer(ap)
+
+	// the init of slow_topic is in progress
+	slow := &topicProducer{ready: make(chan struct{})}
+	mp.producers["test_project/slow_topic"] = slow
+	mp.refreshWg.Add(1)
+	go mp.updateShardRun()
+	mp.wg.Add(1)
+	go mp.dispatch()
+
+	slowRecord := NewBlobRecord([]byte("slow"))
+	mp.Input() <- &TopicRecord{Project: "test_project", Topic: "slow_topic", Record: slowRecord}
+	mp.Input() <- &TopicRecord{Project: "test_project", Topic: "topic1", Record: NewBlobRecord([]byte("test1"))}
+
+	suc := <-mp.Successes()
+	assert.Equal(t, "topic1", suc.Topic)
+
+	// the budget of the record waiting for the init is acquired when accepted
+	assert.Eventually(t, func() bool {
+		return mp.shared.budget.usedBytes() == int64(slowRecord.GetSize())
+	}, time.Second, time.Millisecond)
+
+	slow.err = fmt.Errorf("init failed")
+	slow.retryTime = time.Now().Add(time.Hour)
+	close(slow.ready)
+	perr := <-mp.Errors()
+	assert.Equal(t, "slow_topic", perr.Topic)
+	assert.Equal(t, slow.err, perr.Err)
+
+	assert.Nil(t, mp.Close())
+	assert.Equal(t, int64(0), mp.shared.budget.usedBytes())
+}
+
+func TestMultiTopicProducerInitBackoff(t *testing.T) {
+	var hits atomic.Int32
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if strings.Contains(request.URL.Path, "slow_topic") {
+			<-block
+		}
+		hits.Add(1)
+		writer.Header().Set("x-datahub-request-id", "request_id")
+		writer.WriteHeader(http.StatusNotFound)
+		_, _ = writer.Write([]byte(`{"ErrorCode":"NoSuchTopic","ErrorMessage":"The specified topic name does not exist."}`))
+	}))
+	defer ts.Close()
+
+	cfg := NewMultiTopicProducerConfig()
+	cfg.Endpoint = ts.URL
+	cfg.Account = NewAliyunAccount("a", "a")
+	cfg.MaxRetry = 0
+	mp := NewMultiTopicProducer(cfg).(*multiTopicProducerImpl)
+
+	_, err := mp.getProducer("test_project", "test_topic")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), hits.Load())
+
+	// the failure is cached until the backoff has passed
+	_, err2 := mp.getProducer("test_project", "test_topic")
+	assert.Equal(t, err, err2)
+	assert.Equal(t, int32(1), hits.Load())
+
+	tp := mp.producers["test_project/test_topic"]
+	assert.Equal(t, 1, tp.failures)
+	tp.retryTime = time.Now().Add(-time.Millisecond)
+	_, err = mp.getProducer("test_project", "test_topic")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), hits.Load())
+	tp = mp.producers["test_project/test_topic"]
+	assert.Equal(t, 2, tp.failures)
+	assert.True(t, tp.retryTime.After(time.Now().Add(topicInitBackoff)))
+
+	// the init of a topic does not block the other topics
+	ready := newAsyncProducer(&cfg.ProducerConfig, mp.shared)
+	mp.producers["test_project/ready_topic"] = newReadyTopicProducer(ready)
+	go mp.getProducer("test_project", "slow_topic")
+	assert.Eventually(t, func() bool {
+		mp.mutex.Lock()
+		defer mp.mutex.Unlock()
+		_, ok := mp.producers["test_project/slow_topic"]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	ap, err := mp.getProducer("test_project", "ready_topic")
+	assert.Nil(t, err)
+	assert.Equal(t, ready, ap)
+	assert.Equal(t, []*asyncProducerImpl{ready}, mp.listProducers())
+	close(block)
+}
+
+func TestMultiTopicProducerFreshShardOnTime(t *testing.T) {
+	mp := NewMultiTopicProducer(NewMultiTopicProducerConfig()).(*multiTopicProducerImpl)
+	client := &producerMockClient{shards: []ShardEntry{{ShardId: "0", State: ACTIVE}}}
+	ap := newAsyncProducer(&mp.config.ProducerConfig, mp.shared)
+	ap.client = client
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	ap.freshShardInterval = time.Minute
+	assert.Nil(t, ap.freshShard())
+	mp.producers["test_project/test_topic"] = newReadyTopicProducer(ap)
+
+	now := time.Now()
+	nextFreshTimes := make(map[*asyncProducerImpl]time.Time)
+	mp.freshShardOnTime(nextFreshTimes, now)
+	assert.True(t, !nextFreshTimes[ap].Before(now.Add(time.Minute)))
+	assert.True(t, nextFreshTimes[ap].Before(now.Add(2*time.Minute)))
+
+	client.mu.Lock()
+	client.shards = append(client.shards, ShardEntry{ShardId: "1", State: ACTIVE})
+	client.mu.Unlock()
+
+	// not due yet
+	mp.freshShardOnTime(nextFreshTimes, now.Add(30*time.Second))
+	assert.Equal(t, 1, len(ap.shards))
+
+	mp.freshShardOnTime(nextFreshTimes, now.Add(2*time.Minute))
+	assert.Equal(t, 2, len(ap.shards))
+	assert.Equal(t, now.Add(3*time.Minute), nextFreshTimes[ap])
+
+	for _, writer := range ap.writers {
+		writer.close()
+	}
+}
@@ -16,6 +16,10 @@ type recordKeyImpl struct {
 	batchIndex uint32
 	timestamp  int64
 	acked      atomic.Bool
+
+	// set if the record is written by an idempotent producer and dedup is enabled
+	producerId  string
+	producerSeq int64
 }
 
 func (rk *recordKeyImpl) Ack() {
@@ -39,6 +43,8 @@ type shardOffsetInfo struct {
 	mu           sync.Mutex
 	offset       SubscriptionOffset
 	pendingQueue []*recordKeyImpl
+	dedup        *dedupWindow // sequences of the records read
+	committed    *dedupWindow // sequences of the records committed, it is what persisted
 	lastCommit   struct {
 		sequence   int64
 		batchIndex uint32
@@ -52,6 +58,8 @@ type offsetManager struct {
 	subId          string
 	client         DataHubApi
 	commitInterval time.Duration
+	dedupWindow    int64 // <= 0 means dedup disabled
+	dedupStore     *dedupStore
 
 	mu         sync.RWMutex
 	shardInfos map[string]*shardOffsetInfo
@@ -75,6 +83,13 @@ func newOffsetManager(project, topic, subId string, client DataHubApi,
 	}
 }
 
+// setDedup enables dropping the replays of idempotent producers, the state is
+// persisted after every commit if store is not nil
+func (om *offsetManager) setDedup(window int64, store *dedupStore) {
+	om.dedupWindow = window
+	om.dedupStore = store
+}
+
 func (om *offsetManager) start() {
 	om.wg.Add(1)
 	go om.run()
@@ -134,6 +149,7 @@ func (om *offsetManager) addShards(shardIds []string) map[string]SubscriptionOff
 		om.shardInfos[shardId].lastCommit.sequence = offset.Sequence
 		om.shardInfos[shardId].lastCommit.batchIndex = offset.BatchIndex
 		om.shardInfos[shardId].lastCommit.timestamp = offset.Timestamp
+		om.loadDedup(shardId, om.shardInfos[shardId])
 
 		log.Infof("%s/%s/%s Add shard, timestamp: %d, sequence: %d, batchIndex: %d, ",
 			om.project, om.topic, shardId, offset.Timestamp, offset.Sequence, offset.BatchIndex)
@@ -155,6 +171,66 @@ func (om *offsetManager) removeShards(shardIds []string) {
 	}
 }
 
+func (om *offsetManager) loadDedup(shardId string, info *shardOffsetInfo) {
+	if om.dedupWindow <= 0 {
+		return
+	}
+
+	info.committed = newDedupWindow(om.dedupWindow)
+	if om.dedupStore != nil {
+		committed, err := om.dedupStore.load(shardId, om.dedupWindow)
+		if err != nil {
+			log.Warnf("%s/%s/%s Load dedup state failed, start with empty state, error: %v",
+				om.project, om.topic, shardId, err)
+		}
+		info.committed = committed
+	}
+	info.dedup = info.committed.clone()
+}
+
+func (om *offsetManager) saveDedup(shardId string, info *shardOffsetInfo) {
+	if om.dedupStore == nil || info.committed == nil {
+		return
+	}
+
+	if err := om.dedupStore.save(shardId, info.lastCommit.sequence, info.committed); err != nil {
+		log.Warnf("%s/%s/%s Save dedup state failed: %v", om.project, om.topic, shardId, err)
+	}
+}
+
+// filterDuplicates drops the records of idempotent producers which have been read,
+// the dropped records are acked so that the offset can move on
+func (om *offsetManager) filterDuplicates(shardId string, records []IRecord) []IRecord {
+	om.mu.RLock()
+	info, ok := om.shardInfos[shardId]
+	om.mu.RUnlock()
+
+	if !ok || info.dedup == nil {
+		return records
+	}
+
+	newRecords := records[:0]
+	for _, record := range records {
+		producerId, seq, ok := getProducerSequence(record)
+		rk, isImpl := record.GetRecordKey().(*recordKeyImpl)
+		if !ok || !isImpl {
+			newRecords = append(newRecords, record)
+			continue
+		}
+
+		rk.producerId = producerId
+		rk.producerSeq = seq
+		if info.dedup.check(producerId, seq) {
+			log.Debugf("%s/%s/%s Drop duplicate record, producer: %s, sequence: %d",
+				om.project, om.topic, shardId, producerId, seq)
+			rk.Ack()
+			continue
+		}
+		newRecords = append(newRecords, record)
+	}
+	return newRecords
+}
+
 func (om *offsetManager) appendRecordKey(rk *recordKeyImpl) {
 	om.mu.RLock()
 	info, ok := om.shardInfos[rk.shardId]
@@ -211,6 +287,10 @@ func (om *offsetManager) doCommit() {
 		return
 	}
 
+	for shardId := range offsets {
+		om.saveDedup(shardId, om.shardInfos[shardId])
+	}
+
 	// Format offsets as "shardId:timestamp-sequence-batchIndex,..."
 	var parts []string
 	for shardId, offset := range offsets {
@@ -231,6 +311,9 @@ func (om *offsetManager) calculateCommitOffset(info *shardOffsetInfo) (sequence
 			sequence = rk.sequence
 			batchIndex = rk.batchIndex
 			timestamp = rk.timestamp
+			if info.committed != nil && len(rk.producerId) > 0 {
+				info.committed.check(rk.producerId, rk.producerSeq)
+			}
 			removed++
 		} else {
 			break // 遇到未 ack 的就停止
@@ -274,6 +357,7 @@ func (om *offsetManager) commitShardOffset(shardId string, info *shardOffsetInfo
 	info.lastCommit.sequence = newSeq
 	info.lastCommit.batchIndex = newBatch
 	info.lastCommit.timestamp = newTimestamp
+	om.saveDedup(shardId, info)
 	log.Infof("%s/%s/%s CommitOffset success, timestamp: %d, sequence: %d, batchIndex: %d",
 		om.project, om.topic, shardId, newTimestamp, newSeq, newBatch)
 }
@@ -0,0 +1,244 @@
+package datahub
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The partitioners below only decide the shard of records without ShardId and
+// PartitionKey, the others are delegated to DefaultPartitionFunc so that the
+// per-key order is kept. They are safe to share between producers.
+
+// NewStickyPartitioner writes batchSize records to one shard before rotating to
+// the next one, so every shard writer gets full batches instead of the records
+// being spread over all shards.
+//
+// If the current shard is split, merged or disappears from the active shard list,
+// it rotates to the next shard immediately. It behaves the same with ONLY_EXTEND
+// and split/merge ExpandMode.
+func NewStickyPartitioner(batchSize int) PartitionFunc {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	var mutex sync.Mutex
+	current := ""
+	count := 0
+	return func(topic *GetTopicResult, shards []ShardEntry, record IRecord) string {
+		if hasPartitionInfo(record) {
+			return DefaultPartitionFunc(topic, shards, record)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		idx := indexOfShard(shards, current)
+		if idx < 0 || count >= batchSize {
+			idx = (idx + 1) % len(shards)
+			current = shards[idx].ShardId
+			count = 0
+		}
+		count++
+		return current
+	}
+}
+
+// NewAttributeHashPartitioner routes records by the value of the given attribute,
+// records with the same value are always written to the same shard as long as the
+// shard list does not change. Records without the attribute are routed by
+// DefaultPartitionFunc.
+//
+// With split/merge ExpandMode the MD5 of the value is mapped to the shard hash key
+// range, so when a shard is split its values only move to the two new shards, and
+// when two shards are merged their values move to the merged shard.
+// With ONLY_EXTEND ExpandMode jump consistent hash is used on the shards ordered by
+// the numeric ShardId, after extending from n to n+1 shards only 1/(n+1) of the values
+// move to the new shard.
+func NewAttributeHashPartitioner(attribute string) PartitionFunc {
+	order := &shardIdOrder{}
+	return func(topic *GetTopicResult, shards []ShardEntry, record IRecord) string {
+		if len(record.GetBaseRecord().ShardId) > 0 {
+			return record.GetBaseRecord().ShardId
+		}
+
+		value, ok := record.GetAttributes()[attribute]
+		if !ok {
+			return DefaultPartitionFunc(topic, shards, record)
+		}
+
+		if topic.ExpandMode == ONLY_EXTEND {
+			// the extended shard must be the last bucket, whatever order the shards are listed
+			shards = order.sort(shards)
+			val, _ := calculateHashCode(value)
+			return shards[jumpConsistentHash(uint64(val), len(shards))].ShardId
+		}
+		return shards[searchHashKeyRange(shards, value)].ShardId
+	}
+}
+
+// ShardBacklogFunc returns the number of records buffered or in flight for the shard,
+// AsyncProducer.GetShardBacklog can be used. It is called with the producer lock held,
+// so it must not call the AsyncProducer methods taking the lock.
+type ShardBacklogFunc func(shardId string) int
+
+// NewLeastLoadedPartitioner routes each record to the shard with the smallest backlog,
+// ties are broken by the order of the shard list.
+//
+// New shards created by split, merge or extend start with an empty backlog, so they
+// receive most records until they catch up. Sealed shards are no longer in the active
+// shard list and never chosen. It behaves the same with ONLY_EXTEND and split/merge
+// ExpandMode.
+func NewLeastLoadedPartitioner(backlog ShardBacklogFunc) PartitionFunc {
+	return func(topic *GetTopicResult, shards []ShardEntry, record IRecord) string {
+		if hasPartitionInfo(record) {
+			return DefaultPartitionFunc(topic, shards, record)
+		}
+
+		shardId := ""
+		minBacklog := 0
+		for _, shard := range shards {
+			val := backlog(shard.ShardId)
+			if len(shardId) == 0 || val < minBacklog {
+				shardId = shard.ShardId
+				minBacklog = val
+			}
+		}
+		return shardId
+	}
+}
+
+// NewWeightedPartitioner routes records randomly in proportion to the weight of each
+// shard, shards with weight <= 0 are skipped. If all weights are 0 the record is
+// written to a random shard.
+//
+// Shards not in weights, e.g. the new shards after split, merge or extend, get
+// defaultWeight. The weights of sealed shards are ignored. With split/merge ExpandMode
+// you may want to update the weights of the new shards, with ONLY_EXTEND ExpandMode
+// the weights of the existing shards are kept.
+func NewWeightedPartitioner(weights map[string]int, defaultWeight int) PartitionFunc {
+	copied := make(map[string]int, len(weights))
+	for k, v := range weights {
+		copied[k] = v
+	}
+
+	return func(topic *GetTopicResult, shards []ShardEntry, record IRecord) string {
+		if hasPartitionInfo(record) {
+			return DefaultPartitionFunc(topic, shards, record)
+		}
+
+		total := 0
+		for _, shard := range shards {
+			total += shardWeight(copied, shard.ShardId, defaultWeight)
+		}
+
+		if total <= 0 {
+			return ""
+		}
+
+		val := rand.IntN(total)
+		for _, shard := range shards {
+			val -= shardWeight(copied, shard.ShardId, defaultWeight)
+			if val < 0 {
+				return shard.ShardId
+			}
+		}
+		return ""
+	}
+}
+
+func shardWeight(weights map[string]int, shardId string, defaultWeight int) int {
+	weight, ok := weights[shardId]
+	if !ok {
+		weight = defaultWeight
+	}
+
+	if weight < 0 {
+		return 0
+	}
+	return weight
+}
+
+func hasPartitionInfo(record IRecord) bool {
+	return len(record.GetBaseRecord().ShardId) > 0 || len(record.GetBaseRecord().PartitionKey) > 0
+}
+
+func indexOfShard(shards []ShardEntry, shardId string) int {
+	for idx, shard := range shards {
+		if shard.ShardId == shardId {
+			return idx
+		}
+	}
+	return -1
+}
+
+// shardIdOrder caches the shards sorted by the numeric ShardId, the shard list
+// of a producer is only replaced when the shards are refreshed
+type shardIdOrder struct {
+	mutex  sync.Mutex
+	source []ShardEntry
+	sorted []ShardEntry
+}
+
+func (so *shardIdOrder) sort(shards []ShardEntry) []ShardEntry {
+	isSorted := sort.SliceIsSorted(shards, func(i, j int) bool {
+		return shardIdLess(shards[i].ShardId, shards[j].ShardId)
+	})
+	if isSorted {
+		return shards
+	}
+
+	so.mutex.Lock()
+	defer so.mutex.Unlock()
+	if len(so.source) == len(shards) && &so.source[0] == &shards[0] {
+		return so.sorted
+	}
+
+	sorted := make([]ShardEntry, len(shards))
+	copy(sorted, shards)
+	sort.Slice(sorted, func(i, j int) bool {
+		return shardIdLess(sorted[i].ShardId, sorted[j].ShardId)
+	})
+	so.source = shards
+	so.sorted = sorted
+	return sorted
+}
+
+// shardIdLess compares the ShardId numerically, they are decimal numbers without leading zeros
+func shardIdLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// searchHashKeyRange returns the index of the shard whose hash key range contains the MD5 of key,
+// the shards must be ordered by BeginHashKey
+func searchHashKeyRange(shards []ShardEntry, key string) int {
+	md5Key, err := calculateMD5(key)
+	if err != nil {
+		panic(err) // There should be no error returned here
+	}
+
+	ukey := strings.ToUpper(md5Key)
+	idx := sort.Search(len(shards), func(i int) bool {
+		return ukey < shards[i].BeginHashKey
+	})
+
+	if idx > 0 {
+		idx = idx - 1
+	}
+	return idx
+}
+
+// jumpConsistentHash is the algorithm from "A Fast, Minimal Memory, Consistent Hash Algorithm"
+func jumpConsistentHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,127 @@
+package datahub
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func genShardsForTest() []ShardEntry {
+	return []ShardEntry{
+		{ShardId: "0", BeginHashKey: "00000000000000000000000000000000"},
+		{ShardId: "1", BeginHashKey: "55555555555555555555555555555555"},
+		{ShardId: "2", BeginHashKey: "99999999999999999999999999999999"},
+		{ShardId: "3", BeginHashKey: "EEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEE"},
+	}
+}
+
+func TestStickyPartitioner(t *testing.T) {
+	topic := &GetTopicResult{ExpandMode: SPLIT_EXTEND}
+	shards := genShardsForTest()
+	partitioner := NewStickyPartitioner(3)
+
+	result := make([]string, 0)
+	for i := 0; i < 7; i++ {
+		result = append(result, partitioner(topic, shards, NewBlobRecord(nil)))
+	}
+	assert.Equal(t, []string{"0", "0", "0", "1", "1", "1", "2"}, result)
+
+	// current shard sealed
+	assert.Equal(t, "0", partitioner(topic, shards[:1], NewBlobRecord(nil)))
+
+	record := NewBlobRecord(nil)
+	record.SetPartitionKey("abcd")
+	assert.Equal(t, "2", partitioner(topic, shards, record))
+}
+
+func TestAttributeHashPartitioner(t *testing.T) {
+	shards := genShardsForTest()
+	partitioner := NewAttributeHashPartitioner("user")
+
+	record := NewBlobRecord(nil)
+	record.SetAttribute("user", "abcd")
+	assert.Equal(t, "2", partitioner(&GetTopicResult{ExpandMode: SPLIT_EXTEND}, shards, record))
+
+	// without attribute
+	assert.Equal(t, "", partitioner(&GetTopicResult{ExpandMode: SPLIT_EXTEND}, shards, NewBlobRecord(nil)))
+
+	record.SetShardId("1")
+	assert.Equal(t, "1", partitioner(&GetTopicResult{ExpandMode: SPLIT_EXTEND}, shards, record))
+
+	// extend shard only moves part of the values to the new shard
+	topic := &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	extendShards := append(genShardsForTest(), ShardEntry{ShardId: "4"})
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		record := NewBlobRecord(nil)
+		record.SetAttribute("user", fmt.Sprintf("user%d", i))
+		oldShard := partitioner(topic, shards, record)
+		newShard := partitioner(topic, extendShards, record)
+		if oldShard != newShard {
+			assert.Equal(t, "4", newShard)
+			moved++
+		}
+	}
+	assert.True(t, moved > 100 && moved < 300)
+}
+
+func TestAttributeHashPartitionerShardOrder(t *testing.T) {
+	topic := &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	partitioner := NewAttributeHashPartitioner("user")
+
+	// the shards are listed in the string order of ShardId
+	genShards := func(num int) []ShardEntry {
+		shards := make([]ShardEntry, 0, num)
+		for i := 0; i < num; i++ {
+			shards = append(shards, ShardEntry{ShardId: fmt.Sprintf("%d", i)})
+		}
+		sort.Slice(shards, func(i, j int) bool { return shards[i].ShardId < shards[j].ShardId })
+		return shards
+	}
+	shards, extendShards := genShards(11), genShards(12)
+	assert.Equal(t, "10", shards[2].ShardId)
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		record := NewBlobRecord(nil)
+		record.SetAttribute("user", fmt.Sprintf("user%d", i))
+		oldShard := partitioner(topic, shards, record)
+		assert.Equal(t, oldShard, partitioner(topic, shards, record))
+		newShard := partitioner(topic, extendShards, record)
+		if oldShard != newShard {
+			assert.Equal(t, "11", newShard)
+			moved++
+		}
+	}
+	assert.True(t, moved > 30 && moved < 150)
+}
+
+func TestLeastLoadedPartitioner(t *testing.T) {
+	topic := &GetTopicResult{ExpandMode: SPLIT_EXTEND}
+	backlog := map[string]int{"0": 10, "1": 3, "2": 3, "3": 5}
+	partitioner := NewLeastLoadedPartitioner(func(shardId string) int {
+		return backlog[shardId]
+	})
+
+	assert.Equal(t, "1", partitioner(topic, genShardsForTest(), NewBlobRecord(nil)))
+	backlog["1"] = 4
+	assert.Equal(t, "2", partitioner(topic, genShardsForTest(), NewBlobRecord(nil)))
+}
+
+func TestWeightedPartitioner(t *testing.T) {
+	topic := &GetTopicResult{ExpandMode: SPLIT_EXTEND}
+	partitioner := NewWeightedPartitioner(map[string]int{"0": 3, "1": 0, "2": 1}, 0)
+
+	count := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		count[partitioner(topic, genShardsForTest(), NewBlobRecord(nil))]++
+	}
+	assert.Equal(t, 0, count["1"])
+	assert.Equal(t, 0, count["3"])
+	assert.True(t, count["0"] > 2500 && count["0"] < 3500)
+
+	partitioner = NewWeightedPartitioner(map[string]int{}, 0)
+	assert.Equal(t, "", partitioner(topic, genShardsForTest(), NewBlobRecord(nil)))
+}
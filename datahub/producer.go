@@ -1,6 +1,7 @@
 package datahub
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sort"
@@ -22,8 +23,12 @@ type SendDetails struct {
 type Producer interface {
 	Init() error
 
+	// Send writes the records to a shard. If some records do not match the topic schema with
+	// EnableSchemaCheck, the valid ones are still sent and a RecordsValidationError with the
+	// index of the invalid ones is returned together with the details of the sent ones.
 	Send(records []IRecord) (*SendDetails, error)
 
+	// SendByShard writes the records to the shard, the invalid records are handled like Send.
 	SendByShard(records []IRecord, shardId string) (*SendDetails, error)
 
 	// GetSchema return the schema for the specified topic.
@@ -35,6 +40,19 @@ type Producer interface {
 
 	GetActiveShards() []string
 
+	// Stats return a snapshot of the counters since the producer created
+	Stats() ProducerStats
+
+	// CloseWithContext rejects new sends and waits for the in-flight sends until ctx is done,
+	// then the in-flight sends are aborted and the records known to be unsent, e.g. waiting
+	// for a retry or the rate limit, are returned grouped by shard without waiting for the
+	// requests in flight. Their Send calls return an error checked by IsProducerAbortedError.
+	// The batches with a request in flight at the deadline may still be written, they are
+	// not returned, their Send calls return the result of the request.
+	CloseWithContext(ctx context.Context) (map[string][]IRecord, error)
+
+	// Close rejects new sends and blocks until the in-flight sends are done,
+	// it is CloseWithContext without deadline.
 	Close() error
 }
 
@@ -49,12 +67,21 @@ type producerImpl struct {
 	mutex              sync.RWMutex
 	client             DataHubApi
 	schemaCache        topicSchemaCache
+	interceptors       interceptorChain
+	stamper            *idempotentStamper
+	stats              *producerStatsCollector
+	validator          *schemaValidator
+	closing            *closeState
+	closeMutex         sync.Mutex
+	closed             bool
+	inflight           sync.WaitGroup // sends in progress
+	limiter            *rateLimiter
 }
 
 func NewProducer(cfg *ProducerConfig) Producer {
 	var now atomic.Value
 	now.Store(time.Now())
-	return &producerImpl{
+	pi := &producerImpl{
 		config:             cfg,
 		project:            cfg.Project,
 		topic:              cfg.Topic,
@@ -62,7 +89,16 @@ func NewProducer(cfg *ProducerConfig) Producer {
 		index:              0,
 		freshShardInterval: time.Minute,
 		nextFreshShardTime: now,
+		interceptors:       cfg.Interceptors,
+		stats:              newProducerStatsCollector(),
+		closing:            newCloseState(),
+		limiter:            newRateLimiter(cfg.ShardRateLimit, cfg.TopicRateLimit),
+	}
+
+	if cfg.EnableIdempotence {
+		pi.stamper = newIdempotentStamper(cfg.ProducerId)
 	}
+	return pi
 }
 
 func (pi *producerImpl) initMeta() error {
@@ -100,6 +136,9 @@ func (pi *producerImpl) initMeta() error {
 	pi.client = NewClientWithConfig(pi.config.Endpoint, config, pi.config.Account)
 	pi.client.setUserAgent(userAgent)
 	pi.schemaCache = schemaClientInstance().getTopicSchemaCache(pi.project, pi.topic, pi.client)
+	if pi.config.EnableSchemaCheck || pi.config.EnableSchemaCoercion {
+		pi.validator = newSchemaValidator(pi.project, pi.topic, pi.schemaCache, pi.config.EnableSchemaCoercion)
+	}
 
 	err = pi.freshShard(true)
 	if err != nil {
@@ -115,12 +154,54 @@ func (pi *producerImpl) Init() error {
 }
 
 func (pi *producerImpl) Send(records []IRecord) (*SendDetails, error) {
+	if !pi.beginSend() {
+		return nil, fmt.Errorf("%s/%s producer has been closed", pi.project, pi.topic)
+	}
+	defer pi.inflight.Done()
+
+	newRecords, err := pi.interceptors.onSendBatch(records)
+	if err != nil {
+		pi.interceptors.onAcknowledgement("", records, err)
+		return nil, err
+	}
+
+	newRecords, verr := pi.validateBatch("", newRecords)
+	if verr != nil && len(newRecords) == 0 {
+		return nil, verr
+	}
+	pi.stamper.stampBatch(newRecords)
+
+	details, err := pi.send(newRecords)
+	if err != nil {
+		pi.interceptors.onAcknowledgement("", newRecords, err)
+		return nil, err
+	}
+
+	pi.interceptors.onAcknowledgement(details.ShardId, newRecords, nil)
+	if verr != nil {
+		verr.Details = details
+		return details, verr
+	}
+	return details, nil
+}
+
+// validateBatch returns the valid records, the invalid ones are acknowledged with their
+// errors. The error is nil if all records are valid.
+func (pi *producerImpl) validateBatch(shardId string, records []IRecord) ([]IRecord, *RecordsValidationError) {
+	newRecords, invalid, verr := pi.validator.validateBatch(records)
+	if verr != nil {
+		pi.interceptors.onAcknowledgement(shardId, invalid, verr)
+	}
+	return newRecords, verr
+}
+
+func (pi *producerImpl) send(records []IRecord) (*SendDetails, error) {
 	shardId := pi.getNextShard()
 	if shardId == "" {
 		return nil, fmt.Errorf("cannot get valid shard")
 	}
 
-	details, err := pi.SendByShard(records, shardId)
+	details, err := pi.sendWithRetry(records, shardId)
 	if IsShardSealedError(err) {
 		pi.freshShard(true)
 		shardId = pi.getNextShard()
@@ -128,7 +209,7 @@ func (pi *producerImpl) Send(records []IRecord) (*SendDetails, error) {
 			return nil, fmt.Errorf("cannot get valid shard")
 		}
 
-		details, err = pi.SendByShard(records, shardId)
+		details, err = pi.sendWithRetry(records, shardId)
 	}
 
 	if err != nil {
@@ -139,19 +220,84 @@ func (pi *producerImpl) Send(records []IRecord) (*SendDetails, error) {
 }
 
 func (pi *producerImpl) SendByShard(records []IRecord, shardId string) (*SendDetails, error) {
-	return pi.sendWithRetry(records, shardId)
+	if !pi.beginSend() {
+		return nil, fmt.Errorf("%s/%s producer has been closed", pi.project, pi.topic)
+	}
+	defer pi.inflight.Done()
+
+	newRecords, err := pi.interceptors.onSendBatch(records)
+	if err != nil {
+		pi.interceptors.onAcknowledgement(shardId, records, err)
+		return nil, err
+	}
+
+	newRecords, verr := pi.validateBatch(shardId, newRecords)
+	if verr != nil && len(newRecords) == 0 {
+		return nil, verr
+	}
+	pi.stamper.stampBatch(newRecords)
+
+	details, err := pi.sendWithRetry(newRecords, shardId)
+	pi.interceptors.onAcknowledgement(shardId, newRecords, err)
+	if err == nil && verr != nil {
+		verr.Details = details
+		return details, verr
+	}
+	return details, err
 }
 
+// beginSend returns false if the producer is closed, otherwise inflight.Done must be called
+func (pi *producerImpl) beginSend() bool {
+	pi.closeMutex.Lock()
+	defer pi.closeMutex.Unlock()
+
+	if pi.closed {
+		return false
+	}
+	pi.inflight.Add(1)
+	return true
+}
+
+// sendWithRetry keeps the records pending in closing, so that they are returned by
+// CloseWithContext if the deadline is exceeded before the send is done
 func (pi *producerImpl) sendWithRetry(records []IRecord, shardId string) (*SendDetails, error) {
+	pending := pi.closing.track(shardId, records)
+	details, err := pi.doSendWithRetry(pending)
+	if IsProducerAbortedError(err) {
+		return nil, err
+	}
+
+	if !pi.closing.untrack(pending) {
+		return nil, errProducerAborted
+	}
+	return details, err
+}
+
+func (pi *producerImpl) doSendWithRetry(pending *pendingBatch) (*SendDetails, error) {
+	records, shardId := pending.records, pending.shardId
 	var returnErr error = nil
+	stats := pi.stats.shard(shardId)
 	for i := 0; pi.config.MaxRetry < 0 || i <= pi.config.MaxRetry; i++ {
+		if delay := pi.limiter.reserve(shardId, len(records), int(batchSize(records))); delay > 0 {
+			if !pi.closing.sleep(delay) {
+				return nil, errProducerAborted
+			}
+		}
+
 		now := time.Now()
-		res, err := pi.client.PutRecordsByShard(pi.project, pi.topic, shardId, records)
+		stats.beginRequest()
+		res, err := pi.closing.putPending(pi.client, pi.project, pi.topic, pending)
+		stats.endRequest()
+		if IsProducerAbortedError(err) {
+			return nil, err
+		}
+
 		if err == nil {
 			if log.IsLevelEnabled(log.DebugLevel) {
 				log.Debugf("%s/%s/%s send records %d success, cost: %v, rid:%s",
 					pi.project, pi.topic, shardId, len(records), time.Since(now), res.RequestId)
 			}
+			stats.onSuccess(len(records), res.ReqSize, res.RawSize, time.Since(now))
 
 			return &SendDetails{
 				ReqSize:   res.ReqSize,
@@ -164,10 +310,14 @@ func (pi *producerImpl) sendWithRetry(records []IRecord, shardId string) (*SendD
 		if !IsRetryableError(err) {
 			log.Errorf("%s/%s/%s send records %d failed, cost:%v, error:%v",
 				pi.project, pi.topic, shardId, len(records), time.Since(now), err)
+			stats.onFailure(len(records), err)
 			return nil, err
 		}
 
 		returnErr = err
+		if i < pi.config.MaxRetry || pi.config.MaxRetry < 0 {
+			stats.onRetry(err)
+		}
 		sleepTime := pi.config.RetryInterval
 		if IsNetworkError(err) {
 			if log.IsLevelEnabled(log.DebugLevel) {
@@ -182,8 +332,11 @@ func (pi *producerImpl) sendWithRetry(records []IRecord, shardId string) (*SendD
 			log.Warnf("%s/%s/%s send records %d failed, cost:%v, error:%v",
 				pi.project, pi.topic, shardId, len(records), time.Since(now), err)
 		}
-		time.Sleep(sleepTime)
+		if !pi.closing.sleep(sleepTime) {
+			return nil, errProducerAborted
+		}
 	}
+	stats.onFailure(len(records), returnErr)
 	return nil, returnErr
 }
 
@@ -262,6 +415,7 @@ func (pi *producerImpl) freshShard(force bool) error {
 	pi.mutex.Lock()
 	defer pi.mutex.Unlock()
 
+	pi.stats.onShardRefreshed()
 	if shardsEqual(pi.shards, newShards) {
 		log.Infof("%s/%s fresh shard success, no shard update, current:%s",
 			pi.project, pi.topic, newShards)
@@ -304,6 +458,35 @@ func (pi *producerImpl) GetActiveShards() []string {
 	return dst
 }
 
+func (pi *producerImpl) Stats() ProducerStats {
+	return pi.stats.snapshot(nil)
+}
+
+func (pi *producerImpl) CloseWithContext(ctx context.Context) (map[string][]IRecord, error) {
+	pi.closeMutex.Lock()
+	pi.closed = true
+	pi.closeMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pi.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Warnf("%s/%s close producer timeout, abort sending, error:%v", pi.project, pi.topic, err)
+		pi.closing.abort()
+	}
+
+	log.Infof("%s/%s producer closed", pi.project, pi.topic)
+	return pi.closing.takeUnsent(), err
+}
+
 func (pi *producerImpl) Close() error {
-	return nil
+	_, err := pi.CloseWithContext(context.Background())
+	return err
 }
@@ -0,0 +1,176 @@
+package datahub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var errProducerAborted = fmt.Errorf("producer closed before the records were sent")
+
+var errProducerInterrupted = fmt.Errorf("producer closed while the request was in flight, the records may have been written")
+
+// IsProducerAbortedError returns true if the records were not sent because
+// the producer was closed by CloseWithContext before they could be sent.
+func IsProducerAbortedError(err error) bool {
+	return err == errProducerAborted
+}
+
+// IsProducerInterruptedError returns true if the AsyncProducer was closed by CloseWithContext
+// while the request of the records was in flight, the records may have been written.
+func IsProducerInterruptedError(err error) bool {
+	return err == errProducerInterrupted
+}
+
+// closeState collects the unsent records once the close deadline is exceeded,
+// after abort() every waiting send returns errProducerAborted immediately.
+type closeState struct {
+	abortCh   chan struct{}
+	abortOnce sync.Once
+	mutex     sync.Mutex
+	unsent    map[string][]IRecord
+	pending   map[*pendingBatch]struct{}
+	taken     bool // the unsent records have been returned by takeUnsent
+}
+
+// pendingBatch is a batch being sent by Producer, it is returned as unsent if it is
+// still pending without a request in flight when the close deadline is exceeded
+type pendingBatch struct {
+	shardId  string
+	records  []IRecord
+	inFlight bool // a request of the batch is in flight, it may be written
+	taken    bool // returned by takeUnsent, it must not be sent anymore
+}
+
+func newCloseState() *closeState {
+	return &closeState{
+		abortCh: make(chan struct{}),
+		unsent:  make(map[string][]IRecord),
+		pending: make(map[*pendingBatch]struct{}),
+	}
+}
+
+func (cs *closeState) abort() {
+	cs.abortOnce.Do(func() {
+		close(cs.abortCh)
+	})
+}
+
+func (cs *closeState) isAborted() bool {
+	select {
+	case <-cs.abortCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// addUnsent keeps the records to return, shardId is empty if the records have no shard yet
+func (cs *closeState) addUnsent(shardId string, records []IRecord) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.unsent[shardId] = append(cs.unsent[shardId], records...)
+}
+
+// takeUnsent returns the unsent records including the pending batches without a request
+// in flight, the other batches are only returned to their senders
+func (cs *closeState) takeUnsent() map[string][]IRecord {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	for batch := range cs.pending {
+		if batch.inFlight {
+			continue
+		}
+		cs.unsent[batch.shardId] = append(cs.unsent[batch.shardId], batch.records...)
+		batch.taken = true
+		delete(cs.pending, batch)
+	}
+	unsent := cs.unsent
+	cs.unsent = make(map[string][]IRecord)
+	cs.taken = true
+	return unsent
+}
+
+// track marks the batch as pending until untrack
+func (cs *closeState) track(shardId string, records []IRecord) *pendingBatch {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	batch := &pendingBatch{shardId: shardId, records: records}
+	if cs.taken {
+		batch.taken = true
+	} else {
+		cs.pending[batch] = struct{}{}
+	}
+	return batch
+}
+
+// untrack returns false if the batch has been returned by takeUnsent, the result
+// of sending it must be dropped then
+func (cs *closeState) untrack(batch *pendingBatch) bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	delete(cs.pending, batch)
+	return !batch.taken
+}
+
+// putPending sends the pending batch unless aborted, the batch is not returned by
+// takeUnsent while the request is in flight
+func (cs *closeState) putPending(client DataHubApi, project, topic string,
+	batch *pendingBatch) (*PutRecordsByShardResult, error) {
+	cs.mutex.Lock()
+	if batch.taken || cs.isAborted() {
+		cs.mutex.Unlock()
+		return nil, errProducerAborted
+	}
+	batch.inFlight = true
+	cs.mutex.Unlock()
+
+	defer func() {
+		cs.mutex.Lock()
+		batch.inFlight = false
+		cs.mutex.Unlock()
+	}()
+	return client.PutRecordsByShard(project, topic, batch.shardId, batch.records)
+}
+
+// putRecords sends the records unless aborted, the request in flight is not waited after
+// abort, it returns errProducerInterrupted and the request ends by the http timeout at the latest.
+func (cs *closeState) putRecords(client DataHubApi, project, topic, shardId string,
+	records []IRecord) (*PutRecordsByShardResult, error) {
+	if cs.isAborted() {
+		return nil, errProducerAborted
+	}
+
+	type putResult struct {
+		res *PutRecordsByShardResult
+		err error
+	}
+	resultCh := make(chan putResult, 1)
+	go func() {
+		res, err := client.PutRecordsByShard(project, topic, shardId, records)
+		resultCh <- putResult{res: res, err: err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.res, result.err
+	case <-cs.abortCh:
+		return nil, errProducerInterrupted
+	}
+}
+
+// sleep returns false if aborted before the duration elapsed
+func (cs *closeState) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-cs.abortCh:
+		return false
+	}
+}
@@ -0,0 +1,173 @@
+package datahub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingMockClient blocks the requests until release is closed, then fails them with err if set
+type blockingMockClient struct {
+	DataHubApi
+	release chan struct{}
+	err     error
+}
+
+func (m *blockingMockClient) PutRecordsByShard(projectName, topicName, shardId string, records []IRecord) (*PutRecordsByShardResult, error) {
+	<-m.release
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &PutRecordsByShardResult{}, nil
+}
+
+func (m *blockingMockClient) ListShard(projectName, topicName string) (*ListShardResult, error) {
+	return &ListShardResult{Shards: []ShardEntry{{ShardId: "0", State: ACTIVE}}}, nil
+}
+
+func TestAsyncProducerCloseWithContext(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.MaxAsyncBufferNum = 2
+	client := &blockingMockClient{release: make(chan struct{})}
+
+	ap := NewAsyncProducer(cfg).(*asyncProducerImpl)
+	ap.client = client
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	assert.Nil(t, ap.freshShard())
+	ap.wg.Add(2)
+	go ap.dispatch()
+	go ap.dispatchBatch()
+
+	for i := 0; i < 5; i++ {
+		record := NewBlobRecord([]byte("test"))
+		record.SetShardId("0")
+		ap.Input() <- record
+	}
+
+	// the request in flight is not waited, it finishes after the close
+	defer close(client.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	unsent, err := ap.CloseWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 3, len(unsent["0"]))
+
+	// the records of the request in flight may have been written, they are reported as errors
+	perr, ok := <-ap.Errors()
+	assert.True(t, ok)
+	assert.True(t, IsProducerInterruptedError(perr.Err))
+	assert.Equal(t, 2, len(perr.Records))
+	_, ok = <-ap.Errors()
+	assert.False(t, ok)
+
+	// close again is a no-op
+	assert.Nil(t, ap.Close())
+}
+
+func TestAsyncProducerCloseTwice(t *testing.T) {
+	ap := NewAsyncProducer(NewProducerConfig()).(*asyncProducerImpl)
+	ap.client = &producerMockClient{shards: []ShardEntry{{ShardId: "0", State: ACTIVE}}}
+	ap.topicMeta = &GetTopicResult{ExpandMode: ONLY_EXTEND}
+	assert.Nil(t, ap.freshShard())
+	ap.wg.Add(2)
+	go ap.dispatch()
+	go ap.dispatchBatch()
+
+	assert.Nil(t, ap.Close())
+	assert.Nil(t, ap.Close())
+	unsent, err := ap.CloseWithContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unsent))
+}
+
+func TestProducerCloseWithContext(t *testing.T) {
+	client := &blockingMockClient{release: make(chan struct{})}
+	producer := newProducerForTest(NewProducerConfig(), client)
+
+	sendErr := make(chan error)
+	go func() {
+		_, err := producer.SendByShard([]IRecord{NewBlobRecord([]byte("test"))}, "0")
+		sendErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// the request in flight is not waited, its records may be written so they are not returned
+	start := time.Now()
+	unsent, err := producer.CloseWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 0, len(unsent))
+
+	// the result of the request returned after the deadline goes to the sender
+	close(client.release)
+	assert.Nil(t, <-sendErr)
+
+	_, err = producer.Send([]IRecord{NewBlobRecord([]byte("test"))})
+	assert.NotNil(t, err)
+}
+
+func TestProducerCloseWithContextRetrying(t *testing.T) {
+	client := &blockingMockClient{release: make(chan struct{}), err: NewDatahubError(500, "", "InternalServerError", "test")}
+	close(client.release)
+	cfg := NewProducerConfig()
+	cfg.RetryInterval = time.Hour
+	producer := newProducerForTest(cfg, client)
+
+	sendErr := make(chan error)
+	go func() {
+		_, err := producer.SendByShard([]IRecord{NewBlobRecord([]byte("test"))}, "0")
+		sendErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the batch waiting for the retry is known to be unsent
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	unsent, err := producer.CloseWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, len(unsent["0"]))
+	assert.True(t, IsProducerAbortedError(<-sendErr))
+}
+
+func TestProducerCloseWithoutInflight(t *testing.T) {
+	producer := newProducerForTest(NewProducerConfig(), &producerMockClient{})
+	_, err := producer.Send([]IRecord{NewBlobRecord([]byte("test"))})
+	assert.Nil(t, err)
+
+	unsent, err := producer.CloseWithContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unsent))
+}
+
+func TestProducerCloseWaitsInflight(t *testing.T) {
+	client := &blockingMockClient{release: make(chan struct{})}
+	producer := newProducerForTest(NewProducerConfig(), client)
+
+	sendErr := make(chan error)
+	go func() {
+		_, err := producer.Send([]IRecord{NewBlobRecord([]byte("test"))})
+		sendErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closeErr := make(chan error)
+	go func() {
+		closeErr <- producer.Close()
+	}()
+
+	select {
+	case <-closeErr:
+		t.Fatal("close returned before the send is done")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(client.release)
+	assert.Nil(t, <-sendErr)
+	assert.Nil(t, <-closeErr)
+}
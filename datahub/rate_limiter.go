@@ -0,0 +1,126 @@
+package datahub
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit is the max throughput, a value <= 0 means unlimited.
+// Bursts up to one second of the rate are allowed.
+type RateLimit struct {
+	RecordsPerSecond float64
+	BytesPerSecond   float64
+}
+
+func (rl RateLimit) enabled() bool {
+	return rl.RecordsPerSecond > 0 || rl.BytesPerSecond > 0
+}
+
+// tokenBucket allows the tokens to go negative, so a request larger than the
+// burst is admitted and the later requests wait until the debt is repaid.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n tokens and returns how long to wait before using them
+func (tb *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	if now.After(tb.last) {
+		tb.tokens = min(tb.tokens+now.Sub(tb.last).Seconds()*tb.rate, tb.rate)
+		tb.last = now
+	}
+
+	tb.tokens -= n
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// throughputLimiter limits records and bytes at the same time
+type throughputLimiter struct {
+	records *tokenBucket
+	bytes   *tokenBucket
+}
+
+func newThroughputLimiter(limit RateLimit) *throughputLimiter {
+	tl := &throughputLimiter{}
+	if limit.RecordsPerSecond > 0 {
+		tl.records = newTokenBucket(limit.RecordsPerSecond)
+	}
+	if limit.BytesPerSecond > 0 {
+		tl.bytes = newTokenBucket(limit.BytesPerSecond)
+	}
+	return tl
+}
+
+func (tl *throughputLimiter) reserve(now time.Time, records, bytes int) time.Duration {
+	var delay time.Duration
+	if tl.records != nil {
+		delay = max(delay, tl.records.reserve(now, float64(records)))
+	}
+	if tl.bytes != nil {
+		delay = max(delay, tl.bytes.reserve(now, float64(bytes)))
+	}
+	return delay
+}
+
+// rateLimiter limits the throughput of every shard and the whole topic
+type rateLimiter struct {
+	mutex      sync.Mutex
+	shardLimit RateLimit
+	topic      *throughputLimiter
+	shards     map[string]*throughputLimiter
+}
+
+// newRateLimiter returns nil if both limits are unlimited
+func newRateLimiter(shardLimit, topicLimit RateLimit) *rateLimiter {
+	if !shardLimit.enabled() && !topicLimit.enabled() {
+		return nil
+	}
+
+	rl := &rateLimiter{
+		shardLimit: shardLimit,
+		shards:     make(map[string]*throughputLimiter),
+	}
+	if topicLimit.enabled() {
+		rl.topic = newThroughputLimiter(topicLimit)
+	}
+	return rl
+}
+
+// reserve charges the records and bytes to the shard and the topic, and returns
+// how long to wait before sending them. Pass 0 to wait for the earlier debt only.
+func (rl *rateLimiter) reserve(shardId string, records, bytes int) time.Duration {
+	if rl == nil {
+		return 0
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+	var delay time.Duration
+	if rl.topic != nil {
+		delay = rl.topic.reserve(now, records, bytes)
+	}
+
+	if rl.shardLimit.enabled() {
+		limiter, ok := rl.shards[shardId]
+		if !ok {
+			limiter = newThroughputLimiter(rl.shardLimit)
+			rl.shards[shardId] = limiter
+		}
+		delay = max(delay, limiter.reserve(now, records, bytes))
+	}
+	return delay
+}
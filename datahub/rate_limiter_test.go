@@ -0,0 +1,56 @@
+package datahub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(100)
+	tb.last = now
+
+	// burst of one second
+	assert.Equal(t, time.Duration(0), tb.reserve(now, 100))
+	assert.Equal(t, 500*time.Millisecond, tb.reserve(now, 50))
+
+	// debt is repaid over time
+	assert.Equal(t, time.Duration(0), tb.reserve(now.Add(500*time.Millisecond), 0))
+
+	// tokens do not exceed the burst
+	assert.Equal(t, time.Second, tb.reserve(now.Add(time.Hour), 200))
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert.Nil(t, newRateLimiter(RateLimit{}, RateLimit{}))
+	var disabled *rateLimiter
+	assert.Equal(t, time.Duration(0), disabled.reserve("0", 100, 100))
+
+	limiter := newRateLimiter(RateLimit{RecordsPerSecond: 10}, RateLimit{BytesPerSecond: 1000})
+	assert.Equal(t, time.Duration(0), limiter.reserve("0", 10, 100))
+	assert.True(t, limiter.reserve("0", 10, 100) > 800*time.Millisecond)
+
+	// other shards are limited by the topic bytes only
+	assert.Equal(t, time.Duration(0), limiter.reserve("1", 10, 700))
+	assert.True(t, limiter.reserve("2", 1, 1000) > 800*time.Millisecond)
+}
+
+func TestProducerRateLimit(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.ShardRateLimit = RateLimit{RecordsPerSecond: 10}
+	producer := newProducerForTest(cfg, &producerMockClient{})
+
+	records := make([]IRecord, 0)
+	for i := 0; i < 11; i++ {
+		records = append(records, NewBlobRecord([]byte("test")))
+	}
+	_, err := producer.SendByShard(records, "0")
+	assert.Nil(t, err)
+
+	start := time.Now()
+	_, err = producer.SendByShard(records[:1], "0")
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) > 50*time.Millisecond)
+}
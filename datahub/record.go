@@ -195,6 +195,8 @@ func NewTupleRecord(schema *RecordSchema) *TupleRecord {
 	return tr
 }
 
+// NewTupleRecordFromJson parses the json object of {fieldName: value}, the JSON fields may be
+// inlined objects, see TupleRecord.ToJson
 func NewTupleRecordFromJson(schema *RecordSchema, jsonBuf []byte, opts ...JsonParseOption) (*TupleRecord, error) {
 	record := NewTupleRecord(schema)
 
@@ -208,9 +210,37 @@ func NewTupleRecordFromJson(schema *RecordSchema, jsonBuf []byte, opts ...JsonPa
 		return nil, err
 	}
 
+	if cfg.withMetadata {
+		if meta, ok := obj[TupleRecordMetadataKey]; ok {
+			delete(obj, TupleRecordMetadataKey)
+			if err := parseJsonMetadata(&record.BaseRecord, meta); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var raws map[string]json.RawMessage
 	for k, v := range obj {
-		err = record.SetValueByName(k, v)
-		if err != nil {
+		if idx := schema.GetFieldIndex(k); idx >= 0 && v != nil {
+			var err error
+			switch schema.Fields[idx].Type {
+			case TIMESTAMP:
+				v, err = parseJsonTimestamp(v, cfg)
+			case JSON:
+				// the raw text keeps the key order of the inlined json
+				if raws == nil {
+					if err := parser.Unmarshal(jsonBuf, &raws); err != nil {
+						return nil, err
+					}
+				}
+				v, err = parseJsonFieldValue(raws[k])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("[%s] %v", k, err)
+			}
+		}
+
+		if err := record.SetValueByName(k, v); err != nil {
 			if IsFieldNotExistsError(err) && cfg.ignoreNotExistKey {
 				continue
 			}
@@ -240,11 +270,15 @@ func (tr *TupleRecord) SetValueByIdx(idx int, val any) error {
 	}
 
 	field := tr.RecordSchema.Fields[idx]
-	if val == nil && !field.AllowNull {
-		return fmt.Errorf("[%s] not allow null", field.Name)
+	if val == nil {
+		if !field.AllowNull {
+			return fmt.Errorf("[%s] not allow null", field.Name)
+		}
+		tr.Values[idx] = nil
+		return nil
 	}
 
-	v, err := validateFieldValue(field.Type, val)
+	v, err := validateField(tr.RecordSchema, &field, val)
 	if err != nil {
 		return err
 	}
@@ -291,11 +325,9 @@ func (tr *TupleRecord) SetValues(values []DataType) error {
 	}
 
 	for idx, val := range values {
-		v, err := validateFieldValue(tr.RecordSchema.Fields[idx].Type, val)
-		if err != nil {
+		if err := tr.SetValueByIdx(idx, val); err != nil {
 			return err
 		}
-		tr.Values[idx] = v
 	}
 	return nil
 }
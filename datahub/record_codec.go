@@ -0,0 +1,356 @@
+package datahub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// RecordEncoder writes the tuple records to a stream, Flush must be called after the last record
+type RecordEncoder interface {
+	Encode(record *TupleRecord) error
+	Flush() error
+}
+
+// RecordDecoder reads the tuple records from a stream, Decode returns io.EOF at the end
+type RecordDecoder interface {
+	Decode() (*TupleRecord, error)
+}
+
+// RecordDecodeError is returned by RecordDecoder if the line can not be decoded
+type RecordDecodeError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordDecodeError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RecordDecodeError) Unwrap() error {
+	return e.Err
+}
+
+type CsvConfig struct {
+	Delimiter            rune   // field delimiter, default ','
+	NullToken            string // the token of null value of the nullable fields, default ""
+	TimestampLayout      string // time layout of the TIMESTAMP fields, empty means the microseconds since epoch
+	Header               bool   // the first line is the field names, otherwise the columns are in the field order, default true
+	IgnoreUnknownColumns bool   // skip the header columns not in the schema, default false
+}
+
+func NewCsvConfig() *CsvConfig {
+	return &CsvConfig{
+		Delimiter:            ',',
+		NullToken:            "",
+		TimestampLayout:      "",
+		Header:               true,
+		IgnoreUnknownColumns: false,
+	}
+}
+
+type csvEncoder struct {
+	config        *CsvConfig
+	schema        *RecordSchema
+	writer        *csv.Writer
+	headerWritten bool
+	row           []string
+}
+
+// NewCsvEncoder returns an encoder writing the records of the schema as csv
+func NewCsvEncoder(w io.Writer, schema *RecordSchema, config *CsvConfig) (RecordEncoder, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+	if config == nil {
+		config = NewCsvConfig()
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = config.Delimiter
+	return &csvEncoder{
+		config: config,
+		schema: schema,
+		writer: writer,
+		row:    make([]string, schema.Size()),
+	}, nil
+}
+
+func (ce *csvEncoder) Encode(record *TupleRecord) error {
+	if err := checkRecordSchema(ce.schema, record); err != nil {
+		return err
+	}
+
+	if ce.config.Header && !ce.headerWritten {
+		if err := ce.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	for idx := range ce.schema.Fields {
+		var val DataType
+		if idx < len(record.Values) {
+			val = record.Values[idx]
+		}
+		ce.row[idx] = formatCsvValue(val, ce.config)
+	}
+	return ce.writer.Write(ce.row)
+}
+
+func (ce *csvEncoder) writeHeader() error {
+	header := make([]string, 0, ce.schema.Size())
+	for _, field := range ce.schema.Fields {
+		header = append(header, field.Name)
+	}
+
+	ce.headerWritten = true
+	return ce.writer.Write(header)
+}
+
+func (ce *csvEncoder) Flush() error {
+	if ce.config.Header && !ce.headerWritten {
+		if err := ce.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	ce.writer.Flush()
+	return ce.writer.Error()
+}
+
+func formatCsvValue(val DataType, config *CsvConfig) string {
+	switch v := val.(type) {
+	case nil:
+		return config.NullToken
+	case Timestamp:
+		if len(config.TimestampLayout) > 0 {
+			return time.UnixMicro(int64(v)).UTC().Format(config.TimestampLayout)
+		}
+	}
+	return val.String()
+}
+
+type csvDecoder struct {
+	config   *CsvConfig
+	schema   *RecordSchema
+	reader   *csv.Reader
+	fieldIdx []int // the field index of every column, -1 for the ignored columns
+	started  bool
+}
+
+// NewCsvDecoder returns a decoder reading the csv records of the schema, the columns are mapped
+// to the fields by the header, the fields without column are null.
+func NewCsvDecoder(r io.Reader, schema *RecordSchema, config *CsvConfig) (RecordDecoder, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+	if config == nil {
+		config = NewCsvConfig()
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = config.Delimiter
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvDecoder{
+		config: config,
+		schema: schema,
+		reader: reader,
+	}, nil
+}
+
+func (cd *csvDecoder) Decode() (*TupleRecord, error) {
+	if !cd.started {
+		if err := cd.readHeader(); err != nil {
+			return nil, err
+		}
+		cd.started = true
+	}
+
+	row, err := cd.reader.Read()
+	if err != nil {
+		return nil, cd.wrapError(err)
+	}
+
+	line, _ := cd.reader.FieldPos(0)
+	if len(row) != len(cd.fieldIdx) {
+		return nil, &RecordDecodeError{Line: line,
+			Err: fmt.Errorf("column size %d not match header size %d", len(row), len(cd.fieldIdx))}
+	}
+
+	record := NewTupleRecord(cd.schema)
+	for col, str := range row {
+		idx := cd.fieldIdx[col]
+		if idx < 0 {
+			continue
+		}
+
+		field := &cd.schema.Fields[idx]
+		if field.AllowNull && str == cd.config.NullToken {
+			continue
+		}
+
+		val, err := parseCsvValue(str, field.Type, cd.config)
+		if err == nil {
+			err = record.SetValueByIdx(idx, val)
+		}
+		if err != nil {
+			return nil, &RecordDecodeError{Line: line, Err: fmt.Errorf("[%s] %v", field.Name, err)}
+		}
+	}
+	return record, nil
+}
+
+func (cd *csvDecoder) readHeader() error {
+	if !cd.config.Header {
+		cd.fieldIdx = make([]int, cd.schema.Size())
+		for idx := range cd.fieldIdx {
+			cd.fieldIdx[idx] = idx
+		}
+		return nil
+	}
+
+	header, err := cd.reader.Read()
+	if err != nil {
+		return cd.wrapError(err)
+	}
+
+	cd.fieldIdx = make([]int, len(header))
+	seen := make(map[string]bool)
+	for col, name := range header {
+		if seen[name] {
+			return &RecordDecodeError{Line: 1, Err: fmt.Errorf("duplicate column [%s]", name)}
+		}
+		seen[name] = true
+
+		idx := cd.schema.GetFieldIndex(name)
+		if idx < 0 && !cd.config.IgnoreUnknownColumns {
+			return &RecordDecodeError{Line: 1, Err: newFieldNotExistsError(fmt.Sprintf("field[%s] not exist", name))}
+		}
+		cd.fieldIdx[col] = idx
+	}
+	return nil
+}
+
+func (cd *csvDecoder) wrapError(err error) error {
+	if err == io.EOF {
+		return err
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &RecordDecodeError{Line: parseErr.Line, Err: parseErr.Err}
+	}
+	return err
+}
+
+// parseCsvValue parses the value by castValueFromString, the integers are parsed as BIGINT
+// so that validateFieldValue checks the range of the field type.
+func parseCsvValue(str string, ft FieldType, config *CsvConfig) (any, error) {
+	switch ft {
+	case TINYINT, SMALLINT, INTEGER:
+		return castValueFromString(str, BIGINT)
+	case TIMESTAMP:
+		if len(config.TimestampLayout) > 0 {
+			t, err := time.Parse(config.TimestampLayout, str)
+			if err != nil {
+				return nil, err
+			}
+			return t.UnixMicro(), nil
+		}
+		v, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return castValueFromString(str, ft)
+	}
+}
+
+type jsonLinesEncoder struct {
+	opts   []JsonParseOption
+	writer *bufio.Writer
+}
+
+// NewJsonLinesEncoder returns an encoder writing every record as a json line, see TupleRecord.ToJson
+func NewJsonLinesEncoder(w io.Writer, opts ...JsonParseOption) RecordEncoder {
+	return &jsonLinesEncoder{
+		opts:   opts,
+		writer: bufio.NewWriter(w),
+	}
+}
+
+func (je *jsonLinesEncoder) Encode(record *TupleRecord) error {
+	buf, err := record.ToJson(je.opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := je.writer.Write(buf); err != nil {
+		return err
+	}
+	return je.writer.WriteByte('\n')
+}
+
+func (je *jsonLinesEncoder) Flush() error {
+	return je.writer.Flush()
+}
+
+type jsonLinesDecoder struct {
+	schema *RecordSchema
+	opts   []JsonParseOption
+	reader *bufio.Reader
+	line   int
+}
+
+// NewJsonLinesDecoder returns a decoder reading a record of the schema from every json line,
+// the blank lines are skipped, see NewTupleRecordFromJson.
+func NewJsonLinesDecoder(r io.Reader, schema *RecordSchema, opts ...JsonParseOption) (RecordDecoder, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+
+	return &jsonLinesDecoder{
+		schema: schema,
+		opts:   opts,
+		reader: bufio.NewReader(r),
+	}, nil
+}
+
+func (jd *jsonLinesDecoder) Decode() (*TupleRecord, error) {
+	for {
+		buf, err := jd.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(buf) == 0) {
+			return nil, err
+		}
+		jd.line++
+
+		buf = bytes.TrimSpace(buf)
+		if len(buf) == 0 {
+			continue
+		}
+
+		record, err := NewTupleRecordFromJson(jd.schema, buf, jd.opts...)
+		if err != nil {
+			return nil, &RecordDecodeError{Line: jd.line, Err: err}
+		}
+		return record, nil
+	}
+}
+
+func checkRecordSchema(schema *RecordSchema, record *TupleRecord) error {
+	if record == nil || record.RecordSchema == nil {
+		return fmt.Errorf("record schema is nil")
+	}
+
+	if record.RecordSchema != schema && record.RecordSchema.HashCode() != schema.HashCode() {
+		return fmt.Errorf("record schema %s not match %s", record.RecordSchema.String(), schema.String())
+	}
+	return nil
+}
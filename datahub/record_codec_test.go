@@ -0,0 +1,172 @@
+package datahub
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCodecTestSchema() *RecordSchema {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "id", Type: BIGINT, AllowNull: false})
+	schema.AddField(Field{Name: "name", Type: STRING, AllowNull: true})
+	schema.AddField(Field{Name: "level", Type: TINYINT, AllowNull: true})
+	schema.AddField(Field{Name: "ts", Type: TIMESTAMP, AllowNull: true})
+	schema.AddField(Field{Name: "price", Type: DECIMAL, AllowNull: true})
+	schema.AddField(Field{Name: "extra", Type: JSON, AllowNull: true})
+	return schema
+}
+
+func newCodecTestRecords(t *testing.T, schema *RecordSchema) []*TupleRecord {
+	price, _ := decimal.NewFromString("19.90")
+	record1 := NewTupleRecord(schema)
+	assert.Nil(t, record1.SetValues([]DataType{Bigint(1), String("a,\"b\""), Tinyint(3),
+		Timestamp(1748599432750123), Decimal(price), Json(`{"k":[1,2]}`)}))
+
+	record2 := NewTupleRecord(schema)
+	assert.Nil(t, record2.SetValues([]DataType{Bigint(2), nil, nil, nil, nil, nil}))
+	return []*TupleRecord{record1, record2}
+}
+
+func TestCsvCodec(t *testing.T) {
+	schema := newCodecTestSchema()
+	records := newCodecTestRecords(t, schema)
+
+	config := NewCsvConfig()
+	config.NullToken = `\N`
+	config.TimestampLayout = "2006-01-02 15:04:05.000000"
+
+	var buf bytes.Buffer
+	encoder, err := NewCsvEncoder(&buf, schema, config)
+	assert.Nil(t, err)
+	for _, record := range records {
+		assert.Nil(t, encoder.Encode(record))
+	}
+	assert.Nil(t, encoder.Flush())
+	assert.Equal(t, "id,name,level,ts,price,extra\n"+
+		"1,\"a,\"\"b\"\"\",3,2025-05-30 10:03:52.750123,19.9,\"{\"\"k\"\":[1,2]}\"\n"+
+		"2,\\N,\\N,\\N,\\N,\\N\n", buf.String())
+
+	decoder, err := NewCsvDecoder(&buf, schema, config)
+	assert.Nil(t, err)
+	for _, record := range records {
+		decoded, err := decoder.Decode()
+		assert.Nil(t, err)
+		assert.Equal(t, record.String(), decoded.String())
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCsvDecoderHeaderMapping(t *testing.T) {
+	schema := newCodecTestSchema()
+
+	// the columns are mapped by name, the missing fields are null
+	str := "level;id;unknown\n7;10;x\n"
+	config := NewCsvConfig()
+	config.Delimiter = ';'
+	_, err := mustDecodeCsv(t, str, schema, config)
+	var notExistErr *FieldNotExistsError
+	assert.True(t, errors.As(err, &notExistErr))
+	assert.Equal(t, 1, err.(*RecordDecodeError).Line)
+
+	config.IgnoreUnknownColumns = true
+	decoded, err := mustDecodeCsv(t, str, schema, config)
+	assert.Nil(t, err)
+	assert.Equal(t, []DataType{Bigint(10), nil, Tinyint(7), nil, nil, nil}, decoded[0].Values)
+
+	// without header
+	config = NewCsvConfig()
+	config.Header = false
+	decoded, err = mustDecodeCsv(t, "5,,1,1748599432750123,1.5,[1]\n", schema, config)
+	assert.Nil(t, err)
+	assert.Equal(t, []DataType{Bigint(5), nil, Tinyint(1), Timestamp(1748599432750123),
+		Decimal(decimal.RequireFromString("1.5")), Json("[1]")}, decoded[0].Values)
+}
+
+func TestCsvDecoderError(t *testing.T) {
+	schema := newCodecTestSchema()
+	config := NewCsvConfig()
+
+	cases := map[string]int{
+		"id,level\n1,2\n2,300\n":        3, // out of range of TINYINT
+		"id,level\n1,2\n,3\n":           3, // not allow null
+		"id,extra\n1,\"{\"\"a\"\":\"\n": 2, // invalid json
+		"id,level\n1,2\n3\n":            3, // column size
+		"id,name\n1,\"abc\n":            2, // csv syntax
+	}
+	for str, line := range cases {
+		_, err := mustDecodeCsv(t, str, schema, config)
+		var decodeErr *RecordDecodeError
+		assert.True(t, errors.As(err, &decodeErr), str)
+		if decodeErr != nil {
+			assert.Equal(t, line, decodeErr.Line, str)
+		}
+	}
+}
+
+func mustDecodeCsv(t *testing.T, str string, schema *RecordSchema, config *CsvConfig) ([]*TupleRecord, error) {
+	decoder, err := NewCsvDecoder(strings.NewReader(str), schema, config)
+	assert.Nil(t, err)
+
+	records := make([]*TupleRecord, 0)
+	for {
+		record, err := decoder.Decode()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestJsonLinesCodec(t *testing.T) {
+	schema := newCodecTestSchema()
+	records := newCodecTestRecords(t, schema)
+
+	var buf bytes.Buffer
+	encoder := NewJsonLinesEncoder(&buf)
+	for _, record := range records {
+		assert.Nil(t, encoder.Encode(record))
+	}
+	assert.Nil(t, encoder.Flush())
+	assert.Equal(t, `{"id":1,"name":"a,\"b\"","level":3,"ts":1748599432750123,"price":"19.9","extra":{"k":[1,2]}}`+"\n"+
+		`{"id":2,"name":null,"level":null,"ts":null,"price":null,"extra":null}`+"\n", buf.String())
+
+	decoder, err := NewJsonLinesDecoder(&buf, schema)
+	assert.Nil(t, err)
+	for _, record := range records {
+		decoded, err := decoder.Decode()
+		assert.Nil(t, err)
+		assert.Equal(t, record.String(), decoded.String())
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+
+	// the blank lines are counted
+	decoder, err = NewJsonLinesDecoder(strings.NewReader("{\"id\":1}\n\n{\"id\":\"x\"}"), schema)
+	assert.Nil(t, err)
+	_, err = decoder.Decode()
+	assert.Nil(t, err)
+	_, err = decoder.Decode()
+	var decodeErr *RecordDecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.Equal(t, 3, decodeErr.Line)
+}
+
+func TestRecordEncoderSchemaNotMatch(t *testing.T) {
+	schema := newCodecTestSchema()
+	other := NewRecordSchema()
+	other.AddField(Field{Name: "id", Type: BIGINT})
+
+	encoder, err := NewCsvEncoder(io.Discard, schema, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, encoder.Encode(NewTupleRecord(other)))
+}
@@ -0,0 +1,189 @@
+package datahub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ToMap returns the typed values of the record by field name: the integers are int8, int16,
+// int32 and int64, FLOAT is float32, DOUBLE is float64, DECIMAL is string, TIMESTAMP is the
+// microseconds or the formatted string, see WithTimestampLayout, JSON is parsed, null is nil.
+func (tr *TupleRecord) ToMap(opts ...JsonParseOption) (map[string]any, error) {
+	cfg, err := getJsonParseConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if tr.RecordSchema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+
+	result := make(map[string]any, tr.RecordSchema.Size()+1)
+	for idx, field := range tr.RecordSchema.Fields {
+		val, err := tr.typedValue(idx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", field.Name, err)
+		}
+
+		if js, ok := val.(json.RawMessage); ok {
+			var obj any
+			if err := parser.Unmarshal(js, &obj); err != nil {
+				return nil, fmt.Errorf("[%s] invalid json, error:%v", field.Name, err)
+			}
+			val = obj
+		}
+		result[field.Name] = val
+	}
+
+	if cfg.withMetadata {
+		result[TupleRecordMetadataKey] = tr.BaseRecord
+	}
+	return result, nil
+}
+
+// MarshalJSON implements json.Marshaler, it is ToJson with the default options
+func (tr *TupleRecord) MarshalJSON() ([]byte, error) {
+	return tr.ToJson()
+}
+
+// ToJson encodes the record as {fieldName: typedValue} in the field order, the values are
+// typed as ToMap and the JSON fields are inlined. The result can be parsed by
+// NewTupleRecordFromJson with the same options.
+func (tr *TupleRecord) ToJson(opts ...JsonParseOption) ([]byte, error) {
+	cfg, err := getJsonParseConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if tr.RecordSchema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for idx, field := range tr.RecordSchema.Fields {
+		val, err := tr.typedValue(idx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", field.Name, err)
+		}
+
+		if err := writeJsonMember(&buf, idx > 0, field.Name, val); err != nil {
+			return nil, fmt.Errorf("[%s] %v", field.Name, err)
+		}
+	}
+
+	if cfg.withMetadata {
+		if err := writeJsonMember(&buf, tr.RecordSchema.Size() > 0, TupleRecordMetadataKey, tr.BaseRecord); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJsonMember(buf *bytes.Buffer, comma bool, key string, val any) error {
+	keyBuf, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	valBuf, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	if comma {
+		buf.WriteByte(',')
+	}
+	buf.Write(keyBuf)
+	buf.WriteByte(':')
+	buf.Write(valBuf)
+	return nil
+}
+
+// typedValue returns the value at idx as the go type of json, JSON is json.RawMessage
+func (tr *TupleRecord) typedValue(idx int, cfg *jsonParseConfig) (any, error) {
+	if idx >= len(tr.Values) {
+		return nil, nil
+	}
+
+	switch v := tr.Values[idx].(type) {
+	case nil:
+		return nil, nil
+	case Bigint:
+		return int64(v), nil
+	case Integer:
+		return int32(v), nil
+	case Smallint:
+		return int16(v), nil
+	case Tinyint:
+		return int8(v), nil
+	case Float:
+		return float32(v), nil
+	case Double:
+		return float64(v), nil
+	case Boolean:
+		return bool(v), nil
+	case String:
+		return string(v), nil
+	case Decimal:
+		return v.String(), nil
+	case Timestamp:
+		if len(cfg.timestampLayout) == 0 {
+			return uint64(v), nil
+		}
+		return time.UnixMicro(int64(v)).In(cfg.timestampLocation).Format(cfg.timestampLayout), nil
+	case Json:
+		return json.RawMessage(v), nil
+	default:
+		return nil, fmt.Errorf("value type[%T] not support", v)
+	}
+}
+
+// parseJsonTimestamp parses the formatted TIMESTAMP, see WithTimestampLayout
+func parseJsonTimestamp(val any, cfg *jsonParseConfig) (any, error) {
+	str, ok := val.(string)
+	if !ok || len(cfg.timestampLayout) == 0 {
+		return val, nil
+	}
+
+	t, err := time.ParseInLocation(cfg.timestampLayout, str, cfg.timestampLocation)
+	if err != nil {
+		return nil, err
+	}
+	return t.UnixMicro(), nil
+}
+
+// parseJsonFieldValue returns the json text of the JSON field, the string is the json text if
+// it is valid json, otherwise it is the inlined json string.
+func parseJsonFieldValue(raw json.RawMessage) (any, error) {
+	if len(raw) > 0 && raw[0] == '"' {
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return nil, err
+		}
+		if json.Valid([]byte(str)) {
+			return str, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
+}
+
+func parseJsonMetadata(br *BaseRecord, val any) error {
+	buf, err := parser.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(buf, br); err != nil {
+		return fmt.Errorf("invalid metadata, error:%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package datahub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJsonTestRecord(t *testing.T) *TupleRecord {
+	dhSchema := NewRecordSchema()
+	dhSchema.AddField(Field{Name: "f1", Type: BOOLEAN, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f2", Type: TINYINT, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f3", Type: SMALLINT, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f4", Type: INTEGER, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f5", Type: BIGINT, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f6", Type: TIMESTAMP, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f7", Type: FLOAT, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f8", Type: DOUBLE, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f9", Type: DECIMAL, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f10", Type: STRING, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f11", Type: JSON, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f12", Type: STRING, AllowNull: true})
+
+	dec, _ := decimal.NewFromString("12345678901234567890.123")
+	record := NewTupleRecord(dhSchema)
+	assert.Nil(t, record.SetValues([]DataType{
+		Boolean(true), Tinyint(-8), Smallint(1024), Integer(-123456), Bigint(6855982949904009034),
+		Timestamp(1748599432750123), Float(0.7207972), Double(0.3287779159869558), Decimal(dec),
+		String("hello \"world\""), Json(`{"a":[1,2,{"b":null}],"c":"d"}`), nil,
+	}))
+	return record
+}
+
+func TestTupleRecordToJson(t *testing.T) {
+	record := newJsonTestRecord(t)
+
+	buf, err := json.Marshal(record)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"f1":true,"f2":-8,"f3":1024,"f4":-123456,"f5":6855982949904009034,"f6":1748599432750123,`+
+		`"f7":0.7207972,"f8":0.3287779159869558,"f9":"12345678901234567890.123","f10":"hello \"world\"",`+
+		`"f11":{"a":[1,2,{"b":null}],"c":"d"},"f12":null}`, string(buf))
+
+	newRecord, err := NewTupleRecordFromJson(record.RecordSchema, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, record.Values, newRecord.Values)
+}
+
+func TestTupleRecordToJsonWithOptions(t *testing.T) {
+	record := newJsonTestRecord(t)
+	record.setMetaInfo(100, 1748599432750, 7, 0, "1", "cursor", "next")
+	record.SetAttribute("key", "value")
+
+	layout := "2006-01-02T15:04:05.000000Z07:00"
+	buf, err := record.ToJson(WithTimestampLayout(layout), WithMetadata(true))
+	assert.Nil(t, err)
+
+	obj := make(map[string]any)
+	assert.Nil(t, json.Unmarshal(buf, &obj))
+	assert.Equal(t, "2025-05-30T10:03:52.750123Z", obj["f6"])
+	assert.Equal(t, map[string]any{
+		"ShardId":    "1",
+		"SystemTime": float64(1748599432750),
+		"Sequence":   float64(100),
+		"Cursor":     "cursor",
+		"NextCursor": "next",
+		"Serial":     float64(7),
+		"Attributes": map[string]any{"key": "value"},
+	}, obj[TupleRecordMetadataKey])
+
+	newRecord, err := NewTupleRecordFromJson(record.RecordSchema, buf, WithTimestampLayout(layout), WithMetadata(true))
+	assert.Nil(t, err)
+	assert.Equal(t, record.Values, newRecord.Values)
+	assert.Equal(t, int64(100), newRecord.Sequence)
+	assert.Equal(t, "1", newRecord.ShardId)
+	assert.Equal(t, map[string]string{"key": "value"}, newRecord.Attributes)
+
+	// the metadata is not a field without the option
+	_, err = NewTupleRecordFromJson(record.RecordSchema, buf, WithTimestampLayout(layout))
+	assert.True(t, IsFieldNotExistsError(err))
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	buf, err = record.ToJson(WithTimestampLayout(layout), WithTimestampLocation(loc))
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf), `"f6":"2025-05-30T18:03:52.750123+08:00"`)
+
+	newRecord, err = NewTupleRecordFromJson(record.RecordSchema, buf, WithTimestampLayout(layout))
+	assert.Nil(t, err)
+	assert.Equal(t, record.Values, newRecord.Values)
+}
+
+func TestTupleRecordToMap(t *testing.T) {
+	record := newJsonTestRecord(t)
+
+	values, err := record.ToMap()
+	assert.Nil(t, err)
+	assert.Equal(t, true, values["f1"])
+	assert.Equal(t, int8(-8), values["f2"])
+	assert.Equal(t, int16(1024), values["f3"])
+	assert.Equal(t, int32(-123456), values["f4"])
+	assert.Equal(t, int64(6855982949904009034), values["f5"])
+	assert.Equal(t, uint64(1748599432750123), values["f6"])
+	assert.Equal(t, float32(0.7207972), values["f7"])
+	assert.Equal(t, 0.3287779159869558, values["f8"])
+	assert.Equal(t, "12345678901234567890.123", values["f9"])
+	assert.Equal(t, "hello \"world\"", values["f10"])
+	assert.Equal(t, map[string]any{
+		"a": []any{json.Number("1"), json.Number("2"), map[string]any{"b": nil}},
+		"c": "d",
+	}, values["f11"])
+	assert.Nil(t, values["f12"])
+	assert.NotContains(t, values, TupleRecordMetadataKey)
+
+	values, err = record.ToMap(WithMetadata(true))
+	assert.Nil(t, err)
+	assert.Equal(t, record.BaseRecord, values[TupleRecordMetadataKey])
+}
+
+func TestTupleRecordFromJsonInlinedJson(t *testing.T) {
+	dhSchema := NewRecordSchema()
+	dhSchema.AddField(Field{Name: "f1", Type: JSON, AllowNull: true})
+
+	cases := map[string]Json{
+		`{"f1":{"a":1}}`:     Json(`{"a":1}`),
+		`{"f1":[1,"x"]}`:     Json(`[1,"x"]`),
+		`{"f1":"{\"a\":1}"}`: Json(`{"a":1}`),
+		`{"f1":"text"}`:      Json(`"text"`),
+		`{"f1":12.50}`:       Json(`12.50`),
+		`{"f1":true}`:        Json(`true`),
+	}
+	for str, expected := range cases {
+		record, err := NewTupleRecordFromJson(dhSchema, []byte(str))
+		assert.Nil(t, err, str)
+		val, _ := record.GetValueByName("f1")
+		assert.Equal(t, expected, val, str)
+	}
+}
+
+func TestTupleRecordFromJsonIgnoreNotExistKeyOrder(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "f1", Type: BOOLEAN, AllowNull: true})
+	schema.AddField(Field{Name: "f2", Type: STRING, AllowNull: true})
+
+	// the error of an ignored key must not leak to the next key whatever the map order is
+	buf := []byte(`{"x1":1,"f1":true,"x2":2,"f2":"a","x3":3}`)
+	for i := 0; i < 20; i++ {
+		record, err := NewTupleRecordFromJson(schema, buf, WithIgnoreNotExistKey(true))
+		assert.Nil(t, err)
+		assert.Equal(t, []DataType{Boolean(true), String("a")}, record.Values)
+	}
+}
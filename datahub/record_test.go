@@ -102,3 +102,44 @@ func TestSetValueError(t *testing.T) {
 	err = record.SetValueByName("f3", 1)
 	assert.True(t, IsFieldNotExistsError(err))
 }
+
+func TestSetDecimalValueWithPrecision(t *testing.T) {
+	schema := NewRecordSchema()
+	assert.Nil(t, schema.AddDecimalField(Field{Name: "f1", Type: DECIMAL, AllowNull: true}, DecimalProp{Precision: 5, Scale: 2}))
+	record := NewTupleRecord(schema)
+
+	assert.Nil(t, record.SetValueByName("f1", "123.45"))
+	assert.Nil(t, record.SetValueByName("f1", "-999.9"))
+	assert.Nil(t, record.SetValueByName("f1", int64(999)))
+	assert.NotNil(t, record.SetValueByName("f1", "1000"))
+	assert.NotNil(t, record.SetValueByName("f1", "1.234"))
+
+	cases := []struct {
+		mode     DecimalRoundingMode
+		val      string
+		expected string
+	}{
+		{DecimalRoundHalfUp, "1.235", "1.24"},
+		{DecimalRoundHalfUp, "-1.235", "-1.24"},
+		{DecimalRoundHalfEven, "1.235", "1.24"},
+		{DecimalRoundHalfEven, "1.245", "1.24"},
+		{DecimalRoundDown, "1.239", "1.23"},
+		{DecimalRoundDown, "-1.239", "-1.23"},
+	}
+	for _, c := range cases {
+		assert.Nil(t, schema.SetDecimalRoundingMode("f1", c.mode))
+		assert.Nil(t, record.SetValueByName("f1", c.val), c.mode.String())
+		val, _ := record.GetValueByName("f1")
+		assert.Equal(t, c.expected, val.String(), c.mode.String())
+	}
+
+	// the rounded value still must fit the precision
+	assert.Nil(t, schema.SetDecimalRoundingMode("f1", DecimalRoundHalfUp))
+	assert.NotNil(t, record.SetValueByName("f1", "999.995"))
+	assert.Nil(t, schema.SetDecimalRoundingMode("f1", DecimalRoundDown))
+	assert.Nil(t, record.SetValueByName("f1", "999.995"))
+
+	// the validator checks the values set directly
+	record.Values[0] = Decimal(decimal.RequireFromString("1000"))
+	assert.NotNil(t, validateTupleValues(record))
+}
@@ -0,0 +1,122 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSchemaRefreshInterval         = 5 * time.Minute
+	defaultSchemaOnDemandRefreshInterval = time.Second
+)
+
+// SchemaCacheConfig is the config of the schema cache shared by the clients, producers and consumers
+// of the process, see SetSchemaCacheConfig.
+type SchemaCacheConfig struct {
+	Dir                        string        // directory to persist the schema versions for fast cold starts, empty means disabled
+	RefreshInterval            time.Duration // interval to refresh the schemas from server, default 5m
+	MinOnDemandRefreshInterval time.Duration // min interval of the refresh triggered by an unknown schema version, default 1s
+}
+
+func NewSchemaCacheConfig() *SchemaCacheConfig {
+	return &SchemaCacheConfig{
+		Dir:                        "",
+		RefreshInterval:            defaultSchemaRefreshInterval,
+		MinOnDemandRefreshInterval: defaultSchemaOnDemandRefreshInterval,
+	}
+}
+
+var (
+	schemaCacheConfigLock sync.RWMutex
+	schemaCacheConfig     = NewSchemaCacheConfig()
+)
+
+// SetSchemaCacheConfig sets the config of the schema cache, it takes effect for the topics
+// cached after the call, so it is supposed to be called before creating clients.
+func SetSchemaCacheConfig(config *SchemaCacheConfig) {
+	if config == nil {
+		config = NewSchemaCacheConfig()
+	}
+
+	schemaCacheConfigLock.Lock()
+	defer schemaCacheConfigLock.Unlock()
+	schemaCacheConfig = config
+}
+
+func getSchemaCacheConfig() *SchemaCacheConfig {
+	schemaCacheConfigLock.RLock()
+	defer schemaCacheConfigLock.RUnlock()
+	return schemaCacheConfig
+}
+
+// schemaCacheFile is the persisted schema versions of a topic
+type schemaCacheFile struct {
+	Project      string                      `json:"project"`
+	Topic        string                      `json:"topic"`
+	RecordType   RecordType                  `json:"recordType"`
+	EnableSchema bool                        `json:"enableSchema"`
+	Schemas      map[string]schemaCacheEntry `json:"schemas"` // keyed by the schema hash
+}
+
+type schemaCacheEntry struct {
+	VersionId int           `json:"versionId"`
+	Schema    *RecordSchema `json:"schema"`
+}
+
+func getSchemaCacheFilePath(dir, project, topic string) string {
+	return filepath.Join(dir, project, topic+".json")
+}
+
+func loadSchemaCacheFile(dir, project, topic string) (*schemaCacheFile, error) {
+	buf, err := os.ReadFile(getSchemaCacheFilePath(dir, project, topic))
+	if err != nil {
+		return nil, err
+	}
+
+	file := &schemaCacheFile{}
+	if err := json.Unmarshal(buf, file); err != nil {
+		return nil, err
+	}
+
+	if file.Project != project || file.Topic != topic {
+		return nil, fmt.Errorf("schema cache file of %s/%s not match", file.Project, file.Topic)
+	}
+
+	for hash, entry := range file.Schemas {
+		if entry.Schema == nil {
+			return nil, fmt.Errorf("schema of version %d is nil", entry.VersionId)
+		}
+		if hash != strconv.FormatUint(uint64(entry.Schema.HashCode()), 10) {
+			return nil, fmt.Errorf("schema hash of version %d not match", entry.VersionId)
+		}
+	}
+	return file, nil
+}
+
+// storeSchemaCacheFile writes the file by rename, so the readers never see a partial file
+func storeSchemaCacheFile(dir string, buf []byte, project, topic string) error {
+	path := getSchemaCacheFilePath(dir, project, topic)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), topic+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,179 @@
+package datahub
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSchemaCacheForStoreTest(t *testing.T, client DataHubApi, dir string) *topicSchemaCacheImpl {
+	config := NewSchemaCacheConfig()
+	config.Dir = dir
+	config.RefreshInterval = time.Hour
+	SetSchemaCacheConfig(config)
+	t.Cleanup(func() { SetSchemaCacheConfig(nil) })
+
+	return NewTopicSchemaCache("test_project", "test_topic", client).cache.(*topicSchemaCacheImpl)
+}
+
+func TestSchemaCacheStoreAndLoad(t *testing.T) {
+	schema1 := NewRecordSchema()
+	schema1.AddField(Field{Name: "f1", Type: BIGINT, AllowNull: false})
+	schema2 := NewRecordSchema()
+	schema2.AddField(Field{Name: "f1", Type: BIGINT, AllowNull: false})
+	schema2.AddField(Field{Name: "f2", Type: STRING, AllowNull: true, Comment: "added"})
+
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: true,
+	}, nil).Once()
+	mockClient.On("ListTopicSchema", "test_project", "test_topic").Return(&ListTopicSchemaResult{
+		SchemaInfoList: []RecordSchemaInfo{
+			{VersionId: 0, RecordSchema: *schema1},
+			{VersionId: 1, RecordSchema: *schema2},
+		},
+	}, nil).Once()
+
+	dir := t.TempDir()
+	cache := newSchemaCacheForStoreTest(t, mockClient, dir)
+	cache.init()
+	mockClient.AssertExpectations(t)
+	assert.FileExists(t, filepath.Join(dir, "test_project", "test_topic.json"))
+
+	// the cold start loads the schemas without requesting the server
+	coldClient := &MockDataHubApi{}
+	coldCache := newSchemaCacheForStoreTest(t, coldClient, dir)
+	coldCache.init()
+	coldClient.AssertExpectations(t)
+
+	assert.Equal(t, 1, coldCache.getMaxSchemaVersionId())
+	assert.Equal(t, schema2.String(), coldCache.getSchemaByVersionId(1).String())
+	assert.Equal(t, schema2.Fields, coldCache.getSchemaByVersionId(1).Fields)
+	assert.Equal(t, 0, coldCache.getVersionIdBySchema(schema1))
+	assert.Equal(t, 1, coldCache.getVersionIdBySchema(schema2))
+	assert.NotNil(t, coldCache.getAvroSchemaByVersionId(0))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), coldCache.nextFreshTime.Load().(time.Time), time.Minute)
+}
+
+func TestSchemaCacheLoadUnknownVersion(t *testing.T) {
+	schema1 := NewRecordSchema()
+	schema1.AddField(Field{Name: "f1", Type: BIGINT})
+	schema2 := NewRecordSchema()
+	schema2.AddField(Field{Name: "f1", Type: BIGINT})
+	schema2.AddField(Field{Name: "f2", Type: DOUBLE, AllowNull: true})
+
+	dir := t.TempDir()
+	buf := []byte(`{"project":"test_project","topic":"test_topic","recordType":"TUPLE","enableSchema":true,"schemas":{"` +
+		strconv.FormatUint(uint64(schema1.HashCode()), 10) + `":{"versionId":0,"schema":` + schemaFieldsJson(t, schema1) + `}}}`)
+	assert.NoError(t, storeSchemaCacheFile(dir, buf, "test_project", "test_topic"))
+
+	// the version written after the persisted schemas is refreshed on demand
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: true,
+	}, nil).Once()
+	mockClient.On("ListTopicSchema", "test_project", "test_topic").Return(&ListTopicSchemaResult{
+		SchemaInfoList: []RecordSchemaInfo{
+			{VersionId: 0, RecordSchema: *schema1},
+			{VersionId: 1, RecordSchema: *schema2},
+		},
+	}, nil).Once()
+
+	cache := newSchemaCacheForStoreTest(t, mockClient, dir)
+	cache.init()
+	assert.Equal(t, 0, cache.getMaxSchemaVersionId())
+
+	schema := cache.getSchemaByVersionId(1)
+	assert.NotNil(t, schema)
+	assert.Equal(t, schema2.HashCode(), schema.HashCode())
+	mockClient.AssertExpectations(t)
+
+	// the refreshed schemas are persisted
+	file, err := loadSchemaCacheFile(dir, "test_project", "test_topic")
+	assert.NoError(t, err)
+	assert.Len(t, file.Schemas, 2)
+}
+
+func TestSchemaCacheLoadUnknownSchema(t *testing.T) {
+	schema1 := NewRecordSchema()
+	schema1.AddField(Field{Name: "f1", Type: BIGINT})
+	schema2 := NewRecordSchema()
+	schema2.AddField(Field{Name: "f1", Type: BIGINT})
+	schema2.AddField(Field{Name: "f2", Type: DOUBLE, AllowNull: true})
+	schema3 := NewRecordSchema()
+	schema3.AddField(Field{Name: "f3", Type: STRING})
+
+	dir := t.TempDir()
+	buf := []byte(`{"project":"test_project","topic":"test_topic","recordType":"TUPLE","enableSchema":true,"schemas":{"` +
+		strconv.FormatUint(uint64(schema1.HashCode()), 10) + `":{"versionId":0,"schema":` + schemaFieldsJson(t, schema1) + `}}}`)
+	assert.NoError(t, storeSchemaCacheFile(dir, buf, "test_project", "test_topic"))
+
+	// the schema registered after the persisted schemas is refreshed on demand
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: true,
+	}, nil).Once()
+	mockClient.On("ListTopicSchema", "test_project", "test_topic").Return(&ListTopicSchemaResult{
+		SchemaInfoList: []RecordSchemaInfo{
+			{VersionId: 0, RecordSchema: *schema1},
+			{VersionId: 1, RecordSchema: *schema2},
+		},
+	}, nil).Once()
+
+	cache := newSchemaCacheForStoreTest(t, mockClient, dir)
+	cache.init()
+	assert.Equal(t, 1, cache.getVersionIdBySchema(schema2))
+	assert.NotNil(t, cache.getAvroSchema(schema2))
+
+	// the refresh is rate limited, the unknown schema does not request the server again
+	assert.Equal(t, invalidSchemaVersionId, cache.getVersionIdBySchema(schema3))
+	assert.Nil(t, cache.getAvroSchema(schema3))
+	mockClient.AssertExpectations(t)
+}
+
+func TestSchemaCacheLoadCorrupted(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "f1", Type: BIGINT})
+
+	dir := t.TempDir()
+	buf := []byte(`{"project":"test_project","topic":"test_topic","recordType":"TUPLE","enableSchema":true,"schemas":{"1":{"versionId":0,"schema":` +
+		schemaFieldsJson(t, schema) + `}}}`)
+	assert.NoError(t, storeSchemaCacheFile(dir, buf, "test_project", "test_topic"))
+
+	_, err := loadSchemaCacheFile(dir, "test_project", "test_topic")
+	assert.Error(t, err)
+
+	_, err = loadSchemaCacheFile(dir, "test_project", "other_topic")
+	assert.True(t, os.IsNotExist(err))
+
+	// the corrupted file falls back to the server
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: false,
+		RecordSchema: schema,
+	}, nil).Once()
+
+	cache := newSchemaCacheForStoreTest(t, mockClient, dir)
+	cache.init()
+	mockClient.AssertExpectations(t)
+	assert.Equal(t, schema, cache.getSchemaByVersionId(0))
+
+	file, err := loadSchemaCacheFile(dir, "test_project", "test_topic")
+	assert.NoError(t, err)
+	assert.Len(t, file.Schemas, 1)
+}
+
+func schemaFieldsJson(t *testing.T, schema *RecordSchema) string {
+	buf, err := json.Marshal(schema)
+	assert.NoError(t, err)
+	return string(buf)
+}
@@ -0,0 +1,256 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+)
+
+type CompatibilityMode string
+
+func (cm CompatibilityMode) String() string {
+	return string(cm)
+}
+
+const (
+	// BACKWARD the consumers of the new schema can read the records of the old schema
+	BACKWARD CompatibilityMode = "BACKWARD"
+
+	// FORWARD the consumers of the old schema can read the records of the new schema
+	FORWARD CompatibilityMode = "FORWARD"
+
+	// FULL both BACKWARD and FORWARD
+	FULL CompatibilityMode = "FULL"
+)
+
+type SchemaChangeType string
+
+func (sct SchemaChangeType) String() string {
+	return string(sct)
+}
+
+const (
+	FieldAdded              SchemaChangeType = "FIELD_ADDED"
+	FieldRemoved            SchemaChangeType = "FIELD_REMOVED"
+	FieldTypeChanged        SchemaChangeType = "FIELD_TYPE_CHANGED"
+	FieldNullabilityChanged SchemaChangeType = "FIELD_NULLABILITY_CHANGED"
+	FieldDecimalChanged     SchemaChangeType = "FIELD_DECIMAL_CHANGED"
+)
+
+// SchemaChange is a difference of a field between the old and new schema, fields are matched by name
+type SchemaChange struct {
+	Type       SchemaChangeType
+	FieldName  string
+	OldField   *Field      // nil if the field is added
+	NewField   *Field      // nil if the field is removed
+	OldDecimal DecimalProp // the precision and scale of a FieldDecimalChanged change
+	NewDecimal DecimalProp
+	Compatible bool
+	Reason     string // why the change breaks the mode, empty if compatible
+}
+
+func (sc SchemaChange) String() string {
+	switch sc.Type {
+	case FieldAdded:
+		return fmt.Sprintf("%s [%s] %s", sc.Type, sc.FieldName, sc.NewField.Type)
+	case FieldRemoved:
+		return fmt.Sprintf("%s [%s] %s", sc.Type, sc.FieldName, sc.OldField.Type)
+	case FieldTypeChanged:
+		return fmt.Sprintf("%s [%s] %s->%s", sc.Type, sc.FieldName, sc.OldField.Type, sc.NewField.Type)
+	case FieldDecimalChanged:
+		return fmt.Sprintf("%s [%s] %s->%s", sc.Type, sc.FieldName, sc.OldDecimal, sc.NewDecimal)
+	default:
+		return fmt.Sprintf("%s [%s] allowNull %v->%v", sc.Type, sc.FieldName, sc.OldField.AllowNull, sc.NewField.AllowNull)
+	}
+}
+
+type CompatibilityResult struct {
+	Mode    CompatibilityMode
+	Changes []SchemaChange
+}
+
+func (cr *CompatibilityResult) IsCompatible() bool {
+	for _, change := range cr.Changes {
+		if !change.Compatible {
+			return false
+		}
+	}
+	return true
+}
+
+// Incompatibilities returns the changes breaking the mode
+func (cr *CompatibilityResult) Incompatibilities() []SchemaChange {
+	changes := make([]SchemaChange, 0)
+	for _, change := range cr.Changes {
+		if !change.Compatible {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// IncompatibleSchemaError is returned by SafeRegisterTopicSchema if the schema is not
+// compatible with a registered version.
+type IncompatibleSchemaError struct {
+	VersionId int
+	Result    *CompatibilityResult
+}
+
+func (e *IncompatibleSchemaError) Error() string {
+	changes := e.Result.Incompatibilities()
+	parts := make([]string, 0, len(changes))
+	for _, change := range changes {
+		parts = append(parts, fmt.Sprintf("%s: %s", change.String(), change.Reason))
+	}
+	return fmt.Sprintf("schema is not %s compatible with version %d, %s",
+		e.Result.Mode, e.VersionId, strings.Join(parts, ", "))
+}
+
+// CheckCompatibility compares the fields of the schemas by name and reports every change,
+// a change is incompatible if a reader of the mode can not read the records:
+// a reader meets null for the missing field which must allow null, the field type may only
+// widen from the writer to the reader, e.g. TINYINT to BIGINT, FLOAT to DOUBLE, and so may
+// the precision and scale of DECIMAL, e.g. DECIMAL(10,2) to DECIMAL(12,4) or no limit.
+func CheckCompatibility(oldSchema, newSchema *RecordSchema, mode CompatibilityMode) (*CompatibilityResult, error) {
+	if oldSchema == nil || newSchema == nil {
+		return nil, fmt.Errorf("record schema is nil")
+	}
+
+	backward, forward := false, false
+	switch mode {
+	case BACKWARD:
+		backward = true
+	case FORWARD:
+		forward = true
+	case FULL:
+		backward, forward = true, true
+	default:
+		return nil, fmt.Errorf("compatibility mode %q illegal", mode)
+	}
+
+	result := &CompatibilityResult{Mode: mode, Changes: make([]SchemaChange, 0)}
+	for idx := range oldSchema.Fields {
+		oldField := &oldSchema.Fields[idx]
+		newIdx := newSchema.GetFieldIndex(oldField.Name)
+		if newIdx < 0 {
+			change := SchemaChange{Type: FieldRemoved, FieldName: oldField.Name, OldField: oldField, Compatible: true}
+			if forward && !oldField.AllowNull {
+				change.Compatible = false
+				change.Reason = "the old readers require the field"
+			}
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+
+		newField := &newSchema.Fields[newIdx]
+		if oldField.Type != newField.Type {
+			change := SchemaChange{Type: FieldTypeChanged, FieldName: oldField.Name, OldField: oldField, NewField: newField, Compatible: true}
+			if backward && !canWidenFieldType(oldField.Type, newField.Type) {
+				change.Compatible = false
+				change.Reason = fmt.Sprintf("the new readers can not read %s as %s", oldField.Type, newField.Type)
+			} else if forward && !canWidenFieldType(newField.Type, oldField.Type) {
+				change.Compatible = false
+				change.Reason = fmt.Sprintf("the old readers can not read %s as %s", newField.Type, oldField.Type)
+			}
+			result.Changes = append(result.Changes, change)
+		}
+
+		oldDecimal, newDecimal := oldSchema.GetDecimalProp(oldField.Name), newSchema.GetDecimalProp(newField.Name)
+		if oldField.Type == DECIMAL && newField.Type == DECIMAL &&
+			(oldDecimal.Precision != newDecimal.Precision || oldDecimal.Scale != newDecimal.Scale) {
+			change := SchemaChange{Type: FieldDecimalChanged, FieldName: oldField.Name, OldField: oldField, NewField: newField,
+				OldDecimal: oldDecimal, NewDecimal: newDecimal, Compatible: true}
+			if backward && !canWidenDecimal(oldDecimal, newDecimal) {
+				change.Compatible = false
+				change.Reason = fmt.Sprintf("the new readers can not read %s as %s", oldDecimal, newDecimal)
+			} else if forward && !canWidenDecimal(newDecimal, oldDecimal) {
+				change.Compatible = false
+				change.Reason = fmt.Sprintf("the old readers can not read %s as %s", newDecimal, oldDecimal)
+			}
+			result.Changes = append(result.Changes, change)
+		}
+
+		if oldField.AllowNull != newField.AllowNull {
+			change := SchemaChange{Type: FieldNullabilityChanged, FieldName: oldField.Name, OldField: oldField, NewField: newField, Compatible: true}
+			if backward && !newField.AllowNull {
+				change.Compatible = false
+				change.Reason = "the old records may have null"
+			} else if forward && !oldField.AllowNull {
+				change.Compatible = false
+				change.Reason = "the new records may have null"
+			}
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	for idx := range newSchema.Fields {
+		newField := &newSchema.Fields[idx]
+		if oldSchema.GetFieldIndex(newField.Name) >= 0 {
+			continue
+		}
+
+		change := SchemaChange{Type: FieldAdded, FieldName: newField.Name, NewField: newField, Compatible: true}
+		if backward && !newField.AllowNull {
+			change.Compatible = false
+			change.Reason = "the old records have no value of the field"
+		}
+		result.Changes = append(result.Changes, change)
+	}
+	return result, nil
+}
+
+var fieldTypeWidth = map[FieldType]int{
+	TINYINT:  1,
+	SMALLINT: 2,
+	INTEGER:  3,
+	BIGINT:   4,
+}
+
+// canWidenFieldType returns true if the values of from type can be read as to type without loss
+func canWidenFieldType(from, to FieldType) bool {
+	if from == to {
+		return true
+	}
+
+	if from == FLOAT && to == DOUBLE {
+		return true
+	}
+
+	fromWidth, fromOk := fieldTypeWidth[from]
+	toWidth, toOk := fieldTypeWidth[to]
+	return fromOk && toOk && fromWidth < toWidth
+}
+
+// SafeRegisterTopicSchema registers the schema only if it is compatible with every registered
+// version of the topic, otherwise an IncompatibleSchemaError is returned.
+func SafeRegisterTopicSchema(client DataHubApi, projectName, topicName string, recordSchema *RecordSchema,
+	mode CompatibilityMode) (*RegisterTopicSchemaResult, error) {
+	ls, err := client.ListTopicSchema(projectName, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range ls.SchemaInfoList {
+		info := &ls.SchemaInfoList[idx]
+		result, err := CheckCompatibility(&info.RecordSchema, recordSchema, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.IsCompatible() {
+			return nil, &IncompatibleSchemaError{VersionId: info.VersionId, Result: result}
+		}
+	}
+
+	return client.RegisterTopicSchema(projectName, topicName, recordSchema)
+}
+
+// canWidenDecimal returns true if the values of from precision and scale fit to without rounding
+func canWidenDecimal(from, to DecimalProp) bool {
+	if to.Precision == 0 {
+		return true
+	}
+	if from.Precision == 0 {
+		return false
+	}
+	return to.Scale >= from.Scale && to.Precision-to.Scale >= from.Precision-from.Scale
+}
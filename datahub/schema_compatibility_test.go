@@ -0,0 +1,164 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func genCompatibilitySchema(fields ...Field) *RecordSchema {
+	schema := NewRecordSchema()
+	for _, field := range fields {
+		schema.AddField(field)
+	}
+	return schema
+}
+
+func TestCheckCompatibilityAddField(t *testing.T) {
+	old := genCompatibilitySchema(Field{Name: "id", Type: BIGINT})
+	nullable := genCompatibilitySchema(Field{Name: "id", Type: BIGINT}, Field{Name: "name", Type: STRING, AllowNull: true})
+	required := genCompatibilitySchema(Field{Name: "id", Type: BIGINT}, Field{Name: "name", Type: STRING})
+
+	for _, mode := range []CompatibilityMode{BACKWARD, FORWARD, FULL} {
+		result, err := CheckCompatibility(old, nullable, mode)
+		assert.Nil(t, err)
+		assert.True(t, result.IsCompatible())
+		assert.Equal(t, 1, len(result.Changes))
+		assert.Equal(t, FieldAdded, result.Changes[0].Type)
+		assert.Equal(t, "name", result.Changes[0].FieldName)
+	}
+
+	result, err := CheckCompatibility(old, required, BACKWARD)
+	assert.Nil(t, err)
+	assert.False(t, result.IsCompatible())
+	result, err = CheckCompatibility(old, required, FORWARD)
+	assert.Nil(t, err)
+	assert.True(t, result.IsCompatible())
+}
+
+func TestCheckCompatibilityRemoveField(t *testing.T) {
+	old := genCompatibilitySchema(Field{Name: "id", Type: BIGINT}, Field{Name: "name", Type: STRING},
+		Field{Name: "extra", Type: JSON, AllowNull: true})
+	removed := genCompatibilitySchema(Field{Name: "id", Type: BIGINT})
+
+	result, err := CheckCompatibility(old, removed, BACKWARD)
+	assert.Nil(t, err)
+	assert.True(t, result.IsCompatible())
+	assert.Equal(t, 2, len(result.Changes))
+
+	result, err = CheckCompatibility(old, removed, FORWARD)
+	assert.Nil(t, err)
+	assert.False(t, result.IsCompatible())
+	incompatible := result.Incompatibilities()
+	assert.Equal(t, 1, len(incompatible))
+	assert.Equal(t, FieldRemoved, incompatible[0].Type)
+	assert.Equal(t, "name", incompatible[0].FieldName)
+}
+
+func TestCheckCompatibilityTypeAndNullability(t *testing.T) {
+	old := genCompatibilitySchema(Field{Name: "a", Type: INTEGER}, Field{Name: "b", Type: FLOAT},
+		Field{Name: "c", Type: STRING, AllowNull: true})
+	widened := genCompatibilitySchema(Field{Name: "a", Type: BIGINT}, Field{Name: "b", Type: DOUBLE},
+		Field{Name: "c", Type: STRING, AllowNull: true})
+
+	result, err := CheckCompatibility(old, widened, BACKWARD)
+	assert.Nil(t, err)
+	assert.True(t, result.IsCompatible())
+	assert.Equal(t, 2, len(result.Changes))
+	assert.Equal(t, FieldTypeChanged, result.Changes[0].Type)
+
+	result, err = CheckCompatibility(old, widened, FORWARD)
+	assert.Nil(t, err)
+	assert.False(t, result.IsCompatible())
+
+	retyped := genCompatibilitySchema(Field{Name: "a", Type: STRING}, Field{Name: "b", Type: FLOAT},
+		Field{Name: "c", Type: STRING})
+	result, err = CheckCompatibility(old, retyped, BACKWARD)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.Incompatibilities()))
+	assert.Equal(t, FieldNullabilityChanged, result.Changes[1].Type)
+
+	result, err = CheckCompatibility(widened, old, FULL)
+	assert.Nil(t, err)
+	assert.False(t, result.IsCompatible())
+
+	_, err = CheckCompatibility(old, widened, "NONE")
+	assert.NotNil(t, err)
+}
+
+func TestCheckCompatibilityDecimal(t *testing.T) {
+	genDecimalSchema := func(prop DecimalProp) *RecordSchema {
+		schema := NewRecordSchema()
+		schema.AddDecimalField(Field{Name: "amount", Type: DECIMAL}, prop)
+		return schema
+	}
+	old := genDecimalSchema(DecimalProp{Precision: 10, Scale: 2})
+
+	result, err := CheckCompatibility(old, genDecimalSchema(DecimalProp{Precision: 10, Scale: 2}), FULL)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(result.Changes))
+
+	widened := genDecimalSchema(DecimalProp{Precision: 12, Scale: 4})
+	result, err = CheckCompatibility(old, widened, BACKWARD)
+	assert.Nil(t, err)
+	assert.True(t, result.IsCompatible())
+	assert.Equal(t, 1, len(result.Changes))
+	assert.Equal(t, FieldDecimalChanged, result.Changes[0].Type)
+	assert.Equal(t, "FIELD_DECIMAL_CHANGED [amount] DECIMAL(10,2)->DECIMAL(12,4)", result.Changes[0].String())
+
+	result, err = CheckCompatibility(old, widened, FORWARD)
+	assert.Nil(t, err)
+	assert.False(t, result.IsCompatible())
+
+	// the scale is narrowed although the precision is widened
+	for _, prop := range []DecimalProp{{Precision: 12, Scale: 1}, {Precision: 9, Scale: 2}} {
+		result, err = CheckCompatibility(old, genDecimalSchema(prop), BACKWARD)
+		assert.Nil(t, err)
+		assert.False(t, result.IsCompatible())
+	}
+
+	// no limit reads every precision
+	unlimited := genDecimalSchema(DecimalProp{})
+	result, err = CheckCompatibility(old, unlimited, BACKWARD)
+	assert.Nil(t, err)
+	assert.True(t, result.IsCompatible())
+	result, err = CheckCompatibility(unlimited, old, BACKWARD)
+	assert.Nil(t, err)
+	assert.False(t, result.IsCompatible())
+}
+
+type compatibilityMockClient struct {
+	DataHubApi
+	schemas    []RecordSchemaInfo
+	registered *RecordSchema
+}
+
+func (m *compatibilityMockClient) ListTopicSchema(projectName, topicName string) (*ListTopicSchemaResult, error) {
+	return &ListTopicSchemaResult{SchemaInfoList: m.schemas}, nil
+}
+
+func (m *compatibilityMockClient) RegisterTopicSchema(projectName, topicName string, recordSchema *RecordSchema) (*RegisterTopicSchemaResult, error) {
+	m.registered = recordSchema
+	return &RegisterTopicSchemaResult{VersionId: len(m.schemas)}, nil
+}
+
+func TestSafeRegisterTopicSchema(t *testing.T) {
+	v0 := genCompatibilitySchema(Field{Name: "id", Type: BIGINT})
+	v1 := genCompatibilitySchema(Field{Name: "id", Type: BIGINT}, Field{Name: "name", Type: STRING, AllowNull: true})
+	client := &compatibilityMockClient{schemas: []RecordSchemaInfo{{VersionId: 0, RecordSchema: *v0}, {VersionId: 1, RecordSchema: *v1}}}
+
+	required := genCompatibilitySchema(Field{Name: "id", Type: BIGINT}, Field{Name: "name", Type: STRING})
+	_, err := SafeRegisterTopicSchema(client, "p", "t", required, FULL)
+	assert.NotNil(t, err)
+	incompatibleErr, ok := err.(*IncompatibleSchemaError)
+	assert.True(t, ok)
+	assert.Equal(t, 0, incompatibleErr.VersionId)
+	assert.Nil(t, client.registered)
+
+	v2 := genCompatibilitySchema(Field{Name: "id", Type: BIGINT}, Field{Name: "name", Type: STRING, AllowNull: true},
+		Field{Name: "age", Type: INTEGER, AllowNull: true})
+	res, err := SafeRegisterTopicSchema(client, "p", "t", v2, FULL)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.VersionId)
+	assert.Equal(t, v2, client.registered)
+}
@@ -0,0 +1,564 @@
+package datahub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hamba/avro/v2"
+)
+
+const (
+	// the avro field property and the json schema keyword keeping the field type
+	datahubTypeAvroProp    = "datahub.type"
+	datahubTypeJsonKeyword = "x-datahub-type"
+
+	jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// LossyMapping is a field whose type can not be represented exactly by the other schema
+// language. The exported schemas keep the field type in a custom property, so the
+// conversion back to RecordSchema is exact, but other tools ignore the property.
+type LossyMapping struct {
+	FieldName    string
+	FieldType    FieldType // the type in RecordSchema
+	ExternalType string    // the type in the avro or json schema
+	Reason       string
+}
+
+func (lm LossyMapping) String() string {
+	return fmt.Sprintf("[%s] %s <-> %s: %s", lm.FieldName, lm.FieldType, lm.ExternalType, lm.Reason)
+}
+
+// ToAvroSchema returns the avro schema json of the record schema. Comments are the docs of
+// the fields, the null allowed fields are unions with null, and the DECIMAL fields with
+// precision are bytes with the decimal logical type. See ToWireAvroSchema for the schema
+// the records are written with.
+func (rs *RecordSchema) ToAvroSchema() (string, []LossyMapping, error) {
+	lossy := make([]LossyMapping, 0)
+	avroFields := make([]*avro.Field, 0, rs.Size())
+	for _, field := range rs.Fields {
+		var schema avro.Schema
+		props := map[string]any{}
+		switch field.Type {
+		case BOOLEAN:
+			schema = avro.NewPrimitiveSchema(avro.Boolean, nil)
+		case TINYINT, SMALLINT:
+			schema = avro.NewPrimitiveSchema(avro.Int, nil)
+			props[datahubTypeAvroProp] = string(field.Type)
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "int", "avro int has a wider range"})
+		case INTEGER:
+			schema = avro.NewPrimitiveSchema(avro.Int, nil)
+		case BIGINT:
+			schema = avro.NewPrimitiveSchema(avro.Long, nil)
+		case TIMESTAMP:
+			schema = avro.NewPrimitiveSchema(avro.Long, avro.NewPrimitiveLogicalSchema(avro.TimestampMicros))
+		case FLOAT:
+			schema = avro.NewPrimitiveSchema(avro.Float, nil)
+		case DOUBLE:
+			schema = avro.NewPrimitiveSchema(avro.Double, nil)
+		case STRING:
+			schema = avro.NewPrimitiveSchema(avro.String, nil)
+		case DECIMAL:
+			if prop := rs.GetDecimalProp(field.Name); prop.Precision > 0 {
+				schema = avro.NewPrimitiveSchema(avro.Bytes, avro.NewDecimalLogicalSchema(prop.Precision, prop.Scale))
+				break
+			}
+			schema = avro.NewPrimitiveSchema(avro.String, nil)
+			props[datahubTypeAvroProp] = string(field.Type)
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "string", "decimal is written as string without precision and scale"})
+		case JSON:
+			schema = avro.NewPrimitiveSchema(avro.String, nil)
+			props[datahubTypeAvroProp] = string(field.Type)
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "string", "json is written as string"})
+		default:
+			return "", nil, fmt.Errorf("unknown field type %s", field.Type)
+		}
+
+		opts := []avro.SchemaOption{avro.WithProps(props)}
+		if len(field.Comment) > 0 {
+			opts = append(opts, avro.WithDoc(field.Comment))
+		}
+		if field.AllowNull {
+			union, err := avro.NewUnionSchema([]avro.Schema{avro.NewNullSchema(), schema})
+			if err != nil {
+				return "", nil, err
+			}
+			schema = union
+			opts = append(opts, avro.WithDefault(nil))
+		}
+
+		avroField, err := avro.NewField(field.Name, schema, opts...)
+		if err != nil {
+			return "", nil, err
+		}
+		avroFields = append(avroFields, avroField)
+	}
+
+	avroSchema, err := avro.NewRecordSchema(defaultAvroRecordName, "", avroFields)
+	if err != nil {
+		return "", nil, err
+	}
+	// String() is the canonical form without docs and properties
+	buf, err := avroSchema.MarshalJSON()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(buf), lossy, nil
+}
+
+// ToWireAvroSchema returns the avro schema json the records of the record schema are written
+// with, including the attribute field. The comments and the decimal precision are not kept,
+// and the fields whose type is read back as another type are returned as lossy.
+func (rs *RecordSchema) ToWireAvroSchema() (string, []LossyMapping, error) {
+	avroSchema, err := getAvroSchema(rs)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lossy := make([]LossyMapping, 0)
+	for _, field := range rs.Fields {
+		reason := wireLossyReason(field.Type)
+		if len(reason) == 0 {
+			continue
+		}
+
+		columnSchema, err := getAvroColumnSchema(field.Type)
+		if err != nil {
+			return "", nil, err
+		}
+		lossy = append(lossy, LossyMapping{field.Name, field.Type, string(columnSchema.Type()), reason})
+	}
+
+	// String() is the canonical form without the default of the attribute field
+	buf, err := avroSchema.(*avro.RecordSchema).MarshalJSON()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(buf), lossy, nil
+}
+
+// wireLossyReason returns why the field type is read back as another type from the wire schema
+func wireLossyReason(ft FieldType) string {
+	switch ft {
+	case TINYINT, SMALLINT:
+		return "TINYINT and SMALLINT are written as int and read as INTEGER"
+	case TIMESTAMP:
+		return "TIMESTAMP is written as long and read as BIGINT"
+	case DECIMAL:
+		return "DECIMAL is written as string and read as STRING"
+	case JSON:
+		return "JSON is written as string and read as STRING"
+	default:
+		return ""
+	}
+}
+
+// RecordSchemaFromAvro converts the avro record schema json to RecordSchema. Nested records,
+// arrays and maps become JSON fields, enums become STRING fields, other unions than
+// [null, type] and bytes without decimal logical type are not supported.
+func RecordSchemaFromAvro(schemaJson string) (*RecordSchema, []LossyMapping, error) {
+	schema, err := avro.ParseWithCache(schemaJson, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recordSchema, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return nil, nil, fmt.Errorf("avro schema type %s is not record", schema.Type())
+	}
+
+	// the wire schema of ToWireAvroSchema has the attribute field and no datahub types
+	wire := false
+	for _, avroField := range recordSchema.Fields() {
+		if avroField.Name() == defaultAvroAttributeName {
+			wire = true
+		}
+	}
+
+	lossy := make([]LossyMapping, 0)
+	dhSchema := NewRecordSchema()
+	for _, avroField := range recordSchema.Fields() {
+		if avroField.Name() == defaultAvroAttributeName {
+			continue
+		}
+
+		fieldSchema := avroField.Type()
+		allowNull := false
+		if union, ok := fieldSchema.(*avro.UnionSchema); ok {
+			if !union.Nullable() || len(union.Types()) != 2 {
+				return nil, nil, fmt.Errorf("[%s] union %s is not supported", avroField.Name(), union.String())
+			}
+			_, typIdx := union.Indices()
+			fieldSchema = union.Types()[typIdx]
+			allowNull = true
+		}
+
+		ft, loss, err := getFieldTypeFromAvro(fieldSchema)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[%s] %v", avroField.Name(), err)
+		}
+
+		if prop, ok := avroField.Prop(datahubTypeAvroProp).(string); ok && validateFieldType(FieldType(prop)) {
+			ft, loss = FieldType(prop), ""
+		} else if wire && len(loss) == 0 {
+			loss = wireReadLossyReason(ft)
+		}
+
+		field := Field{Name: avroField.Name(), Type: ft, AllowNull: allowNull, Comment: avroField.Doc()}
+		var prop DecimalProp
+		if ft == DECIMAL {
+			prop.Precision, prop.Scale = getDecimalPropFromAvro(fieldSchema)
+			if prop.Precision > maxDecimalPrecision {
+				loss = fmt.Sprintf("precision %d exceeds %d, precision and scale are dropped", prop.Precision, maxDecimalPrecision)
+				prop = DecimalProp{}
+			}
+		}
+
+		if len(loss) > 0 {
+			lossy = append(lossy, LossyMapping{avroField.Name(), ft, fieldSchema.String(), loss})
+		}
+
+		if err = dhSchema.AddDecimalField(field, prop); err != nil {
+			return nil, nil, err
+		}
+	}
+	return dhSchema, lossy, nil
+}
+
+// wireReadLossyReason returns which field types the type read from the wire schema may have been
+func wireReadLossyReason(ft FieldType) string {
+	switch ft {
+	case INTEGER:
+		return "may be TINYINT or SMALLINT written as int in the wire schema"
+	case BIGINT:
+		return "may be TIMESTAMP written as long in the wire schema"
+	case STRING:
+		return "may be DECIMAL or JSON written as string in the wire schema"
+	default:
+		return ""
+	}
+}
+
+// getFieldTypeFromAvro returns the field type and the reason if the mapping is lossy
+func getFieldTypeFromAvro(schema avro.Schema) (FieldType, string, error) {
+	switch s := schema.(type) {
+	case *avro.PrimitiveSchema:
+		var logical avro.LogicalType
+		if s.Logical() != nil {
+			logical = s.Logical().Type()
+		}
+
+		switch s.Type() {
+		case avro.Boolean:
+			return BOOLEAN, "", nil
+		case avro.Int:
+			if len(logical) > 0 {
+				return INTEGER, fmt.Sprintf("logical type %s is ignored", logical), nil
+			}
+			return INTEGER, "", nil
+		case avro.Long:
+			switch logical {
+			case "":
+				return BIGINT, "", nil
+			case avro.TimestampMicros:
+				return TIMESTAMP, "", nil
+			case avro.TimestampMillis, avro.LocalTimestampMillis:
+				return TIMESTAMP, "the values are milliseconds, TIMESTAMP is microseconds", nil
+			case avro.LocalTimestampMicros:
+				return TIMESTAMP, "the local timestamp is read as UTC", nil
+			default:
+				return BIGINT, fmt.Sprintf("logical type %s is ignored", logical), nil
+			}
+		case avro.Float:
+			return FLOAT, "", nil
+		case avro.Double:
+			return DOUBLE, "", nil
+		case avro.String:
+			if len(logical) > 0 {
+				return STRING, fmt.Sprintf("logical type %s is ignored", logical), nil
+			}
+			return STRING, "", nil
+		case avro.Bytes:
+			if logical == avro.Decimal {
+				return DECIMAL, "", nil
+			}
+		}
+	case *avro.FixedSchema:
+		if s.Logical() != nil && s.Logical().Type() == avro.Decimal {
+			return DECIMAL, "", nil
+		}
+	case *avro.EnumSchema:
+		return STRING, "enum symbols are not checked", nil
+	case *avro.RecordSchema, *avro.ArraySchema, *avro.MapSchema:
+		return JSON, "nested value is stored as json", nil
+	}
+	return "", "", fmt.Errorf("avro type %s is not supported", schema.String())
+}
+
+// getDecimalPropFromAvro returns the precision and scale of the decimal logical type, 0 if none
+func getDecimalPropFromAvro(schema avro.Schema) (int, int) {
+	var logical avro.LogicalSchema
+	switch s := schema.(type) {
+	case *avro.PrimitiveSchema:
+		logical = s.Logical()
+	case *avro.FixedSchema:
+		logical = s.Logical()
+	}
+
+	if dec, ok := logical.(*avro.DecimalLogicalSchema); ok {
+		return dec.Precision(), dec.Scale()
+	}
+	return 0, 0
+}
+
+// ToJsonSchema returns the JSON Schema (draft 2020-12) of the records in json, like the
+// input of NewTupleRecordFromJson. Comments are the descriptions and the null allowed
+// fields are not required.
+func (rs *RecordSchema) ToJsonSchema() (string, []LossyMapping, error) {
+	lossy := make([]LossyMapping, 0)
+	required := make([]string, 0)
+
+	var props bytes.Buffer
+	props.WriteString("{")
+	for idx, field := range rs.Fields {
+		prop := map[string]any{datahubTypeJsonKeyword: string(field.Type)}
+		var jsonType string
+		switch field.Type {
+		case BOOLEAN:
+			jsonType = "boolean"
+		case TINYINT:
+			jsonType = "integer"
+			prop["minimum"], prop["maximum"] = math.MinInt8, math.MaxInt8
+		case SMALLINT:
+			jsonType = "integer"
+			prop["minimum"], prop["maximum"] = math.MinInt16, math.MaxInt16
+		case INTEGER:
+			jsonType = "integer"
+			prop["minimum"], prop["maximum"] = math.MinInt32, math.MaxInt32
+		case BIGINT:
+			jsonType = "integer"
+			prop["minimum"], prop["maximum"] = -math.MaxInt64, math.MaxInt64
+		case TIMESTAMP:
+			jsonType = "integer"
+			prop["minimum"] = 0
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "integer", "timestamp is microseconds since epoch, not a date-time string"})
+		case FLOAT:
+			jsonType = "number"
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "number", "json number has no single precision"})
+		case DOUBLE:
+			jsonType = "number"
+		case STRING:
+			jsonType = "string"
+		case DECIMAL:
+			jsonType = "string"
+			prop["pattern"] = `^[-+]?[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?$`
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "string", "decimal is written as string"})
+		case JSON:
+			lossy = append(lossy, LossyMapping{field.Name, field.Type, "any", "json accepts any value"})
+		default:
+			return "", nil, fmt.Errorf("unknown field type %s", field.Type)
+		}
+
+		if len(jsonType) > 0 {
+			if field.AllowNull {
+				prop["type"] = []string{jsonType, "null"}
+			} else {
+				prop["type"] = jsonType
+			}
+		}
+		if len(field.Comment) > 0 {
+			prop["description"] = field.Comment
+		}
+		if !field.AllowNull {
+			required = append(required, field.Name)
+		}
+
+		name, _ := json.Marshal(field.Name)
+		buf, err := json.Marshal(prop)
+		if err != nil {
+			return "", nil, err
+		}
+		if idx > 0 {
+			props.WriteString(",")
+		}
+		props.Write(name)
+		props.WriteString(":")
+		props.Write(buf)
+	}
+	props.WriteString("}")
+
+	schema := struct {
+		Schema               string          `json:"$schema"`
+		Type                 string          `json:"type"`
+		Properties           json.RawMessage `json:"properties"`
+		Required             []string        `json:"required"`
+		AdditionalProperties bool            `json:"additionalProperties"`
+	}{
+		Schema:     jsonSchemaDraft,
+		Type:       "object",
+		Properties: props.Bytes(),
+		Required:   required,
+	}
+
+	buf, err := json.Marshal(schema)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(buf), lossy, nil
+}
+
+// RecordSchemaFromJsonSchema converts the JSON Schema of an object to RecordSchema in the
+// order of the properties. A property is null allowed if it is not required or its type
+// allows null. Objects, arrays and the properties without type become JSON fields.
+func RecordSchemaFromJsonSchema(schemaJson string) (*RecordSchema, []LossyMapping, error) {
+	schema := struct {
+		Type        any             `json:"type"`
+		Properties  json.RawMessage `json:"properties"`
+		Required    []string        `json:"required"`
+		Description string          `json:"description"`
+	}{}
+	if err := json.Unmarshal([]byte(schemaJson), &schema); err != nil {
+		return nil, nil, err
+	}
+
+	if schema.Type != "object" {
+		return nil, nil, fmt.Errorf("json schema type %v is not object", schema.Type)
+	}
+
+	names, props, err := parseJsonSchemaProperties(schema.Properties)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	lossy := make([]LossyMapping, 0)
+	dhSchema := NewRecordSchema()
+	for idx, name := range names {
+		prop := props[idx]
+		types, err := getJsonSchemaTypes(prop.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[%s] %v", name, err)
+		}
+
+		allowNull := !required[name]
+		nonNullTypes := make([]string, 0, len(types))
+		for _, typ := range types {
+			if typ == "null" {
+				allowNull = true
+			} else {
+				nonNullTypes = append(nonNullTypes, typ)
+			}
+		}
+
+		var ft FieldType
+		var loss string
+		if validateFieldType(FieldType(prop.DatahubType)) {
+			ft = FieldType(prop.DatahubType)
+		} else {
+			ft, loss, err = getFieldTypeFromJsonSchema(nonNullTypes, prop.Format)
+			if err != nil {
+				return nil, nil, fmt.Errorf("[%s] %v", name, err)
+			}
+		}
+
+		if len(loss) > 0 {
+			lossy = append(lossy, LossyMapping{name, ft, fmt.Sprintf("%v", prop.Type), loss})
+		}
+
+		if err = dhSchema.AddField(Field{Name: name, Type: ft, AllowNull: allowNull, Comment: prop.Description}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return dhSchema, lossy, nil
+}
+
+type jsonSchemaProperty struct {
+	Type        any    `json:"type"`
+	Format      string `json:"format"`
+	Description string `json:"description"`
+	DatahubType string `json:"x-datahub-type"`
+}
+
+// parseJsonSchemaProperties keeps the order of the properties
+func parseJsonSchemaProperties(data json.RawMessage) ([]string, []jsonSchemaProperty, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("json schema has no properties")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, nil, fmt.Errorf("json schema properties is not object")
+	}
+
+	names := make([]string, 0)
+	props := make([]jsonSchemaProperty, 0)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var prop jsonSchemaProperty
+		if err = decoder.Decode(&prop); err != nil {
+			return nil, nil, fmt.Errorf("[%v] %v", token, err)
+		}
+		names = append(names, token.(string))
+		props = append(props, prop)
+	}
+	return names, props, nil
+}
+
+func getJsonSchemaTypes(typ any) ([]string, error) {
+	switch t := typ.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{t}, nil
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("type %v illegal", typ)
+			}
+			types = append(types, s)
+		}
+		return types, nil
+	default:
+		return nil, fmt.Errorf("type %v illegal", typ)
+	}
+}
+
+// getFieldTypeFromJsonSchema returns the field type and the reason if the mapping is lossy
+func getFieldTypeFromJsonSchema(types []string, format string) (FieldType, string, error) {
+	if len(types) == 0 {
+		return JSON, "value of any type is stored as json", nil
+	}
+	if len(types) > 1 {
+		return JSON, "value of multiple types is stored as json", nil
+	}
+
+	switch types[0] {
+	case "boolean":
+		return BOOLEAN, "", nil
+	case "integer":
+		return BIGINT, "", nil
+	case "number":
+		return DOUBLE, "", nil
+	case "string":
+		if format == "date-time" {
+			return TIMESTAMP, "date-time string is stored as microseconds since epoch", nil
+		}
+		return STRING, "", nil
+	case "object", "array":
+		return JSON, "nested value is stored as json", nil
+	default:
+		return "", "", fmt.Errorf("type %s is not supported", types[0])
+	}
+}
@@ -0,0 +1,207 @@
+package datahub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func genConvertSchema() *RecordSchema {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "f_bool", Type: BOOLEAN})
+	schema.AddField(Field{Name: "f_tinyint", Type: TINYINT, AllowNull: true})
+	schema.AddField(Field{Name: "f_smallint", Type: SMALLINT})
+	schema.AddField(Field{Name: "f_integer", Type: INTEGER})
+	schema.AddField(Field{Name: "f_bigint", Type: BIGINT, Comment: "the id"})
+	schema.AddField(Field{Name: "f_timestamp", Type: TIMESTAMP, AllowNull: true})
+	schema.AddField(Field{Name: "f_float", Type: FLOAT})
+	schema.AddField(Field{Name: "f_double", Type: DOUBLE, AllowNull: true})
+	schema.AddField(Field{Name: "f_string", Type: STRING})
+	schema.AddField(Field{Name: "f_decimal", Type: DECIMAL, AllowNull: true})
+	schema.AddField(Field{Name: "f_json", Type: JSON, AllowNull: true})
+	return schema
+}
+
+func TestAvroSchemaRoundTrip(t *testing.T) {
+	schema := genConvertSchema()
+	avroJson, lossy, err := schema.ToAvroSchema()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(lossy))
+	assert.Equal(t, "f_tinyint", lossy[0].FieldName)
+	assert.Contains(t, avroJson, `"logicalType":"timestamp-micros"`)
+	assert.Contains(t, avroJson, `"doc":"the id"`)
+
+	newSchema, lossy, err := RecordSchemaFromAvro(avroJson)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lossy))
+	assert.Equal(t, schema.Fields, newSchema.Fields)
+}
+
+func TestAvroSchemaDecimalPrecision(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddDecimalField(Field{Name: "amount", Type: DECIMAL, AllowNull: true}, DecimalProp{Precision: 10, Scale: 2})
+	schema.AddDecimalField(Field{Name: "price", Type: DECIMAL}, DecimalProp{Precision: 38})
+
+	avroJson, lossy, err := schema.ToAvroSchema()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lossy))
+	assert.Contains(t, avroJson, `{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`)
+
+	newSchema, lossy, err := RecordSchemaFromAvro(avroJson)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lossy))
+	assert.Equal(t, schema.Fields, newSchema.Fields)
+	assert.Equal(t, schema.String(), newSchema.String())
+}
+
+func TestWireAvroSchemaRoundTrip(t *testing.T) {
+	schema := genConvertSchema()
+	avroJson, lossy, err := schema.ToWireAvroSchema()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(lossy))
+	assert.Equal(t, LossyMapping{"f_tinyint", TINYINT, "int", "TINYINT and SMALLINT are written as int and read as INTEGER"}, lossy[0])
+	assert.Equal(t, "f_timestamp", lossy[2].FieldName)
+	assert.Equal(t, "long", lossy[2].ExternalType)
+	assert.NotContains(t, avroJson, "the id")
+
+	// the fields read back as other types are reported
+	newSchema, lossy, err := RecordSchemaFromAvro(avroJson)
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{
+		{Name: "f_bool", Type: BOOLEAN},
+		{Name: "f_tinyint", Type: INTEGER, AllowNull: true},
+		{Name: "f_smallint", Type: INTEGER},
+		{Name: "f_integer", Type: INTEGER},
+		{Name: "f_bigint", Type: BIGINT},
+		{Name: "f_timestamp", Type: BIGINT, AllowNull: true},
+		{Name: "f_float", Type: FLOAT},
+		{Name: "f_double", Type: DOUBLE, AllowNull: true},
+		{Name: "f_string", Type: STRING},
+		{Name: "f_decimal", Type: STRING, AllowNull: true},
+		{Name: "f_json", Type: STRING, AllowNull: true},
+	}, newSchema.Fields)
+
+	lossyFields := make([]string, 0, len(lossy))
+	for _, lm := range lossy {
+		lossyFields = append(lossyFields, lm.FieldName)
+	}
+	assert.Equal(t, []string{"f_tinyint", "f_smallint", "f_integer", "f_bigint", "f_timestamp",
+		"f_string", "f_decimal", "f_json"}, lossyFields)
+	assert.Equal(t, "may be TIMESTAMP written as long in the wire schema", lossy[4].Reason)
+}
+
+func TestAvroSchemaMatchWireSchema(t *testing.T) {
+	schema := genConvertSchema()
+	avroJson, _, err := schema.ToWireAvroSchema()
+	assert.Nil(t, err)
+
+	wireSchema, err := getAvroSchema(schema)
+	assert.Nil(t, err)
+	exported, err := avro.Parse(avroJson)
+	assert.Nil(t, err)
+	assert.Equal(t, wireSchema.String(), exported.String())
+	assert.Equal(t, wireSchema.Fingerprint(), exported.Fingerprint())
+	assert.Contains(t, avroJson, `{"name":"__dh_attribute__","type":["null",{"type":"map","values":"string"}],"default":null}`)
+
+	// the records written with the wire schema are read by the exported schema
+	record := genTupleRecord(schema)
+	record.SetValueByName("f_bigint", 1)
+	record.SetValueByName("f_decimal", "1.5")
+	record.SetAttribute("k", "v")
+	ser := newDataSerializer(&topicSchemaCacheForTest{avroSchema: wireSchema, dhSchema: schema})
+	buf, err := ser.serialize([]IRecord{record})
+	assert.Nil(t, err)
+
+	var value map[string]any
+	assert.Nil(t, avro.Unmarshal(exported, buf, &value))
+	assert.Equal(t, int64(1), value["f_bigint"])
+	assert.Equal(t, "1.5", value["f_decimal"])
+	assert.Equal(t, "v", value["__dh_attribute__"].(map[string]any)["map"].(map[string]any)["k"])
+}
+
+func TestRecordSchemaFromAvro(t *testing.T) {
+	avroJson := `{"type":"record","name":"Event","fields":[
+		{"name":"id","type":"long"},
+		{"name":"ts","type":{"type":"long","logicalType":"timestamp-millis"}},
+		{"name":"amount","type":["null",{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}]},
+		{"name":"tags","type":{"type":"array","items":"string"}},
+		{"name":"color","type":{"type":"enum","name":"Color","symbols":["RED","GREEN"]}}
+	]}`
+
+	schema, lossy, err := RecordSchemaFromAvro(avroJson)
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{
+		{Name: "id", Type: BIGINT},
+		{Name: "ts", Type: TIMESTAMP},
+		{Name: "amount", Type: DECIMAL, AllowNull: true},
+		{Name: "tags", Type: JSON},
+		{Name: "color", Type: STRING},
+	}, schema.Fields)
+	assert.Equal(t, DecimalProp{Precision: 10, Scale: 2}, schema.GetDecimalProp("amount"))
+	assert.Equal(t, 3, len(lossy))
+	assert.Equal(t, "ts", lossy[0].FieldName)
+
+	schema, lossy, err = RecordSchemaFromAvro(`{"type":"record","name":"Event","fields":[
+		{"name":"v","type":{"type":"fixed","name":"F","size":20,"logicalType":"decimal","precision":40,"scale":2}}]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{{Name: "v", Type: DECIMAL}}, schema.Fields)
+	assert.Equal(t, DecimalProp{}, schema.GetDecimalProp("v"))
+	assert.Equal(t, 1, len(lossy))
+
+	_, _, err = RecordSchemaFromAvro(`{"type":"record","name":"Event","fields":[{"name":"v","type":["int","string"]}]}`)
+	assert.NotNil(t, err)
+	_, _, err = RecordSchemaFromAvro(`{"type":"record","name":"Event","fields":[{"name":"v","type":"bytes"}]}`)
+	assert.NotNil(t, err)
+	_, _, err = RecordSchemaFromAvro(`"string"`)
+	assert.NotNil(t, err)
+}
+
+func TestJsonSchemaRoundTrip(t *testing.T) {
+	schema := genConvertSchema()
+	jsonSchema, lossy, err := schema.ToJsonSchema()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(lossy))
+
+	var obj map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(jsonSchema), &obj))
+	assert.Equal(t, jsonSchemaDraft, obj["$schema"])
+	assert.Equal(t, 6, len(obj["required"].([]any)))
+
+	newSchema, lossy, err := RecordSchemaFromJsonSchema(jsonSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lossy))
+	assert.Equal(t, schema.Fields, newSchema.Fields)
+}
+
+func TestRecordSchemaFromJsonSchema(t *testing.T) {
+	jsonSchema := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "description": "user name"},
+			"age": {"type": ["integer", "null"]},
+			"score": {"type": "number"},
+			"created": {"type": "string", "format": "date-time"},
+			"profile": {"type": "object"},
+			"any": {}
+		},
+		"required": ["name", "age", "score"]
+	}`
+
+	schema, lossy, err := RecordSchemaFromJsonSchema(jsonSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, []Field{
+		{Name: "name", Type: STRING, Comment: "user name"},
+		{Name: "age", Type: BIGINT, AllowNull: true},
+		{Name: "score", Type: DOUBLE},
+		{Name: "created", Type: TIMESTAMP, AllowNull: true},
+		{Name: "profile", Type: JSON, AllowNull: true},
+		{Name: "any", Type: JSON, AllowNull: true},
+	}, schema.Fields)
+	assert.Equal(t, 3, len(lossy))
+
+	_, _, err = RecordSchemaFromJsonSchema(`{"type":"array"}`)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,162 @@
+package datahub
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaProjectionError is returned by Consumer.Read if the record can not be projected
+// onto the target schema, Record is the record as read. The record is already acked, so
+// the offset commit goes on past it whether AutoRecordAck is set or not.
+type SchemaProjectionError struct {
+	Record IRecord
+	Err    error
+}
+
+func (e *SchemaProjectionError) Error() string {
+	return fmt.Sprintf("project record failed, error:%v", e.Err)
+}
+
+func (e *SchemaProjectionError) Unwrap() error {
+	return e.Err
+}
+
+type projectionKey struct {
+	source uint32
+	target uint32
+}
+
+// projectionPlan is the source index of every target field, -1 for the added fields
+type projectionPlan struct {
+	sourceIdx []int
+}
+
+// schemaProjector converts the tuple records of every schema version to the target version,
+// the fields are matched by name and the values may widen, e.g. TINYINT to BIGINT. The
+// DECIMAL values must fit the precision and scale of the target.
+type schemaProjector struct {
+	project   string
+	topic     string
+	cache     topicSchemaCache
+	versionId int // -1 means the latest version
+
+	mutex sync.Mutex
+	plans map[projectionKey]*projectionPlan
+}
+
+func newSchemaProjector(project, topic string, cache topicSchemaCache, versionId int) *schemaProjector {
+	return &schemaProjector{
+		project:   project,
+		topic:     topic,
+		cache:     cache,
+		versionId: versionId,
+		plans:     make(map[projectionKey]*projectionPlan),
+	}
+}
+
+func (sp *schemaProjector) targetSchema() (*RecordSchema, error) {
+	versionId := sp.versionId
+	if versionId < 0 {
+		versionId = sp.cache.getMaxSchemaVersionId()
+	}
+
+	schema := sp.cache.getSchemaByVersionId(versionId)
+	if schema == nil {
+		return nil, fmt.Errorf("%s/%s schema not found, version:%d", sp.project, sp.topic, versionId)
+	}
+	return schema, nil
+}
+
+// projectRecord returns the record of the target schema, blob records are returned as is
+func (sp *schemaProjector) projectRecord(record IRecord) (IRecord, error) {
+	if sp == nil {
+		return record, nil
+	}
+
+	tupleRecord, ok := record.(*TupleRecord)
+	if !ok || tupleRecord.RecordSchema == nil {
+		return record, nil
+	}
+
+	target, err := sp.targetSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	source := tupleRecord.RecordSchema
+	if source == target || source.HashCode() == target.HashCode() {
+		return record, nil
+	}
+
+	plan, err := sp.getPlan(source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	newRecord := NewTupleRecord(target)
+	newRecord.BaseRecord = tupleRecord.BaseRecord
+	for idx, srcIdx := range plan.sourceIdx {
+		if srcIdx < 0 || srcIdx >= len(tupleRecord.Values) || tupleRecord.Values[srcIdx] == nil {
+			continue
+		}
+
+		val, err := widenValue(tupleRecord.Values[srcIdx], target.Fields[idx].Type)
+		if err == nil {
+			// a narrowed precision or scale is lossy, the values not fit are rejected
+			// or rounded by the rounding mode of the target
+			if v, ok := val.(Decimal); ok {
+				val, err = fitDecimal(target.GetDecimalProp(target.Fields[idx].Name), v)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", target.Fields[idx].Name, err)
+		}
+		newRecord.Values[idx] = val
+	}
+	return newRecord, nil
+}
+
+func (sp *schemaProjector) getPlan(source, target *RecordSchema) (*projectionPlan, error) {
+	key := projectionKey{source: source.HashCode(), target: target.HashCode()}
+
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	if plan, ok := sp.plans[key]; ok {
+		return plan, nil
+	}
+
+	plan := &projectionPlan{sourceIdx: make([]int, target.Size())}
+	for idx, field := range target.Fields {
+		srcIdx := source.GetFieldIndex(field.Name)
+		plan.sourceIdx[idx] = srcIdx
+		if srcIdx < 0 {
+			continue
+		}
+
+		srcType := source.Fields[srcIdx].Type
+		if !canWidenFieldType(srcType, field.Type) {
+			return nil, fmt.Errorf("[%s] %s can not be projected to %s", field.Name, srcType, field.Type)
+		}
+	}
+
+	log.Infof("%s/%s schema projection added, source:%s, target:%s",
+		sp.project, sp.topic, source.String(), target.String())
+	sp.plans[key] = plan
+	return plan, nil
+}
+
+// widenValue converts the value to the wider type, see canWidenFieldType
+func widenValue(val DataType, ft FieldType) (DataType, error) {
+	switch v := val.(type) {
+	case Float:
+		if ft == DOUBLE {
+			return Double(v), nil
+		}
+	case Tinyint, Smallint, Integer:
+		return validateFieldValue(ft, v)
+	}
+	return val, nil
+}
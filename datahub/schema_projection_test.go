@@ -0,0 +1,128 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func genProjectionSchemasForTest() []*RecordSchema {
+	v0 := NewRecordSchema()
+	v0.AddField(Field{Name: "id", Type: INTEGER})
+	v0.AddField(Field{Name: "score", Type: FLOAT, AllowNull: true})
+	v0.AddField(Field{Name: "dropped", Type: STRING, AllowNull: true})
+
+	v1 := NewRecordSchema()
+	v1.AddField(Field{Name: "name", Type: STRING, AllowNull: true})
+	v1.AddField(Field{Name: "id", Type: BIGINT})
+	v1.AddField(Field{Name: "score", Type: DOUBLE, AllowNull: true})
+
+	v2 := NewRecordSchema()
+	v2.AddField(Field{Name: "id", Type: TINYINT})
+	return []*RecordSchema{v0, v1, v2}
+}
+
+func TestSchemaProjectorProject(t *testing.T) {
+	schemas := genProjectionSchemasForTest()
+	projector := newSchemaProjector("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: schemas}, 1)
+
+	record := NewTupleRecord(schemas[0])
+	record.SetValueByName("id", 10)
+	record.SetValueByName("score", float32(1.5))
+	record.SetValueByName("dropped", "x")
+	record.SetAttribute("key", "val")
+	record.SetShardId("0")
+
+	newRecord, err := projector.projectRecord(record)
+	assert.Nil(t, err)
+	projected := newRecord.(*TupleRecord)
+	assert.Equal(t, schemas[1], projected.RecordSchema)
+	assert.Equal(t, []DataType{nil, Bigint(10), Double(1.5)}, projected.Values)
+	assert.Equal(t, "val", projected.Attributes["key"])
+	assert.Equal(t, "0", projected.ShardId)
+	assert.Equal(t, 1, len(projector.plans))
+
+	// the record of the target schema is returned as is
+	same := NewTupleRecord(schemas[1])
+	newRecord, err = projector.projectRecord(same)
+	assert.Nil(t, err)
+	assert.Equal(t, same, newRecord)
+
+	// blob record
+	blob := NewBlobRecord([]byte("test"))
+	newRecord, err = projector.projectRecord(blob)
+	assert.Nil(t, err)
+	assert.Equal(t, blob, newRecord)
+}
+
+func TestSchemaProjectorNarrowing(t *testing.T) {
+	schemas := genProjectionSchemasForTest()
+
+	// the latest version narrows INTEGER to TINYINT
+	projector := newSchemaProjector("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: schemas}, -1)
+	record := NewTupleRecord(schemas[0])
+	record.SetValueByName("id", 10)
+	_, err := projector.projectRecord(record)
+	assert.NotNil(t, err)
+
+	projector = newSchemaProjector("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: schemas}, 5)
+	_, err = projector.projectRecord(record)
+	assert.NotNil(t, err)
+}
+
+func TestSchemaProjectorDecimal(t *testing.T) {
+	v0 := NewRecordSchema()
+	v0.AddDecimalField(Field{Name: "amount", Type: DECIMAL}, DecimalProp{Precision: 10, Scale: 4})
+	v1 := NewRecordSchema()
+	v1.AddDecimalField(Field{Name: "amount", Type: DECIMAL}, DecimalProp{Precision: 6, Scale: 2})
+	projector := newSchemaProjector("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: []*RecordSchema{v0, v1}}, 1)
+
+	record := NewTupleRecord(v0)
+	record.SetValueByName("amount", decimal.RequireFromString("1234.5"))
+	newRecord, err := projector.projectRecord(record)
+	assert.Nil(t, err)
+	assert.True(t, decimal.RequireFromString("1234.5").Equal(decimal.Decimal(newRecord.(*TupleRecord).Values[0].(Decimal))))
+
+	// the value exceeds the narrowed precision or scale
+	for _, val := range []string{"12345.5", "1.125"} {
+		record.SetValueByName("amount", decimal.RequireFromString(val))
+		_, err = projector.projectRecord(record)
+		assert.NotNil(t, err)
+	}
+
+	// rounded by the rounding mode of the target
+	assert.Nil(t, v1.SetDecimalRoundingMode("amount", DecimalRoundHalfUp))
+	newRecord, err = projector.projectRecord(record)
+	assert.Nil(t, err)
+	assert.True(t, decimal.RequireFromString("1.13").Equal(decimal.Decimal(newRecord.(*TupleRecord).Values[0].(Decimal))))
+}
+
+func TestShardGroupReaderProjectRecord(t *testing.T) {
+	schemas := genProjectionSchemasForTest()
+	sgr := &shardGroupReader{
+		projector: newSchemaProjector("test_project", "test_topic",
+			&versionedSchemaCacheForTest{schemas: schemas}, -1),
+	}
+
+	record := NewTupleRecord(schemas[0])
+	record.SetValueByName("id", 10)
+	rk := newRecordKey("0", 1, 0, 0)
+	record.setRecordKey(rk)
+	_, err := sgr.projectRecord(record)
+	projectionErr, ok := err.(*SchemaProjectionError)
+	assert.True(t, ok)
+	assert.Equal(t, record, projectionErr.Record)
+	// the failed record is acked so that it does not stall the offset commit
+	assert.True(t, rk.isAcked())
+
+	// projection disabled
+	sgr.projector = nil
+	newRecord, err := sgr.projectRecord(record)
+	assert.Nil(t, err)
+	assert.Equal(t, record, newRecord)
+}
@@ -0,0 +1,172 @@
+package datahub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RecordsValidationError is returned by Producer when some records do not match
+// the topic schema. The invalid records are rejected individually and the valid
+// ones are still sent, like AsyncProducer does.
+type RecordsValidationError struct {
+	Errors  map[int]error // the index of the invalid records
+	Details *SendDetails  // the result of sending the valid records, nil if there is none
+}
+
+func (e *RecordsValidationError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for idx := range e.Errors {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	parts := make([]string, 0, len(indexes))
+	for _, idx := range indexes {
+		parts = append(parts, fmt.Sprintf("[%d] %v", idx, e.Errors[idx]))
+	}
+	return fmt.Sprintf("%d records are invalid: %s", len(indexes), strings.Join(parts, ", "))
+}
+
+// schemaValidator checks the records against the topic schema before they are
+// buffered, so that an invalid record does not fail the whole batch.
+type schemaValidator struct {
+	project string
+	topic   string
+	cache   topicSchemaCache
+	coerce  bool
+}
+
+func newSchemaValidator(project, topic string, cache topicSchemaCache, coerce bool) *schemaValidator {
+	return &schemaValidator{
+		project: project,
+		topic:   topic,
+		cache:   cache,
+		coerce:  coerce,
+	}
+}
+
+// validate returns the record to send, it is a new record if the record is coerced
+func (sv *schemaValidator) validate(record IRecord) (IRecord, error) {
+	if sv == nil {
+		return record, nil
+	}
+
+	maxVersionId := sv.cache.getMaxSchemaVersionId()
+	tupleRecord, isTuple := record.(*TupleRecord)
+	if maxVersionId < 0 {
+		if isTuple {
+			return nil, fmt.Errorf("%s/%s tuple record can not be written to blob topic", sv.project, sv.topic)
+		}
+		return record, nil
+	}
+
+	if !isTuple {
+		return nil, fmt.Errorf("%s/%s %T can not be written to tuple topic", sv.project, sv.topic, record)
+	}
+
+	if tupleRecord.RecordSchema == nil {
+		return nil, fmt.Errorf("%s/%s record schema is nil", sv.project, sv.topic)
+	}
+
+	versionId := sv.cache.getVersionIdBySchema(tupleRecord.RecordSchema)
+	if sv.coerce && versionId != maxVersionId {
+		latest := sv.cache.getSchemaByVersionId(maxVersionId)
+		if latest == nil {
+			return nil, fmt.Errorf("%s/%s schema not found, version:%d", sv.project, sv.topic, maxVersionId)
+		}
+		return coerceTupleRecord(tupleRecord, latest)
+	}
+
+	if versionId == invalidSchemaVersionId {
+		return nil, fmt.Errorf("%s/%s schema not found, schema:%s",
+			sv.project, sv.topic, tupleRecord.RecordSchema.String())
+	}
+
+	if err := validateTupleValues(tupleRecord); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// validateBatch returns the valid records to send, the invalid records and the error of
+// every invalid record by the index in records, the error is nil if all records are valid
+func (sv *schemaValidator) validateBatch(records []IRecord) ([]IRecord, []IRecord, *RecordsValidationError) {
+	if sv == nil {
+		return records, nil, nil
+	}
+
+	newRecords := make([]IRecord, 0, len(records))
+	invalid := make([]IRecord, 0)
+	errs := make(map[int]error)
+	for idx, record := range records {
+		newRecord, err := sv.validate(record)
+		if err != nil {
+			errs[idx] = err
+			invalid = append(invalid, record)
+			continue
+		}
+		newRecords = append(newRecords, newRecord)
+	}
+
+	if len(errs) > 0 {
+		return newRecords, invalid, &RecordsValidationError{Errors: errs}
+	}
+	return newRecords, nil, nil
+}
+
+// validateTupleValues checks the values assigned without SetValueByIdx
+func validateTupleValues(record *TupleRecord) error {
+	schema := record.RecordSchema
+	if len(record.Values) != schema.Size() {
+		return fmt.Errorf("values size not match field size(field.size=%d, values.size=%d)",
+			schema.Size(), len(record.Values))
+	}
+
+	for idx, field := range schema.Fields {
+		val := record.Values[idx]
+		if val == nil {
+			if !field.AllowNull {
+				return fmt.Errorf("[%s] not allow null", field.Name)
+			}
+			continue
+		}
+
+		if _, err := validateField(schema, &field, val); err != nil {
+			return fmt.Errorf("[%s] %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// coerceTupleRecord maps the values to the target schema by field name, the fields
+// not in the record are filled with null.
+func coerceTupleRecord(record *TupleRecord, target *RecordSchema) (*TupleRecord, error) {
+	newRecord := NewTupleRecord(target)
+	newRecord.BaseRecord = record.BaseRecord
+	newRecord.Attributes = make(map[string]string, len(record.Attributes))
+	for k, v := range record.Attributes {
+		newRecord.Attributes[k] = v
+	}
+
+	for idx, field := range record.RecordSchema.Fields {
+		if idx >= len(record.Values) || record.Values[idx] == nil {
+			continue
+		}
+
+		if target.GetFieldIndex(field.Name) < 0 {
+			return nil, fmt.Errorf("[%s] not exists in the latest schema", field.Name)
+		}
+
+		if err := newRecord.SetValueByName(field.Name, record.Values[idx]); err != nil {
+			return nil, fmt.Errorf("[%s] %v", field.Name, err)
+		}
+	}
+
+	for idx, field := range target.Fields {
+		if newRecord.Values[idx] == nil && !field.AllowNull {
+			return nil, fmt.Errorf("[%s] not allow null", field.Name)
+		}
+	}
+	return newRecord, nil
+}
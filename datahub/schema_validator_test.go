@@ -0,0 +1,167 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/hamba/avro/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedSchemaCacheForTest uses the index of schemas as version id
+type versionedSchemaCacheForTest struct {
+	schemas []*RecordSchema
+}
+
+func (vsc *versionedSchemaCacheForTest) init() {
+}
+
+func (vsc *versionedSchemaCacheForTest) getMaxSchemaVersionId() int {
+	return len(vsc.schemas) - 1
+}
+
+func (vsc *versionedSchemaCacheForTest) getSchemaByVersionId(versionId int) *RecordSchema {
+	if versionId < 0 || versionId >= len(vsc.schemas) {
+		return nil
+	}
+	return vsc.schemas[versionId]
+}
+
+func (vsc *versionedSchemaCacheForTest) getVersionIdBySchema(schema *RecordSchema) int {
+	for idx, s := range vsc.schemas {
+		if s.hashCode() == schema.hashCode() {
+			return idx
+		}
+	}
+	return invalidSchemaVersionId
+}
+
+func (vsc *versionedSchemaCacheForTest) getAvroSchema(schema *RecordSchema) avro.Schema {
+	return nil
+}
+
+func (vsc *versionedSchemaCacheForTest) getAvroSchemaByVersionId(versionId int) avro.Schema {
+	return nil
+}
+
+func genVersionedSchemasForTest() (*RecordSchema, *RecordSchema) {
+	v0 := NewRecordSchema()
+	v0.AddField(Field{Name: "f1", Type: BIGINT, AllowNull: false})
+	v1 := NewRecordSchema()
+	v1.AddField(Field{Name: "f1", Type: BIGINT, AllowNull: false})
+	v1.AddField(Field{Name: "f2", Type: STRING, AllowNull: true})
+	return v0, v1
+}
+
+func TestSchemaValidatorValidate(t *testing.T) {
+	v0, v1 := genVersionedSchemasForTest()
+	validator := newSchemaValidator("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: []*RecordSchema{v0, v1}}, false)
+
+	record := NewTupleRecord(v1)
+	record.SetValueByName("f1", 1)
+	newRecord, err := validator.validate(record)
+	assert.Nil(t, err)
+	assert.Equal(t, record, newRecord)
+
+	// not null field
+	_, err = validator.validate(NewTupleRecord(v1))
+	assert.NotNil(t, err)
+
+	// type mismatch by assigning values directly
+	record.Values[1] = Bigint(1)
+	_, err = validator.validate(record)
+	assert.NotNil(t, err)
+
+	// blob record
+	_, err = validator.validate(NewBlobRecord([]byte("test")))
+	assert.NotNil(t, err)
+
+	unknown := NewRecordSchema()
+	unknown.AddField(Field{Name: "f3", Type: STRING, AllowNull: true})
+	_, err = validator.validate(NewTupleRecord(unknown))
+	assert.NotNil(t, err)
+}
+
+func TestSchemaValidatorCoerce(t *testing.T) {
+	v0, v1 := genVersionedSchemasForTest()
+	validator := newSchemaValidator("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: []*RecordSchema{v0, v1}}, true)
+
+	record := NewTupleRecord(v0)
+	record.SetValueByName("f1", 10)
+	record.SetAttribute("key", "val")
+	record.SetShardId("2")
+
+	newRecord, err := validator.validate(record)
+	assert.Nil(t, err)
+	tupleRecord := newRecord.(*TupleRecord)
+	assert.Equal(t, v1, tupleRecord.RecordSchema)
+	assert.Equal(t, []DataType{Bigint(10), nil}, tupleRecord.Values)
+	assert.Equal(t, "val", tupleRecord.GetAttributes()["key"])
+	assert.Equal(t, "2", tupleRecord.GetBaseRecord().ShardId)
+
+	// field not in the latest schema
+	unknown := NewRecordSchema()
+	unknown.AddField(Field{Name: "f1", Type: BIGINT, AllowNull: false})
+	unknown.AddField(Field{Name: "f3", Type: STRING, AllowNull: true})
+	record = NewTupleRecord(unknown)
+	record.SetValueByName("f1", 10)
+	record.SetValueByName("f3", "test")
+	_, err = validator.validate(record)
+	assert.NotNil(t, err)
+}
+
+func TestSchemaValidatorDecimal(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddField(Field{Name: "f1", Type: DECIMAL, AllowNull: false})
+	validator := newSchemaValidator("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: []*RecordSchema{schema}}, false)
+
+	record := NewTupleRecord(schema)
+	assert.Nil(t, record.SetValueByName("f1", decimal.RequireFromString("12.345")))
+	newRecord, err := validator.validate(record)
+	assert.Nil(t, err)
+	assert.Equal(t, record, newRecord)
+
+	// type mismatch by assigning values directly
+	record.Values[0] = String("12.345")
+	_, err = validator.validate(record)
+	assert.NotNil(t, err)
+}
+
+func TestProducerRejectInvalidRecords(t *testing.T) {
+	v0, v1 := genVersionedSchemasForTest()
+	client := &producerMockClient{}
+	producer := newProducerForTest(NewProducerConfig(), client)
+	producer.validator = newSchemaValidator("test_project", "test_topic",
+		&versionedSchemaCacheForTest{schemas: []*RecordSchema{v0, v1}}, false)
+
+	valid := NewTupleRecord(v1)
+	valid.SetValueByName("f1", 1)
+	details, err := producer.Send([]IRecord{valid, NewTupleRecord(v1), valid})
+	assert.NotNil(t, err)
+	verr, ok := err.(*RecordsValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(verr.Errors))
+	assert.NotNil(t, verr.Errors[1])
+
+	// the valid records are still sent
+	assert.NotNil(t, details)
+	assert.Equal(t, details, verr.Details)
+	assert.Equal(t, 1, len(client.batches))
+	assert.Equal(t, 2, len(client.batches[0]))
+
+	// nothing is sent if all records are invalid
+	details, err = producer.SendByShard([]IRecord{NewTupleRecord(v1)}, "0")
+	assert.Nil(t, details)
+	verr, ok = err.(*RecordsValidationError)
+	assert.True(t, ok)
+	assert.Nil(t, verr.Details)
+	assert.Equal(t, 1, len(client.batches))
+
+	details, err = producer.SendByShard([]IRecord{valid}, "0")
+	assert.Nil(t, err)
+	assert.NotNil(t, details)
+	assert.Equal(t, 2, len(client.batches))
+}
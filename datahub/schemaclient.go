@@ -1,8 +1,12 @@
 package datahub
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"math"
+	"os"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -43,6 +47,7 @@ func NewTopicSchemaCache(project string, topic string, client DataHubApi) *topic
 		accessTime: now,
 		cache: &topicSchemaCacheImpl{
 			client:             client,
+			config:             getSchemaCacheConfig(),
 			project:            project,
 			topic:              topic,
 			maxSchemaVersionId: -1,
@@ -136,6 +141,7 @@ type SchemaItem struct {
 
 type topicSchemaCacheImpl struct {
 	client             DataHubApi
+	config             *SchemaCacheConfig
 	project            string
 	topic              string
 	topicResult        *GetTopicResult
@@ -143,16 +149,178 @@ type topicSchemaCacheImpl struct {
 	schemaMap          map[uint32]*SchemaItem
 	versionMap         map[int]*SchemaItem
 	nextFreshTime      atomic.Value
+	lastOnDemandTime   atomic.Int64
+	storedContent      []byte
+	storeLock          sync.Mutex
 	lock               sync.RWMutex
 }
 
 func (tsc *topicSchemaCacheImpl) init() {
+	if tsc.loadSchema() {
+		return
+	}
+
 	err := tsc.freshSchema(true)
 	if err != nil {
 		log.Warnf("%s/%s init schema cache failed, error:%v", tsc.project, tsc.topic, err)
 	}
 }
 
+func (tsc *topicSchemaCacheImpl) refreshInterval() time.Duration {
+	if tsc.config == nil || tsc.config.RefreshInterval <= 0 {
+		return defaultSchemaRefreshInterval
+	}
+	return tsc.config.RefreshInterval
+}
+
+func (tsc *topicSchemaCacheImpl) onDemandRefreshInterval() time.Duration {
+	if tsc.config == nil || tsc.config.MinOnDemandRefreshInterval <= 0 {
+		return defaultSchemaOnDemandRefreshInterval
+	}
+	return tsc.config.MinOnDemandRefreshInterval
+}
+
+func (tsc *topicSchemaCacheImpl) storeEnabled() bool {
+	return tsc.config != nil && len(tsc.config.Dir) > 0
+}
+
+// loadSchema loads the persisted schema versions, the server is not requested until the next refresh
+func (tsc *topicSchemaCacheImpl) loadSchema() bool {
+	if !tsc.storeEnabled() {
+		return false
+	}
+
+	file, err := loadSchemaCacheFile(tsc.config.Dir, tsc.project, tsc.topic)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("%s/%s load schema cache failed, error:%v", tsc.project, tsc.topic, err)
+		}
+		return false
+	}
+
+	schemaMap := make(map[uint32]*SchemaItem)
+	versionMap := make(map[int]*SchemaItem)
+	maxVersion := -1
+	for _, entry := range file.Schemas {
+		avroSchema, err := getAvroSchema(entry.Schema)
+		if err != nil {
+			log.Warnf("%s/%s load schema cache failed, error:%v", tsc.project, tsc.topic, err)
+			return false
+		}
+
+		item := &SchemaItem{
+			versionId:  entry.VersionId,
+			dhSchema:   entry.Schema,
+			avroSchema: avroSchema,
+		}
+		versionMap[entry.VersionId] = item
+		schemaMap[entry.Schema.HashCode()] = item
+		if entry.VersionId > maxVersion {
+			maxVersion = entry.VersionId
+		}
+	}
+
+	topicResult := &GetTopicResult{
+		ProjectName:  tsc.project,
+		TopicName:    tsc.topic,
+		RecordType:   file.RecordType,
+		EnableSchema: file.EnableSchema,
+	}
+	if item, ok := versionMap[0]; ok && !file.EnableSchema {
+		topicResult.RecordSchema = item.dhSchema
+	}
+
+	tsc.lock.Lock()
+	tsc.topicResult = topicResult
+	tsc.maxSchemaVersionId = maxVersion
+	tsc.schemaMap = schemaMap
+	tsc.versionMap = versionMap
+	tsc.lock.Unlock()
+
+	tsc.nextFreshTime.Store(time.Now().Add(tsc.refreshInterval()))
+	log.Infof("%s/%s load schema cache success, maxSchemaVersion:%d", tsc.project, tsc.topic, maxVersion)
+	return true
+}
+
+// storeSchema persists the schema versions if they are changed since the last store
+func (tsc *topicSchemaCacheImpl) storeSchema() {
+	if !tsc.storeEnabled() {
+		return
+	}
+
+	tsc.lock.RLock()
+	file := &schemaCacheFile{
+		Project:      tsc.project,
+		Topic:        tsc.topic,
+		RecordType:   tsc.topicResult.RecordType,
+		EnableSchema: tsc.topicResult.EnableSchema,
+		Schemas:      make(map[string]schemaCacheEntry),
+	}
+	if file.RecordType != BLOB {
+		for _, item := range tsc.versionMap {
+			file.Schemas[strconv.FormatUint(uint64(item.dhSchema.HashCode()), 10)] = schemaCacheEntry{
+				VersionId: item.versionId,
+				Schema:    item.dhSchema,
+			}
+		}
+	}
+	tsc.lock.RUnlock()
+
+	buf, err := json.Marshal(file)
+	if err != nil {
+		log.Warnf("%s/%s store schema cache failed, error:%v", tsc.project, tsc.topic, err)
+		return
+	}
+
+	tsc.storeLock.Lock()
+	defer tsc.storeLock.Unlock()
+	if bytes.Equal(buf, tsc.storedContent) {
+		return
+	}
+
+	if err := storeSchemaCacheFile(tsc.config.Dir, buf, tsc.project, tsc.topic); err != nil {
+		log.Warnf("%s/%s store schema cache failed, error:%v", tsc.project, tsc.topic, err)
+		return
+	}
+	tsc.storedContent = buf
+	log.Infof("%s/%s store schema cache success", tsc.project, tsc.topic)
+}
+
+// freshUnknownVersion refreshes the schemas if the version is not cached, e.g. the schema
+// is registered after the last refresh, or the persisted schemas are stale.
+func (tsc *topicSchemaCacheImpl) freshUnknownVersion(versionId int) {
+	tsc.freshOnDemand(fmt.Sprintf("schema version %d", versionId))
+}
+
+// freshUnknownSchema refreshes the schemas if the schema is not cached, like freshUnknownVersion
+func (tsc *topicSchemaCacheImpl) freshUnknownSchema(schema *RecordSchema) {
+	tsc.freshOnDemand(fmt.Sprintf("schema %d", schema.hashCode()))
+}
+
+// freshOnDemand refreshes the schemas at most once in onDemandRefreshInterval
+func (tsc *topicSchemaCacheImpl) freshOnDemand(unknown string) {
+	tsc.lock.RLock()
+	isBlob := tsc.topicResult != nil && tsc.topicResult.RecordType == BLOB
+	tsc.lock.RUnlock()
+	if isBlob {
+		return
+	}
+
+	last := tsc.lastOnDemandTime.Load()
+	now := time.Now()
+	if now.Sub(time.UnixMilli(last)) < tsc.onDemandRefreshInterval() {
+		return
+	}
+	if !tsc.lastOnDemandTime.CompareAndSwap(last, now.UnixMilli()) {
+		return
+	}
+
+	log.Infof("%s/%s %s not found, fresh schema", tsc.project, tsc.topic, unknown)
+	if err := tsc.freshSchema(true); err != nil {
+		log.Warnf("%s/%s fresh schema failed, error:%v", tsc.project, tsc.topic, err)
+	}
+}
+
 func (tsc *topicSchemaCacheImpl) freshNomalSchema(topicResult *GetTopicResult) error {
 	tsc.lock.RLock()
 	needUpdate := false
@@ -260,26 +428,33 @@ func (tsc *topicSchemaCacheImpl) freshSchema(force bool) error {
 	}
 
 	// pervent fresh shard by multi goroutine
-	newNextTime := time.Now().Add(time.Duration(5) * time.Minute)
+	newNextTime := time.Now().Add(tsc.refreshInterval())
 	if !tsc.nextFreshTime.CompareAndSwap(nextTime, newNextTime) {
 		return nil
 	}
 
-	var err error
-	tsc.topicResult, err = tsc.client.GetTopic(tsc.project, tsc.topic)
+	topicResult, err := tsc.client.GetTopic(tsc.project, tsc.topic)
 	if err != nil {
 		return err
 	}
 
-	if tsc.topicResult.RecordType == BLOB {
-		return nil
+	tsc.lock.Lock()
+	tsc.topicResult = topicResult
+	tsc.lock.Unlock()
+
+	if topicResult.RecordType != BLOB {
+		if !topicResult.EnableSchema {
+			err = tsc.freshNomalSchema(topicResult)
+		} else {
+			err = tsc.freshMultiSchema()
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	if !tsc.topicResult.EnableSchema {
-		return tsc.freshNomalSchema(tsc.topicResult)
-	} else {
-		return tsc.freshMultiSchema()
-	}
+	tsc.storeSchema()
+	return nil
 }
 
 func (tsc *topicSchemaCacheImpl) getMaxSchemaVersionId() int {
@@ -294,17 +469,26 @@ func (tsc *topicSchemaCacheImpl) getSchemaByVersionId(versionId int) *RecordSche
 	tsc.freshSchema(false)
 
 	if versionId >= 0 {
-		tsc.lock.RLock()
-		defer tsc.lock.RUnlock()
+		item := tsc.getSchemaItem(versionId)
+		if item == nil {
+			tsc.freshUnknownVersion(versionId)
+			item = tsc.getSchemaItem(versionId)
+		}
 
-		if schemaItem, ok := tsc.versionMap[versionId]; ok {
-			return schemaItem.dhSchema
+		if item != nil {
+			return item.dhSchema
 		}
 	}
 
 	return nil
 }
 
+func (tsc *topicSchemaCacheImpl) getSchemaItem(versionId int) *SchemaItem {
+	tsc.lock.RLock()
+	defer tsc.lock.RUnlock()
+	return tsc.versionMap[versionId]
+}
+
 func (tsc *topicSchemaCacheImpl) getVersionIdBySchema(schema *RecordSchema) int {
 	if schema == nil {
 		return blobSchemaVersionId
@@ -312,21 +496,32 @@ func (tsc *topicSchemaCacheImpl) getVersionIdBySchema(schema *RecordSchema) int
 
 	tsc.freshSchema(false)
 	tsc.lock.RLock()
-	defer tsc.lock.RUnlock()
-
 	// maybe schema has been freshed after append field,
 	// but the old schema is still in use for writing, so return 0 directly
-	if !tsc.topicResult.EnableSchema {
+	enableSchema := tsc.topicResult.EnableSchema
+	tsc.lock.RUnlock()
+	if !enableSchema {
 		return 0
 	}
 
-	if schemaItem, ok := tsc.schemaMap[schema.hashCode()]; ok {
-		return schemaItem.versionId
+	item := tsc.getSchemaItemBySchema(schema)
+	if item == nil {
+		tsc.freshUnknownSchema(schema)
+		item = tsc.getSchemaItemBySchema(schema)
 	}
 
+	if item != nil {
+		return item.versionId
+	}
 	return invalidSchemaVersionId
 }
 
+func (tsc *topicSchemaCacheImpl) getSchemaItemBySchema(schema *RecordSchema) *SchemaItem {
+	tsc.lock.RLock()
+	defer tsc.lock.RUnlock()
+	return tsc.schemaMap[schema.hashCode()]
+}
+
 func (tsc *topicSchemaCacheImpl) getAvroSchema(schema *RecordSchema) avro.Schema {
 	if schema == nil {
 		return getAvroBlobSchema()
@@ -334,12 +529,15 @@ func (tsc *topicSchemaCacheImpl) getAvroSchema(schema *RecordSchema) avro.Schema
 
 	tsc.freshSchema(false)
 
-	tsc.lock.RLock()
-	defer tsc.lock.RUnlock()
-	if item, ok := tsc.schemaMap[schema.hashCode()]; ok {
-		return item.avroSchema
+	item := tsc.getSchemaItemBySchema(schema)
+	if item == nil {
+		tsc.freshUnknownSchema(schema)
+		item = tsc.getSchemaItemBySchema(schema)
 	}
 
+	if item != nil {
+		return item.avroSchema
+	}
 	return nil
 }
 
@@ -350,11 +548,14 @@ func (tsc *topicSchemaCacheImpl) getAvroSchemaByVersionId(versionId int) avro.Sc
 
 	tsc.freshSchema(false)
 
-	tsc.lock.RLock()
-	defer tsc.lock.RUnlock()
-	if item, ok := tsc.versionMap[versionId]; ok {
-		return item.avroSchema
+	item := tsc.getSchemaItem(versionId)
+	if item == nil {
+		tsc.freshUnknownVersion(versionId)
+		item = tsc.getSchemaItem(versionId)
 	}
 
+	if item != nil {
+		return item.avroSchema
+	}
 	return nil
 }
@@ -313,9 +313,20 @@ func TestTopicSchemaCacheImpl_GetSchemaByVersionId(t *testing.T) {
 	testSchema := NewRecordSchema()
 	testSchema.AddField(*NewField("test_field", INTEGER))
 
+	// the unknown version triggers a refresh, at most once per second
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: true,
+	}, nil).Once()
+	mockClient.On("ListTopicSchema", "test_project", "test_topic").Return(&ListTopicSchemaResult{
+		SchemaInfoList: []RecordSchemaInfo{{VersionId: 1, RecordSchema: *testSchema}},
+	}, nil).Once()
+
 	var freshTime atomic.Value
 	freshTime.Store(time.Now().Add(time.Minute))
 	cacheImpl := &topicSchemaCacheImpl{
+		client:        mockClient,
 		project:       "test_project",
 		topic:         "test_topic",
 		schemaMap:     make(map[uint32]*SchemaItem),
@@ -332,6 +343,9 @@ func TestTopicSchemaCacheImpl_GetSchemaByVersionId(t *testing.T) {
 	// Test not finding version
 	schema = cacheImpl.getSchemaByVersionId(999)
 	assert.Nil(t, schema)
+	schema = cacheImpl.getSchemaByVersionId(999)
+	assert.Nil(t, schema)
+	mockClient.AssertExpectations(t)
 
 	// Test negative version number
 	schema = cacheImpl.getSchemaByVersionId(-1)
@@ -343,10 +357,21 @@ func TestTopicSchemaCacheImpl_GetVersionIdBySchema(t *testing.T) {
 	testSchema.AddField(*NewField("test_field", INTEGER))
 	hash := testSchema.hashCode()
 
+	// the unknown schema triggers a refresh, at most once per second
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: true,
+	}, nil).Once()
+	mockClient.On("ListTopicSchema", "test_project", "test_topic").Return(&ListTopicSchemaResult{
+		SchemaInfoList: []RecordSchemaInfo{{VersionId: 1, RecordSchema: *testSchema}},
+	}, nil).Once()
+
 	var freshTime atomic.Value
 	freshTime.Store(time.Now().Add(time.Minute))
 
 	cacheImpl := &topicSchemaCacheImpl{
+		client:  mockClient,
 		project: "test_project",
 		topic:   "test_topic",
 		schemaMap: map[uint32]*SchemaItem{
@@ -364,6 +389,9 @@ func TestTopicSchemaCacheImpl_GetVersionIdBySchema(t *testing.T) {
 	// Test not finding schema
 	versionId = cacheImpl.getVersionIdBySchema(&RecordSchema{})
 	assert.Equal(t, invalidSchemaVersionId, versionId)
+	versionId = cacheImpl.getVersionIdBySchema(&RecordSchema{})
+	assert.Equal(t, invalidSchemaVersionId, versionId)
+	mockClient.AssertExpectations(t)
 
 	// Test passing nil schema
 	versionId = cacheImpl.getVersionIdBySchema(nil)
@@ -403,10 +431,20 @@ func TestTopicSchemaCacheImpl_GetAvroSchemaByVersionId(t *testing.T) {
 	testSchema.AddField(*NewField("test_field", INTEGER))
 	testAvroSchema, _ := getAvroSchema(testSchema)
 
+	mockClient := &MockDataHubApi{}
+	mockClient.On("GetTopic", "test_project", "test_topic").Return(&GetTopicResult{
+		RecordType:   TUPLE,
+		EnableSchema: true,
+	}, nil).Once()
+	mockClient.On("ListTopicSchema", "test_project", "test_topic").Return(&ListTopicSchemaResult{
+		SchemaInfoList: []RecordSchemaInfo{{VersionId: 1, RecordSchema: *testSchema}},
+	}, nil).Once()
+
 	var freshTime atomic.Value
 	freshTime.Store(time.Now().Add(time.Minute))
 
 	cacheImpl := &topicSchemaCacheImpl{
+		client:        mockClient,
 		project:       "test_project",
 		topic:         "test_topic",
 		nextFreshTime: freshTime,
@@ -558,12 +596,12 @@ func TestFreshSchemaWithAppendField(t *testing.T) {
 	assert.Equal(t, cacheImpl.getVersionIdBySchema(oldSchema), 0)
 	avroSchema1 := cacheImpl.getAvroSchema(oldSchema)
 	assert.Equal(t, avroSchema1, odlAvroSchema)
-	avroSchema2 := cacheImpl.getAvroSchema(newSchema)
-	assert.Nil(t, avroSchema2)
 	avroSchema3 := cacheImpl.getAvroSchemaByVersionId(0)
 	assert.Equal(t, avroSchema3, odlAvroSchema)
 
-	cacheImpl.freshSchema(true)
+	// the unknown schema refreshes the appended field on demand
+	avroSchema2 := cacheImpl.getAvroSchema(newSchema)
+	assert.Equal(t, avroSchema2, newAvroSchema)
 	assert.Equal(t, len(cacheImpl.versionMap), 1)
 	assert.Equal(t, len(cacheImpl.schemaMap), 2)
 	assert.Equal(t, cacheImpl.maxSchemaVersionId, 0)
@@ -674,12 +712,12 @@ func TestFreshSchemaWithAddNewSchema(t *testing.T) {
 	assert.Equal(t, avro2, avroSchema2)
 	avro2 = cacheImpl.getAvroSchemaByVersionId(1)
 	assert.Equal(t, avro2, avroSchema2)
+
+	// the unknown schema triggers a refresh
 	avro3 := cacheImpl.getAvroSchema(schema3)
-	assert.Equal(t, avro3, nil)
+	assert.Equal(t, avro3, avroSchema3)
 	avro3 = cacheImpl.getAvroSchemaByVersionId(2)
-	assert.Equal(t, avro3, nil)
-
-	cacheImpl.freshSchema(true)
+	assert.Equal(t, avro3, avroSchema3)
 	assert.Equal(t, len(cacheImpl.versionMap), 3)
 	assert.Equal(t, len(cacheImpl.schemaMap), 3)
 	assert.Equal(t, cacheImpl.maxSchemaVersionId, 2)
@@ -17,6 +17,8 @@ type shardGroupReader struct {
 	client        DataHubApi
 	offsetManager *offsetManager
 	config        *ConsumerConfig
+	limiter       *rateLimiter
+	projector     *schemaProjector
 
 	mu      sync.RWMutex
 	readers []*shardReader
@@ -39,10 +41,15 @@ func newShardGroupReader(project, topic string, client DataHubApi,
 		client:        client,
 		offsetManager: offsetManager,
 		config:        config,
+		limiter:       newRateLimiter(config.ShardRateLimit, config.TopicRateLimit),
 		readers:       make([]*shardReader, 0),
 		recordChan:    make(chan IRecord, config.BufferNumber),
 		stopCh:        make(chan struct{}),
 	}
+	if config.EnableProjection {
+		cache := schemaClientInstance().getTopicSchemaCache(project, topic, client)
+		sgr.projector = newSchemaProjector(project, topic, cache, config.ProjectVersion)
+	}
 	return sgr
 }
 
@@ -87,7 +94,7 @@ func (sgr *shardGroupReader) addShards(shardIds []string, offsets map[string]Sub
 		reader := newShardReader(
 			sgr.project, sgr.topic, shardId,
 			sgr.client, sgr.offsetManager,
-			sgr.config,
+			sgr.config, sgr.limiter,
 		)
 
 		if err := reader.start(offset); err != nil {
@@ -138,7 +145,7 @@ func (sgr *shardGroupReader) read(timeout time.Duration) (IRecord, error) {
 		select {
 		case record := <-sgr.recordChan:
 			sgr.handleRecord(record)
-			return record, nil
+			return sgr.projectRecord(record)
 		default:
 			return nil, nil
 		}
@@ -148,7 +155,7 @@ func (sgr *shardGroupReader) read(timeout time.Duration) (IRecord, error) {
 	select {
 	case record := <-sgr.recordChan:
 		sgr.handleRecord(record)
-		return record, nil
+		return sgr.projectRecord(record)
 	case <-time.After(timeout):
 		return nil, nil
 	}
@@ -183,7 +190,7 @@ func (sgr *shardGroupReader) doFetch() {
 
 		records, err := r.tryFetch()
 		if err != nil {
-			if !IsShardSealedError(err) {
+			if !IsShardSealedError(err) && err != errShardReaderStopped {
 				log.Warnf("%s/%s/%s Fetch failed: %v", sgr.project, sgr.topic, r.shardId, err)
 			}
 		} else if len(records) > 0 {
@@ -245,6 +252,18 @@ func (sgr *shardGroupReader) handleRecord(record IRecord) {
 	}
 }
 
+func (sgr *shardGroupReader) projectRecord(record IRecord) (IRecord, error) {
+	newRecord, err := sgr.projector.projectRecord(record)
+	if err != nil {
+		// the record is skipped, it must not stall the offset commit without AutoRecordAck
+		if record.GetRecordKey() != nil {
+			record.GetRecordKey().Ack()
+		}
+		return nil, &SchemaProjectionError{Record: record, Err: err}
+	}
+	return newRecord, nil
+}
+
 func (sgr *shardGroupReader) getHoldShards() []string {
 	sgr.mu.RLock()
 	defer sgr.mu.RUnlock()
@@ -277,7 +296,13 @@ func (sgr *shardGroupReader) stop() {
 	close(sgr.stopCh)
 	sgr.wg.Wait()
 
-	// Wait for all inflight fetch goroutines to finish
+	// Interrupt the throttled fetches, then wait for all inflight fetch goroutines to finish
+	sgr.mu.Lock()
+	for _, reader := range sgr.readers {
+		reader.stop()
+	}
+	sgr.mu.Unlock()
+
 	for sgr.flying.Load() > 0 {
 		time.Sleep(10 * time.Millisecond)
 	}
@@ -286,9 +311,6 @@ func (sgr *shardGroupReader) stop() {
 	sgr.mu.Lock()
 	defer sgr.mu.Unlock()
 
-	for _, reader := range sgr.readers {
-		reader.stop()
-	}
 	sgr.readers = nil
 	close(sgr.recordChan)
 	log.Infof("%s/%s close readers and channel took %v", sgr.project, sgr.topic, time.Since(t2))
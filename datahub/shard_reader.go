@@ -1,6 +1,8 @@
 package datahub
 
 import (
+	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,16 +18,21 @@ type shardReader struct {
 	client        DataHubApi
 	offsetManager *offsetManager
 	config        *ConsumerConfig
+	limiter       *rateLimiter
 
 	cursor         string
 	sealed         atomic.Bool // close shard read end
 	fetching       atomic.Bool
 	lastSystemTime atomic.Int64
 	nextReadyTime  atomic.Int64 // timestamp when reader is ready after empty fetch
+	stopCh         chan struct{}
+	stopOnce       sync.Once
 }
 
+var errShardReaderStopped = fmt.Errorf("shardReader stopped")
+
 func newShardReader(project, topic, shardId string, client DataHubApi,
-	offsetManager *offsetManager, config *ConsumerConfig) *shardReader {
+	offsetManager *offsetManager, config *ConsumerConfig, limiter *rateLimiter) *shardReader {
 	return &shardReader{
 		project:       project,
 		topic:         topic,
@@ -33,6 +40,8 @@ func newShardReader(project, topic, shardId string, client DataHubApi,
 		client:        client,
 		offsetManager: offsetManager,
 		config:        config,
+		limiter:       limiter,
+		stopCh:        make(chan struct{}),
 	}
 }
 
@@ -60,7 +69,22 @@ func (sr *shardReader) start(offset SubscriptionOffset) error {
 }
 
 func (sr *shardReader) stop() {
-	// nothing to do
+	sr.stopOnce.Do(func() {
+		close(sr.stopCh)
+	})
+}
+
+// sleep waits for the duration, returns false if the reader is stopped meanwhile
+func (sr *shardReader) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-sr.stopCh:
+		return false
+	}
 }
 
 func (sr *shardReader) tryFetch() ([]IRecord, error) {
@@ -88,7 +112,9 @@ func (sr *shardReader) tryFetch() ([]IRecord, error) {
 
 		lastErr = err
 		if i < sr.config.MaxRetry || sr.config.MaxRetry < 0 {
-			time.Sleep(sr.config.RetryInterval)
+			if !sr.sleep(sr.config.RetryInterval) {
+				return nil, errShardReaderStopped
+			}
 		}
 	}
 
@@ -98,6 +124,14 @@ func (sr *shardReader) tryFetch() ([]IRecord, error) {
 func (sr *shardReader) fetch() ([]IRecord, error) {
 	cursor := sr.cursor
 
+	// the size of the records is unknown before fetching, so the fetched records
+	// are charged afterwards and the next fetch waits for them
+	if delay := sr.limiter.reserve(sr.shardId, 0, 0); delay > 0 {
+		if !sr.sleep(delay) {
+			return nil, errShardReaderStopped
+		}
+	}
+
 	// getSchemaByVersionId(0): returns nil for blob, schema for tuple
 	schemaCache := schemaClientInstance().getTopicSchemaCache(sr.project, sr.topic, sr.client)
 	schema := schemaCache.getSchemaByVersionId(0)
@@ -132,6 +166,7 @@ func (sr *shardReader) fetch() ([]IRecord, error) {
 	sr.lastSystemTime.Store(lastRecord.GetSystemTime())
 
 	sr.cursor = result.NextCursor
+	sr.limiter.reserve(sr.shardId, len(result.Records), int(batchSize(result.Records)))
 
 	records := make([]IRecord, len(result.Records))
 	for i, record := range result.Records {
@@ -141,7 +176,7 @@ func (sr *shardReader) fetch() ([]IRecord, error) {
 		records[i] = record
 	}
 
-	return records, nil
+	return sr.offsetManager.filterDuplicates(sr.shardId, records), nil
 }
 
 func (sr *shardReader) isSealed() bool {
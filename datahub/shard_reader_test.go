@@ -116,7 +116,7 @@ func TestShardReader(t *testing.T) {
 
 	sr := newShardReader(
 		"test-project", "test-topic", "0",
-		mockClient, mockOffsetManager, cfg,
+		mockClient, mockOffsetManager, cfg, nil,
 	)
 
 	// Add shard to offset manager first
@@ -143,7 +143,7 @@ func TestShardReaderSealed(t *testing.T) {
 
 	sr := newShardReader(
 		"test-project", "test-topic", "0",
-		mockClient, mockOffsetManager, cfg,
+		mockClient, mockOffsetManager, cfg, nil,
 	)
 
 	mockOffsetManager.addShards([]string{"0"})
@@ -155,3 +155,31 @@ func TestShardReaderSealed(t *testing.T) {
 	// Initially not sealed
 	assert.False(t, sr.isSealed())
 }
+
+func TestShardReaderStopInterruptsThrottle(t *testing.T) {
+	mockClient := newShardReaderMockClient()
+	mockOffsetManager := newOffsetManager("test-project", "test-topic", "test-sub", mockClient, 10*time.Second)
+
+	limiter := newRateLimiter(RateLimit{RecordsPerSecond: 1}, RateLimit{})
+	limiter.reserve("0", 100, 0)
+	sr := newShardReader(
+		"test-project", "test-topic", "0",
+		mockClient, mockOffsetManager, NewConsumerConfig(), limiter,
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := sr.tryFetch()
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	sr.stop()
+	select {
+	case err := <-done:
+		assert.Equal(t, errShardReaderStopped, err)
+	case <-time.After(time.Second):
+		t.Fatal("stop did not interrupt the throttle wait")
+	}
+	assert.Equal(t, 0, mockClient.GetCallCount("GetTupleRecords")+mockClient.GetCallCount("GetBlobRecords"))
+}
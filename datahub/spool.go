@@ -0,0 +1,336 @@
+package datahub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	spoolFileSuffix    = ".spool"
+	spoolTmpFileSuffix = ".tmp"
+	spoolReplayBackoff = 5 * time.Second
+)
+
+// SpoolStats describes the batches currently persisted in the spool directory
+type SpoolStats struct {
+	Batches  int
+	Records  int
+	Bytes    int64
+	Rejected int64 // batches rejected because the spool was full
+}
+
+type spoolEntry struct {
+	seq         uint64
+	shardId     string
+	path        string
+	size        int64
+	recordCount int
+	attempts    int  // the requests sent for the batch, reported to DeadLetterSink
+	inflight    bool // owned by a writer in durable mode, not visible to replay
+}
+
+// diskSpool is a write-ahead directory of serialized batches, one file per batch.
+// The file name is "<seq>_<shardId>_<attempts>.spool", so the replay order and the
+// attempts survive restarts. The files of old versions have no attempts.
+type diskSpool struct {
+	dir          string
+	maxBytes     int64
+	serializer   *batchSerializer
+	schemaCache  topicSchemaCache
+	mutex        sync.Mutex
+	entries      []*spoolEntry
+	bytes        int64
+	records      int
+	rejected     int64
+	nextSeq      uint64
+	notifyCh     chan struct{}
+	deserializer map[string]*batchDeserializer
+}
+
+// spoolDirOf returns the spool directory of the topic, so that the producers of different
+// topics can share the SpoolDir without replaying the batches of each other
+func spoolDirOf(baseDir, project, topic string) string {
+	return filepath.Join(baseDir, project, topic)
+}
+
+func newDiskSpool(dir string, maxBytes int64, project, topic string,
+	schemaCache topicSchemaCache, cType CompressorType) *diskSpool {
+	return &diskSpool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		serializer:   newBatchSerializer(project, topic, schemaCache, cType),
+		schemaCache:  schemaCache,
+		entries:      make([]*spoolEntry, 0),
+		notifyCh:     make(chan struct{}, 1),
+		deserializer: make(map[string]*batchDeserializer),
+	}
+}
+
+// recover loads the batches left by a previous process, temp files of
+// interrupted writes are removed.
+func (ds *diskSpool) recover() error {
+	if err := os.MkdirAll(ds.dir, 0755); err != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(ds.dir)
+	if err != nil {
+		return err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(ds.dir, name)
+		if strings.HasSuffix(name, spoolTmpFileSuffix) {
+			os.Remove(path)
+			continue
+		}
+
+		if file.IsDir() || !strings.HasSuffix(name, spoolFileSuffix) {
+			continue
+		}
+
+		seq, shardId, attempts, err := parseSpoolFileName(name)
+		if err != nil {
+			log.Warnf("spool %s ignore invalid file %s, error:%v", ds.dir, name, err)
+			continue
+		}
+
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		header, err := parseBatchHeader(buf)
+		if err != nil {
+			log.Errorf("spool %s drop broken file %s, error:%v", ds.dir, name, err)
+			os.Remove(path)
+			continue
+		}
+
+		ds.entries = append(ds.entries, &spoolEntry{
+			seq:         seq,
+			shardId:     shardId,
+			path:        path,
+			size:        int64(len(buf)),
+			recordCount: int(header.recordCount),
+			attempts:    attempts,
+		})
+		ds.bytes += int64(len(buf))
+		ds.records += int(header.recordCount)
+		if seq >= ds.nextSeq {
+			ds.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(ds.entries, func(i, j int) bool {
+		return ds.entries[i].seq < ds.entries[j].seq
+	})
+
+	if len(ds.entries) > 0 {
+		log.Infof("spool %s recover %d batches, %d records, %d bytes",
+			ds.dir, len(ds.entries), ds.records, ds.bytes)
+		ds.notify()
+	}
+	return nil
+}
+
+func spoolFileName(seq uint64, shardId string, attempts int) string {
+	return fmt.Sprintf("%020d_%s_%d%s", seq, shardId, attempts, spoolFileSuffix)
+}
+
+func parseSpoolFileName(name string) (uint64, string, int, error) {
+	name = strings.TrimSuffix(name, spoolFileSuffix)
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) < 2 || len(parts[1]) == 0 {
+		return 0, "", 0, fmt.Errorf("invalid spool file name")
+	}
+
+	seq, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	attempts := 0
+	if len(parts) == 3 {
+		if attempts, err = strconv.Atoi(parts[2]); err != nil {
+			return 0, "", 0, err
+		}
+	}
+	return seq, parts[1], attempts, nil
+}
+
+// append persists the batch with the requests already sent for it, the returned entry
+// is owned by the caller until release or remove is called when inflight is true.
+func (ds *diskSpool) append(shardId string, records []IRecord, attempts int, inflight bool) (*spoolEntry, error) {
+	buf, _, err := ds.serializer.serialize(records)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mutex.Lock()
+	if ds.maxBytes > 0 && ds.bytes+int64(len(buf)) > ds.maxBytes {
+		ds.rejected++
+		ds.mutex.Unlock()
+		return nil, fmt.Errorf("spool %s is full, current:%d, max:%d", ds.dir, ds.bytes, ds.maxBytes)
+	}
+
+	entry := &spoolEntry{
+		seq:         ds.nextSeq,
+		shardId:     shardId,
+		size:        int64(len(buf)),
+		recordCount: len(records),
+		attempts:    attempts,
+		inflight:    inflight,
+	}
+	entry.path = filepath.Join(ds.dir, spoolFileName(entry.seq, shardId, attempts))
+	ds.nextSeq++
+	ds.bytes += entry.size
+	ds.records += entry.recordCount
+	ds.entries = append(ds.entries, entry)
+	ds.mutex.Unlock()
+
+	if err := writeFileAtomic(entry.path, buf); err != nil {
+		ds.remove(entry)
+		return nil, err
+	}
+
+	if !inflight {
+		ds.notify()
+	}
+	return entry, nil
+}
+
+func writeFileAtomic(path string, buf []byte) error {
+	tmpPath := path + spoolTmpFileSuffix
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(buf); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// addAttempts counts the requests sent for the entry, the file is renamed to keep them,
+// it is called by the owner of the entry
+func (ds *diskSpool) addAttempts(entry *spoolEntry, attempts int) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	entry.attempts += attempts
+	path := filepath.Join(ds.dir, spoolFileName(entry.seq, entry.shardId, entry.attempts))
+	if err := os.Rename(entry.path, path); err != nil {
+		log.Warnf("spool %s rename file %s failed, error:%v", ds.dir, entry.path, err)
+		return
+	}
+	entry.path = path
+}
+
+// release hands an inflight entry over to replay
+func (ds *diskSpool) release(entry *spoolEntry) {
+	ds.mutex.Lock()
+	entry.inflight = false
+	ds.mutex.Unlock()
+	ds.notify()
+}
+
+func (ds *diskSpool) remove(entry *spoolEntry) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	for idx, e := range ds.entries {
+		if e == entry {
+			ds.entries = append(ds.entries[:idx], ds.entries[idx+1:]...)
+			ds.bytes -= entry.size
+			ds.records -= entry.recordCount
+			break
+		}
+	}
+
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		log.Warnf("spool %s remove file %s failed, error:%v", ds.dir, entry.path, err)
+	}
+}
+
+// peek returns the oldest entry which is waiting for replay
+func (ds *diskSpool) peek() *spoolEntry {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	for _, entry := range ds.entries {
+		if !entry.inflight {
+			return entry
+		}
+	}
+	return nil
+}
+
+// claimAll marks all entries waiting for replay as inflight and returns them in order
+func (ds *diskSpool) claimAll() []*spoolEntry {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	entries := make([]*spoolEntry, 0, len(ds.entries))
+	for _, entry := range ds.entries {
+		if !entry.inflight {
+			entry.inflight = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (ds *diskSpool) load(entry *spoolEntry) ([]IRecord, error) {
+	buf, err := os.ReadFile(entry.path)
+	if err != nil {
+		return nil, err
+	}
+
+	deserializer, ok := ds.deserializer[entry.shardId]
+	if !ok {
+		deserializer = newBatchDeserializer(entry.shardId, ds.schemaCache)
+		ds.deserializer[entry.shardId] = deserializer
+	}
+
+	return deserializer.deserialize(buf, &respMeta{})
+}
+
+func (ds *diskSpool) notify() {
+	select {
+	case ds.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (ds *diskSpool) stats() SpoolStats {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	return SpoolStats{
+		Batches:  len(ds.entries),
+		Records:  ds.records,
+		Bytes:    ds.bytes,
+		Rejected: ds.rejected,
+	}
+}
@@ -0,0 +1,152 @@
+package datahub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSpoolForTest(dir string, maxBytes int64) (*diskSpool, *RecordSchema) {
+	dhSchema := NewRecordSchema()
+	dhSchema.AddField(Field{Name: "f1", Type: BIGINT, AllowNull: true})
+	dhSchema.AddField(Field{Name: "f2", Type: STRING, AllowNull: true})
+
+	avroSchema, _ := getAvroSchema(dhSchema)
+	cache := &topicSchemaCacheForTest{
+		avroSchema: avroSchema,
+		dhSchema:   dhSchema,
+	}
+	return newDiskSpool(dir, maxBytes, "test_project", "test_topic", cache, ZSTD), dhSchema
+}
+
+func TestSpoolAppendAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	spool, dhSchema := newSpoolForTest(dir, 0)
+	assert.Nil(t, spool.recover())
+
+	records := []IRecord{genTupleRecord(dhSchema), genTupleRecord(dhSchema)}
+	entry, err := spool.append("1", records, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(spool.notifyCh))
+
+	stats := spool.stats()
+	assert.Equal(t, 1, stats.Batches)
+	assert.Equal(t, 2, stats.Records)
+	assert.Equal(t, entry.size, stats.Bytes)
+
+	assert.Equal(t, entry, spool.peek())
+	newRecords, err := spool.load(entry)
+	assert.Nil(t, err)
+	assert.Equal(t, len(records), len(newRecords))
+	for i := range records {
+		assert.Equal(t, records[i].GetData(), newRecords[i].GetData())
+		assert.Equal(t, records[i].GetAttributes(), newRecords[i].GetAttributes())
+		assert.Equal(t, "1", newRecords[i].GetBaseRecord().ShardId)
+	}
+
+	spool.remove(entry)
+	assert.Nil(t, spool.peek())
+	assert.Equal(t, SpoolStats{}, spool.stats())
+	_, err = os.Stat(entry.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSpoolInflightEntry(t *testing.T) {
+	spool, dhSchema := newSpoolForTest(t.TempDir(), 0)
+	assert.Nil(t, spool.recover())
+
+	entry, err := spool.append("0", []IRecord{genTupleRecord(dhSchema)}, 0, true)
+	assert.Nil(t, err)
+	assert.Nil(t, spool.peek())
+	assert.Equal(t, 0, len(spool.notifyCh))
+
+	spool.release(entry)
+	assert.Equal(t, entry, spool.peek())
+	assert.Equal(t, 1, len(spool.notifyCh))
+}
+
+func TestSpoolFull(t *testing.T) {
+	spool, dhSchema := newSpoolForTest(t.TempDir(), 1)
+	assert.Nil(t, spool.recover())
+
+	_, err := spool.append("0", []IRecord{genTupleRecord(dhSchema)}, 0, false)
+	assert.NotNil(t, err)
+
+	stats := spool.stats()
+	assert.Equal(t, 0, stats.Batches)
+	assert.Equal(t, int64(1), stats.Rejected)
+}
+
+func TestSpoolRecover(t *testing.T) {
+	dir := t.TempDir()
+	spool, dhSchema := newSpoolForTest(dir, 0)
+	assert.Nil(t, spool.recover())
+
+	_, err := spool.append("2", []IRecord{genTupleRecord(dhSchema)}, 0, false)
+	assert.Nil(t, err)
+	_, err = spool.append("0", []IRecord{genTupleRecord(dhSchema), genTupleRecord(dhSchema)}, 0, false)
+	assert.Nil(t, err)
+
+	// interrupted write and unknown file
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "00000000000000000009_1.spool.tmp"), []byte("xx"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "README"), []byte("xx"), 0644))
+
+	newSpool, _ := newSpoolForTest(dir, 0)
+	assert.Nil(t, newSpool.recover())
+
+	stats := newSpool.stats()
+	assert.Equal(t, 2, stats.Batches)
+	assert.Equal(t, 3, stats.Records)
+	assert.Equal(t, 1, len(newSpool.notifyCh))
+
+	entry := newSpool.peek()
+	assert.Equal(t, uint64(0), entry.seq)
+	assert.Equal(t, "2", entry.shardId)
+	assert.Equal(t, uint64(2), newSpool.nextSeq)
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000009_1.spool.tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSpoolFileName(t *testing.T) {
+	seq, shardId, attempts, err := parseSpoolFileName(spoolFileName(12, "3", 4))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), seq)
+	assert.Equal(t, "3", shardId)
+	assert.Equal(t, 4, attempts)
+
+	// the file of old versions has no attempts
+	seq, shardId, attempts, err = parseSpoolFileName("00000000000000000012_3.spool")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), seq)
+	assert.Equal(t, "3", shardId)
+	assert.Equal(t, 0, attempts)
+
+	_, _, _, err = parseSpoolFileName("00000000000000000012_3_x.spool")
+	assert.NotNil(t, err)
+	_, _, _, err = parseSpoolFileName("00000000000000000012.spool")
+	assert.NotNil(t, err)
+}
+
+func TestSpoolDirOfTopics(t *testing.T) {
+	base := t.TempDir()
+	assert.Equal(t, filepath.Join(base, "p1", "t1"), spoolDirOf(base, "p1", "t1"))
+
+	spool1, dhSchema := newSpoolForTest(spoolDirOf(base, "p1", "t1"), 0)
+	assert.Nil(t, spool1.recover())
+	_, err := spool1.append("0", []IRecord{genTupleRecord(dhSchema)}, 0, false)
+	assert.Nil(t, err)
+
+	// the producers of other topics sharing the base dir do not replay the batch
+	for _, dir := range []string{spoolDirOf(base, "p1", "t2"), spoolDirOf(base, "p2", "t1")} {
+		spool2, _ := newSpoolForTest(dir, 0)
+		assert.Nil(t, spool2.recover())
+		assert.Equal(t, 0, spool2.stats().Batches)
+	}
+
+	spool3, _ := newSpoolForTest(spoolDirOf(base, "p1", "t1"), 0)
+	assert.Nil(t, spool3.recover())
+	assert.Equal(t, 1, spool3.stats().Batches)
+}
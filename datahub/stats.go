@@ -0,0 +1,249 @@
+package datahub
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const latencySampleSize = 1024
+
+// The error classes of ShardStats.Retries and ShardStats.Failures
+const (
+	ErrorClassNetwork          = "Network"
+	ErrorClassLimitExceeded    = "LimitExceeded"
+	ErrorClassServiceInProcess = "ServiceInProcess"
+	ErrorClassShardSealed      = "ShardSealed"
+	ErrorClassOther            = "Other"
+)
+
+// ShardStats is the counters of a shard or the total of all shards since the producer created
+type ShardStats struct {
+	RecordsSent      int64            // records written successfully
+	BytesSent        int64            // request bytes after compression, sum of SendDetails.ReqSize
+	RawBytesSent     int64            // request bytes before compression, sum of SendDetails.RawSize
+	RecordsFailed    int64            // records of the requests failed after all retries, they may be rerouted or spooled
+	Retries          map[string]int64 // retried requests by error class
+	Failures         map[string]int64 // failed requests by error class
+	InflightRequests int64            // requests being sent
+	BufferedRecords  int64            // records buffered or in flight, always 0 for Producer
+	LatencyP50       time.Duration    // of the recent successful requests
+	LatencyP99       time.Duration    // of the recent successful requests
+	BatchNum         int64            // current max records per batch of AsyncProducer, 0 in Total
+	InflightLimit    int64            // current max in-flight requests of AsyncProducer, 0 in Total
+}
+
+// ProducerStats is a snapshot of the producer counters
+type ProducerStats struct {
+	Total                ShardStats
+	Shards               map[string]ShardStats
+	LastShardRefreshTime time.Time
+	Spool                SpoolStats
+}
+
+func errorClass(err error) string {
+	switch {
+	case IsNetworkError(err):
+		return ErrorClassNetwork
+	case IsLimitExceedError(err):
+		return ErrorClassLimitExceeded
+	case IsServiceInProcessError(err):
+		return ErrorClassServiceInProcess
+	case IsShardSealedError(err):
+		return ErrorClassShardSealed
+	default:
+		return ErrorClassOther
+	}
+}
+
+type shardStatsCollector struct {
+	recordsSent   atomic.Int64
+	bytesSent     atomic.Int64
+	rawBytesSent  atomic.Int64
+	recordsFailed atomic.Int64
+	inflight      atomic.Int64
+	batchNum      atomic.Int64
+	inflightLimit atomic.Int64
+
+	mutex     sync.Mutex
+	retries   map[string]int64
+	failures  map[string]int64
+	latencies []time.Duration // ring buffer of the recent latencies
+	next      int
+}
+
+func newShardStatsCollector() *shardStatsCollector {
+	return &shardStatsCollector{
+		retries:   make(map[string]int64),
+		failures:  make(map[string]int64),
+		latencies: make([]time.Duration, 0, latencySampleSize),
+	}
+}
+
+func (sc *shardStatsCollector) beginRequest() {
+	sc.inflight.Add(1)
+}
+
+func (sc *shardStatsCollector) endRequest() {
+	sc.inflight.Add(-1)
+}
+
+func (sc *shardStatsCollector) setLimits(batchNum, inflightLimit int) {
+	sc.batchNum.Store(int64(batchNum))
+	sc.inflightLimit.Store(int64(inflightLimit))
+}
+
+func (sc *shardStatsCollector) onRetry(err error) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.retries[errorClass(err)]++
+}
+
+func (sc *shardStatsCollector) onSuccess(records int, reqSize, rawSize int, latency time.Duration) {
+	sc.recordsSent.Add(int64(records))
+	sc.bytesSent.Add(int64(reqSize))
+	sc.rawBytesSent.Add(int64(rawSize))
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	if len(sc.latencies) < latencySampleSize {
+		sc.latencies = append(sc.latencies, latency)
+	} else {
+		sc.latencies[sc.next] = latency
+		sc.next = (sc.next + 1) % latencySampleSize
+	}
+}
+
+func (sc *shardStatsCollector) onFailure(records int, err error) {
+	sc.recordsFailed.Add(int64(records))
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.failures[errorClass(err)]++
+}
+
+// snapshot returns the counters and a copy of the latency samples
+func (sc *shardStatsCollector) snapshot() (ShardStats, []time.Duration) {
+	stats := ShardStats{
+		RecordsSent:      sc.recordsSent.Load(),
+		BytesSent:        sc.bytesSent.Load(),
+		RawBytesSent:     sc.rawBytesSent.Load(),
+		RecordsFailed:    sc.recordsFailed.Load(),
+		InflightRequests: sc.inflight.Load(),
+		BatchNum:         sc.batchNum.Load(),
+		InflightLimit:    sc.inflightLimit.Load(),
+		Retries:          make(map[string]int64),
+		Failures:         make(map[string]int64),
+	}
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	for k, v := range sc.retries {
+		stats.Retries[k] = v
+	}
+	for k, v := range sc.failures {
+		stats.Failures[k] = v
+	}
+
+	latencies := make([]time.Duration, len(sc.latencies))
+	copy(latencies, sc.latencies)
+	stats.LatencyP50, stats.LatencyP99 = latencyPercentiles(latencies)
+	return stats, latencies
+}
+
+// latencyPercentiles sorts the latencies and returns p50 and p99
+func latencyPercentiles(latencies []time.Duration) (time.Duration, time.Duration) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	// nearest rank
+	percentile := func(p int) time.Duration {
+		return latencies[(len(latencies)*p+99)/100-1]
+	}
+	return percentile(50), percentile(99)
+}
+
+type producerStatsCollector struct {
+	mutex         sync.RWMutex
+	shards        map[string]*shardStatsCollector
+	lastFreshTime atomic.Int64 // unix milliseconds
+}
+
+func newProducerStatsCollector() *producerStatsCollector {
+	return &producerStatsCollector{
+		shards: make(map[string]*shardStatsCollector),
+	}
+}
+
+func (pc *producerStatsCollector) shard(shardId string) *shardStatsCollector {
+	pc.mutex.RLock()
+	sc, ok := pc.shards[shardId]
+	pc.mutex.RUnlock()
+	if ok {
+		return sc
+	}
+
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if sc, ok = pc.shards[shardId]; !ok {
+		sc = newShardStatsCollector()
+		pc.shards[shardId] = sc
+	}
+	return sc
+}
+
+func (pc *producerStatsCollector) onShardRefreshed() {
+	pc.lastFreshTime.Store(time.Now().UnixMilli())
+}
+
+// snapshot merges the shards into the total, backlog returns the buffered records of a shard
+func (pc *producerStatsCollector) snapshot(backlog func(shardId string) int) ProducerStats {
+	stats := ProducerStats{
+		Total: ShardStats{
+			Retries:  make(map[string]int64),
+			Failures: make(map[string]int64),
+		},
+		Shards: make(map[string]ShardStats),
+	}
+	if ms := pc.lastFreshTime.Load(); ms > 0 {
+		stats.LastShardRefreshTime = time.UnixMilli(ms)
+	}
+
+	pc.mutex.RLock()
+	collectors := make(map[string]*shardStatsCollector, len(pc.shards))
+	for shardId, sc := range pc.shards {
+		collectors[shardId] = sc
+	}
+	pc.mutex.RUnlock()
+
+	allLatencies := make([]time.Duration, 0)
+	for shardId, sc := range collectors {
+		shardStats, latencies := sc.snapshot()
+		if backlog != nil {
+			shardStats.BufferedRecords = int64(backlog(shardId))
+		}
+		stats.Shards[shardId] = shardStats
+
+		total := &stats.Total
+		total.RecordsSent += shardStats.RecordsSent
+		total.BytesSent += shardStats.BytesSent
+		total.RawBytesSent += shardStats.RawBytesSent
+		total.RecordsFailed += shardStats.RecordsFailed
+		total.InflightRequests += shardStats.InflightRequests
+		total.BufferedRecords += shardStats.BufferedRecords
+		for k, v := range shardStats.Retries {
+			total.Retries[k] += v
+		}
+		for k, v := range shardStats.Failures {
+			total.Failures[k] += v
+		}
+		allLatencies = append(allLatencies, latencies...)
+	}
+	stats.Total.LatencyP50, stats.Total.LatencyP99 = latencyPercentiles(allLatencies)
+	return stats
+}
@@ -0,0 +1,65 @@
+package datahub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	p50, p99 := latencyPercentiles(nil)
+	assert.Equal(t, time.Duration(0), p50)
+	assert.Equal(t, time.Duration(0), p99)
+
+	latencies := make([]time.Duration, 0)
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	p50, p99 = latencyPercentiles(latencies)
+	assert.Equal(t, 50*time.Millisecond, p50)
+	assert.Equal(t, 99*time.Millisecond, p99)
+}
+
+func TestProducerStatsSnapshot(t *testing.T) {
+	collector := newProducerStatsCollector()
+	collector.shard("0").onSuccess(10, 100, 200, 10*time.Millisecond)
+	collector.shard("1").onSuccess(5, 50, 100, 30*time.Millisecond)
+	collector.shard("1").onRetry(newNetworkError(fmt.Errorf("timeout")))
+	collector.shard("1").onFailure(5, fmt.Errorf("unknown"))
+
+	stats := collector.snapshot(func(shardId string) int { return 3 })
+	assert.True(t, stats.LastShardRefreshTime.IsZero())
+	assert.Equal(t, int64(15), stats.Total.RecordsSent)
+	assert.Equal(t, int64(150), stats.Total.BytesSent)
+	assert.Equal(t, int64(300), stats.Total.RawBytesSent)
+	assert.Equal(t, int64(5), stats.Total.RecordsFailed)
+	assert.Equal(t, int64(6), stats.Total.BufferedRecords)
+	assert.Equal(t, map[string]int64{ErrorClassNetwork: 1}, stats.Total.Retries)
+	assert.Equal(t, map[string]int64{ErrorClassOther: 1}, stats.Shards["1"].Failures)
+	assert.Equal(t, 30*time.Millisecond, stats.Total.LatencyP99)
+	assert.Equal(t, 10*time.Millisecond, stats.Shards["0"].LatencyP50)
+}
+
+func TestProducerStats(t *testing.T) {
+	cfg := NewProducerConfig()
+	cfg.MaxRetry = 1
+	cfg.RetryInterval = time.Millisecond
+	client := &producerMockClient{}
+	producer := newProducerForTest(cfg, client)
+
+	_, err := producer.Send([]IRecord{NewBlobRecord([]byte("test"))})
+	assert.Nil(t, err)
+
+	client.putErr = newNetworkError(fmt.Errorf("timeout"))
+	_, err = producer.SendByShard([]IRecord{NewBlobRecord([]byte("test"))}, "0")
+	assert.NotNil(t, err)
+
+	stats := producer.Stats()
+	assert.Equal(t, int64(1), stats.Shards["0"].RecordsSent)
+	assert.Equal(t, int64(1), stats.Shards["0"].RecordsFailed)
+	assert.Equal(t, int64(1), stats.Shards["0"].Retries[ErrorClassNetwork])
+	assert.Equal(t, int64(1), stats.Shards["0"].Failures[ErrorClassNetwork])
+	assert.Equal(t, int64(0), stats.Total.InflightRequests)
+}
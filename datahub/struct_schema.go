@@ -0,0 +1,99 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	timestampType = reflect.TypeOf(Timestamp(0))
+	jsonType      = reflect.TypeOf(Json(""))
+)
+
+// SchemaFromStruct derives the record schema from the struct v by the same `datahub` tags
+// as Marshal, the `comment` tag is the field comment. A pointer or omitempty field allows null.
+// Integers are mapped by size, uint8 to uint32 to the next larger type so that every value
+// fits, int to BIGINT, uint and uint64 to DECIMAL as BIGINT can not hold the values above
+// math.MaxInt64. time.Time is TIMESTAMP, decimal.Decimal is DECIMAL, and maps, slices,
+// structs and interfaces are JSON.
+func SchemaFromStruct(v any) (*RecordSchema, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("value type[%T] is not struct", v)
+	}
+
+	plan, err := getStructPlan(t)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := NewRecordSchema()
+	for _, sf := range plan.fields {
+		ft, allowNull, err := getStructFieldType(sf.typ)
+		if err != nil {
+			return nil, fmt.Errorf("struct field %s: %v", sf.goName, err)
+		}
+
+		field := Field{
+			Name:      sf.name,
+			Type:      ft,
+			AllowNull: allowNull || sf.omitEmpty,
+			Comment:   sf.comment,
+		}
+		if err = schema.AddField(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if schema.Size() == 0 {
+		return nil, fmt.Errorf("struct %s has no field", t)
+	}
+	return schema, nil
+}
+
+// getStructFieldType returns the field type and if the go type is a pointer
+func getStructFieldType(t reflect.Type) (FieldType, bool, error) {
+	allowNull := false
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		allowNull = true
+	}
+
+	switch t {
+	case timeType, timestampType:
+		return TIMESTAMP, allowNull, nil
+	case decimalType, dhDecimalType:
+		return DECIMAL, allowNull, nil
+	case jsonType, bytesType, rawMessageType:
+		return JSON, allowNull, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return BIGINT, allowNull, nil
+	case reflect.Uint, reflect.Uint64:
+		return DECIMAL, allowNull, nil
+	case reflect.Int32, reflect.Uint16:
+		return INTEGER, allowNull, nil
+	case reflect.Int16, reflect.Uint8:
+		return SMALLINT, allowNull, nil
+	case reflect.Int8:
+		return TINYINT, allowNull, nil
+	case reflect.Float64:
+		return DOUBLE, allowNull, nil
+	case reflect.Float32:
+		return FLOAT, allowNull, nil
+	case reflect.Bool:
+		return BOOLEAN, allowNull, nil
+	case reflect.String:
+		return STRING, allowNull, nil
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Interface:
+		return JSON, allowNull, nil
+	default:
+		return "", false, fmt.Errorf("type %s can not be mapped to field type", t)
+	}
+}
@@ -0,0 +1,95 @@
+package datahub
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaFromStruct(t *testing.T) {
+	type event struct {
+		marshalBase
+		Name    string          `datahub:"name" comment:"user name"`
+		Age     *int32          `datahub:"age"`
+		Score   float64         `datahub:"score"`
+		Ratio   float32         `datahub:"ratio"`
+		Level   int8            `datahub:"level"`
+		Count   uint16          `datahub:"count"`
+		Valid   bool            `datahub:"valid"`
+		Time    time.Time       `datahub:"time,omitempty"`
+		Amount  decimal.Decimal `datahub:"amount"`
+		Extra   map[string]any  `datahub:"extra"`
+		Raw     Json            `datahub:"raw"`
+		Ignored string          `datahub:"-"`
+	}
+
+	schema, err := SchemaFromStruct(&event{})
+	assert.Nil(t, err)
+	assert.Equal(t, 12, schema.Size())
+
+	expected := []Field{
+		{Name: "id", Type: BIGINT},
+		{Name: "name", Type: STRING, Comment: "user name"},
+		{Name: "age", Type: INTEGER, AllowNull: true},
+		{Name: "score", Type: DOUBLE},
+		{Name: "ratio", Type: FLOAT},
+		{Name: "level", Type: TINYINT},
+		{Name: "count", Type: INTEGER},
+		{Name: "valid", Type: BOOLEAN},
+		{Name: "time", Type: TIMESTAMP, AllowNull: true},
+		{Name: "amount", Type: DECIMAL},
+		{Name: "extra", Type: JSON},
+		{Name: "raw", Type: JSON},
+	}
+	assert.Equal(t, expected, schema.Fields)
+	assert.Equal(t, 1, schema.GetFieldIndex("name"))
+
+	record, err := Marshal(schema, event{Name: "test", Extra: map[string]any{"k": 1}, Raw: "[]"})
+	assert.Nil(t, err)
+	assert.Equal(t, Integer(0), record.Values[6])
+}
+
+func TestSchemaFromStructUint64(t *testing.T) {
+	type counter struct {
+		Total uint64 `datahub:"total"`
+		Size  uint   `datahub:"size"`
+	}
+
+	schema, err := SchemaFromStruct(counter{})
+	assert.Nil(t, err)
+	assert.Equal(t, DECIMAL, schema.Fields[0].Type)
+	assert.Equal(t, DECIMAL, schema.Fields[1].Type)
+
+	record, err := Marshal(schema, counter{Total: math.MaxUint64, Size: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "18446744073709551615", record.Values[0].String())
+
+	var result counter
+	assert.Nil(t, Unmarshal(record, &result))
+	assert.Equal(t, uint64(math.MaxUint64), result.Total)
+	assert.Equal(t, uint(1), result.Size)
+
+	// the decimal values out of the range of the struct field are rejected
+	var small struct {
+		Total int64 `datahub:"total"`
+	}
+	assert.NotNil(t, Unmarshal(record, &small))
+	assert.Nil(t, record.SetValueByName("total", "1.5"))
+	assert.NotNil(t, Unmarshal(record, &result))
+}
+
+func TestSchemaFromStructInvalid(t *testing.T) {
+	_, err := SchemaFromStruct(1)
+	assert.NotNil(t, err)
+
+	_, err = SchemaFromStruct(struct{ internal int }{})
+	assert.NotNil(t, err)
+
+	_, err = SchemaFromStruct(struct {
+		Fn func() `datahub:"fn"`
+	}{})
+	assert.NotNil(t, err)
+}
@@ -34,13 +34,35 @@ func NewFieldWithProp(name string, Type FieldType, allowNull bool, comment strin
 	}
 }
 
+// DecimalProp is the precision and scale of a DECIMAL field, see RecordSchema.AddDecimalField
+type DecimalProp struct {
+	Precision    int                 // 0 means no limit
+	Scale        int                 // the digits after the decimal point
+	RoundingMode DecimalRoundingMode // how the values exceeding the scale are handled, default reject
+}
+
+func (dp DecimalProp) String() string {
+	if dp.Precision == 0 {
+		return "DECIMAL"
+	}
+	return fmt.Sprintf("DECIMAL(%d,%d)", dp.Precision, dp.Scale)
+}
+
 // RecordSchema
 type RecordSchema struct {
 	Fields        []Field        `json:"fields"`
 	fieldIndexMap map[string]int `json:"-"`
+	decimalProps  map[string]DecimalProp
 	hashVal       uint32
 }
 
+// fieldHelper is the json of a field with the precision and scale, they are omitted if not set
+type fieldHelper struct {
+	Field
+	Precision int `json:"precision,omitempty"`
+	Scale     int `json:"scale,omitempty"`
+}
+
 // NewRecordSchema create a new record schema for tuple record
 func NewRecordSchema() *RecordSchema {
 	return &RecordSchema{
@@ -65,15 +87,16 @@ func NewRecordSchemaFromJson(SchemaJson string) (recordSchema *RecordSchema, err
 
 func (rs *RecordSchema) UnmarshalJSON(data []byte) error {
 	schema := &struct {
-		Fields []Field `json:"fields"`
+		Fields []fieldHelper `json:"fields"`
 	}{}
 	if err := json.Unmarshal(data, schema); err != nil {
 		return err
 	}
 
 	rs.fieldIndexMap = make(map[string]int)
+	rs.decimalProps = nil
 	for _, v := range schema.Fields {
-		if err := rs.AddField(v); err != nil {
+		if err := rs.AddDecimalField(v.Field, DecimalProp{Precision: v.Precision, Scale: v.Scale}); err != nil {
 			return err
 		}
 	}
@@ -81,6 +104,20 @@ func (rs *RecordSchema) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON keeps the json of the fields, with the precision and scale of the DECIMAL fields if set.
+// It has a value receiver, so the schemas in RecordSchemaInfo are marshaled by it as well.
+func (rs RecordSchema) MarshalJSON() ([]byte, error) {
+	fields := make([]fieldHelper, 0, rs.Size())
+	for _, field := range rs.Fields {
+		prop := rs.GetDecimalProp(field.Name)
+		fields = append(fields, fieldHelper{field, prop.Precision, prop.Scale})
+	}
+
+	return json.Marshal(struct {
+		Fields []fieldHelper `json:"fields"`
+	}{fields})
+}
+
 func (rs *RecordSchema) HashCode() uint32 {
 	return rs.hashCode()
 }
@@ -107,15 +144,18 @@ func (rs *RecordSchema) hashCode() uint32 {
 
 func (rs *RecordSchema) String() string {
 	type FieldHelper struct {
-		Name    string    `json:"name"`
-		Type    FieldType `json:"type"`
-		NotNull bool      `json:"notnull,omitempty"`
-		Comment string    `json:"comment,omitempty"`
+		Name      string    `json:"name"`
+		Type      FieldType `json:"type"`
+		NotNull   bool      `json:"notnull,omitempty"`
+		Comment   string    `json:"comment,omitempty"`
+		Precision int       `json:"precision,omitempty"`
+		Scale     int       `json:"scale,omitempty"`
 	}
 
 	fields := make([]FieldHelper, 0, rs.Size())
 	for _, field := range rs.Fields {
-		tmpField := FieldHelper{field.Name, field.Type, !field.AllowNull, field.Comment}
+		prop := rs.GetDecimalProp(field.Name)
+		tmpField := FieldHelper{field.Name, field.Type, !field.AllowNull, field.Comment, prop.Precision, prop.Scale}
 		fields = append(fields, tmpField)
 	}
 
@@ -144,6 +184,45 @@ func (rs *RecordSchema) AddField(f Field) error {
 	return nil
 }
 
+// AddDecimalField adds the field with the precision and scale, which must be a DECIMAL field
+// unless prop is zero. The precision and scale are in the schema string, so they change the
+// schema hash, the schemas without them are not changed.
+func (rs *RecordSchema) AddDecimalField(f Field, prop DecimalProp) error {
+	if err := validateDecimalProp(&f, &prop); err != nil {
+		return err
+	}
+
+	if err := rs.AddField(f); err != nil {
+		return err
+	}
+
+	if prop != (DecimalProp{}) {
+		if rs.decimalProps == nil {
+			rs.decimalProps = make(map[string]DecimalProp)
+		}
+		rs.decimalProps[strings.ToLower(f.Name)] = prop
+	}
+	return nil
+}
+
+// SetDecimalRoundingMode sets how the values exceeding the scale of the DECIMAL field are handled
+func (rs *RecordSchema) SetDecimalRoundingMode(fname string, mode DecimalRoundingMode) error {
+	name := strings.ToLower(fname)
+	prop, ok := rs.decimalProps[name]
+	if !ok {
+		return fmt.Errorf("[%s] has no decimal precision and scale", fname)
+	}
+
+	prop.RoundingMode = mode
+	rs.decimalProps[name] = prop
+	return nil
+}
+
+// GetDecimalProp returns the precision and scale of the field, zero if not set
+func (rs *RecordSchema) GetDecimalProp(fname string) DecimalProp {
+	return rs.decimalProps[strings.ToLower(fname)]
+}
+
 // GetFieldIndex get index of given field
 func (rs *RecordSchema) GetFieldIndex(fname string) int {
 	name := strings.ToLower(fname)
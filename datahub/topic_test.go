@@ -106,3 +106,54 @@ func TestSchemaGetFiled(t *testing.T) {
 	assert.True(t, IsFieldNotExistsError(err))
 	assert.Equal(t, err.Error(), "field index[-1] out of range")
 }
+
+func TestDecimalFieldPrecision(t *testing.T) {
+	schema := NewRecordSchema()
+	assert.Nil(t, schema.AddDecimalField(Field{Name: "f1", Type: DECIMAL}, DecimalProp{Precision: 10, Scale: 2}))
+	assert.Nil(t, schema.AddField(Field{Name: "f2", Type: DECIMAL, AllowNull: true}))
+	assert.Equal(t, `{"fields":[{"name":"f1","type":"DECIMAL","notnull":true,"precision":10,"scale":2},{"name":"f2","type":"DECIMAL"}]}`, schema.String())
+
+	buf, err := json.Marshal(schema)
+	assert.Nil(t, err)
+	newSchema, err := NewRecordSchemaFromJson(string(buf))
+	assert.Nil(t, err)
+	assert.Equal(t, schema.Fields, newSchema.Fields)
+	assert.Equal(t, DecimalProp{Precision: 10, Scale: 2}, newSchema.GetDecimalProp("F1"))
+	assert.Equal(t, DecimalProp{}, newSchema.GetDecimalProp("f2"))
+	assert.Equal(t, schema.HashCode(), newSchema.HashCode())
+
+	info := RecordSchemaInfo{VersionId: 1, RecordSchema: *schema}
+	buf, err = json.Marshal(info)
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf), `"precision":10,"scale":2`)
+
+	assert.Nil(t, schema.SetDecimalRoundingMode("f1", DecimalRoundHalfUp))
+	assert.Equal(t, DecimalRoundHalfUp, schema.GetDecimalProp("f1").RoundingMode)
+	assert.NotNil(t, schema.SetDecimalRoundingMode("f2", DecimalRoundHalfUp))
+
+	assert.NotNil(t, schema.AddDecimalField(Field{Name: "f3", Type: BIGINT}, DecimalProp{Precision: 10}))
+	assert.NotNil(t, schema.AddDecimalField(Field{Name: "f3", Type: DECIMAL}, DecimalProp{Precision: 39}))
+	assert.NotNil(t, schema.AddDecimalField(Field{Name: "f3", Type: DECIMAL}, DecimalProp{Precision: 5, Scale: 6}))
+	assert.NotNil(t, schema.AddDecimalField(Field{Name: "f3", Type: DECIMAL}, DecimalProp{Scale: 2}))
+	assert.Equal(t, -1, schema.GetFieldIndex("f3"))
+	_, err = NewRecordSchemaFromJson(`{"fields":[{"name":"f1","type":"DECIMAL","precision":-1}]}`)
+	assert.NotNil(t, err)
+}
+
+func TestSchemaHashCodeStable(t *testing.T) {
+	schema := NewRecordSchema()
+	schema.AddField(Field{"f_string", STRING, true, "test"})
+	schema.AddField(Field{"f_bigint", BIGINT, false, ""})
+	schema.AddField(Field{"f_decimal", DECIMAL, true, "amount"})
+	schema.AddField(Field{"f_timestamp", TIMESTAMP, false, ""})
+
+	// the schemas without decimal precision keep the string and hash of the older versions
+	assert.Equal(t, `{"fields":[{"name":"f_string","type":"STRING","comment":"test"},{"name":"f_bigint","type":"BIGINT","notnull":true},`+
+		`{"name":"f_decimal","type":"DECIMAL","comment":"amount"},{"name":"f_timestamp","type":"TIMESTAMP","notnull":true}]}`, schema.String())
+	assert.Equal(t, uint32(1735663142), schema.HashCode())
+
+	buf, err := json.Marshal(schema)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"fields":[{"name":"f_string","type":"STRING","notnull":true,"comment":"test"},{"name":"f_bigint","type":"BIGINT","notnull":false,"comment":""},`+
+		`{"name":"f_decimal","type":"DECIMAL","notnull":true,"comment":"amount"},{"name":"f_timestamp","type":"TIMESTAMP","notnull":false,"comment":""}]}`, string(buf))
+}
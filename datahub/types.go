@@ -178,6 +178,99 @@ const (
 	JSON FieldType = "JSON"
 )
 
+// DecimalRoundingMode is how the DECIMAL values exceeding the scale of the field are handled
+type DecimalRoundingMode int
+
+const (
+	// DecimalRoundUnnecessary rejects the values exceeding the scale
+	DecimalRoundUnnecessary DecimalRoundingMode = iota
+	// DecimalRoundHalfUp rounds half away from zero, e.g. 1.25 -> 1.3, -1.25 -> -1.3
+	DecimalRoundHalfUp
+	// DecimalRoundHalfEven rounds half to even, e.g. 1.25 -> 1.2, 1.35 -> 1.4
+	DecimalRoundHalfEven
+	// DecimalRoundDown truncates toward zero, e.g. 1.29 -> 1.2, -1.29 -> -1.2
+	DecimalRoundDown
+)
+
+func (rm DecimalRoundingMode) String() string {
+	switch rm {
+	case DecimalRoundUnnecessary:
+		return "UNNECESSARY"
+	case DecimalRoundHalfUp:
+		return "HALF_UP"
+	case DecimalRoundHalfEven:
+		return "HALF_EVEN"
+	case DecimalRoundDown:
+		return "DOWN"
+	default:
+		return fmt.Sprintf("DecimalRoundingMode(%d)", int(rm))
+	}
+}
+
+const maxDecimalPrecision = 38
+
+// validateDecimalProp checks the precision and scale of the field
+func validateDecimalProp(f *Field, prop *DecimalProp) error {
+	if prop.Precision == 0 && prop.Scale == 0 {
+		return nil
+	}
+
+	if f.Type != DECIMAL {
+		return fmt.Errorf("[%s] precision and scale are only allowed for DECIMAL", f.Name)
+	}
+	if prop.Precision < 1 || prop.Precision > maxDecimalPrecision {
+		return fmt.Errorf("[%s] decimal precision %d out of range [1, %d]", f.Name, prop.Precision, maxDecimalPrecision)
+	}
+	if prop.Scale < 0 || prop.Scale > prop.Precision {
+		return fmt.Errorf("[%s] decimal scale %d out of range [0, %d]", f.Name, prop.Scale, prop.Precision)
+	}
+	return nil
+}
+
+// fitDecimal rounds the value to the scale of the field by the rounding mode and checks
+// the integer digits do not exceed precision-scale
+func fitDecimal(prop DecimalProp, val Decimal) (Decimal, error) {
+	if prop.Precision <= 0 {
+		return val, nil
+	}
+
+	v := decimal.Decimal(val)
+	scale := int32(prop.Scale)
+	if v.Exponent() < -scale {
+		switch prop.RoundingMode {
+		case DecimalRoundUnnecessary:
+			return val, fmt.Errorf("decimal %s exceeds scale %d", v.String(), prop.Scale)
+		case DecimalRoundHalfUp:
+			v = v.Round(scale)
+		case DecimalRoundHalfEven:
+			v = v.RoundBank(scale)
+		case DecimalRoundDown:
+			v = v.Truncate(scale)
+		default:
+			return val, fmt.Errorf("decimal rounding mode %s illegal", prop.RoundingMode)
+		}
+	}
+
+	limit := decimal.New(1, int32(prop.Precision-prop.Scale))
+	if v.Abs().GreaterThanOrEqual(limit) {
+		return val, fmt.Errorf("decimal %s exceeds precision %d with scale %d", v.String(), prop.Precision, prop.Scale)
+	}
+	return Decimal(v), nil
+}
+
+// validateField validates the value by validateFieldValue and the precision and scale of DECIMAL field
+func validateField(schema *RecordSchema, field *Field, val interface{}) (DataType, error) {
+	realval, err := validateFieldValue(field.Type, val)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := realval.(Decimal); ok {
+		return fitDecimal(schema.decimalProps[field.Name], v)
+	}
+	return realval, nil
+}
+
 // validateFieldType validate field type
 func validateFieldType(ft FieldType) bool {
 	switch ft {
@@ -338,6 +431,8 @@ func validateFieldValue(ft FieldType, val interface{}) (DataType, error) {
 	case DECIMAL:
 		var realval Decimal
 		switch v := val.(type) {
+		case Decimal:
+			realval = v
 		case decimal.Decimal:
 			realval = Decimal(v)
 		case string:
@@ -418,6 +513,16 @@ func validateFieldValue(ft FieldType, val interface{}) (DataType, error) {
 			realval = v
 		case string:
 			realval = Json(v)
+		case []byte:
+			realval = Json(v)
+		case json.RawMessage:
+			realval = Json(v)
+		case map[string]any, []any:
+			buf, err := parser.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			realval = Json(buf)
 		default:
 			return nil, fmt.Errorf("value type[%T] not match field type[JSON]", val)
 		}
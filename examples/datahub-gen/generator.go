@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aliyun/aliyun-datahub-sdk-go/datahub"
+)
+
+// SchemaVersion is a schema to generate struct for
+type SchemaVersion struct {
+	VersionId int
+	Schema    *datahub.RecordSchema
+}
+
+// fieldType is how a datahub field type is written in the generated code
+type fieldType struct {
+	goType   string // the go type of the struct field
+	dhType   string // the datahub DataType
+	zero     string // the zero value of goType
+	toGo     string // converts the DataType value v to goType
+	fromGo   string // converts the goType value %s to DataType
+	validate string // optional check of the goType value %[1]s, it returns an error named %[2]s
+}
+
+var fieldTypes = map[datahub.FieldType]fieldType{
+	datahub.BIGINT:   {goType: "int64", dhType: "Bigint", zero: "0", toGo: "int64(v)", fromGo: "datahub.Bigint(%s)"},
+	datahub.INTEGER:  {goType: "int32", dhType: "Integer", zero: "0", toGo: "int32(v)", fromGo: "datahub.Integer(%s)"},
+	datahub.SMALLINT: {goType: "int16", dhType: "Smallint", zero: "0", toGo: "int16(v)", fromGo: "datahub.Smallint(%s)"},
+	datahub.TINYINT:  {goType: "int8", dhType: "Tinyint", zero: "0", toGo: "int8(v)", fromGo: "datahub.Tinyint(%s)"},
+	datahub.DOUBLE:   {goType: "float64", dhType: "Double", zero: "0", toGo: "float64(v)", fromGo: "datahub.Double(%s)"},
+	datahub.FLOAT:    {goType: "float32", dhType: "Float", zero: "0", toGo: "float32(v)", fromGo: "datahub.Float(%s)"},
+	datahub.BOOLEAN:  {goType: "bool", dhType: "Boolean", zero: "false", toGo: "bool(v)", fromGo: "datahub.Boolean(%s)"},
+	datahub.STRING:   {goType: "string", dhType: "String", zero: `""`, toGo: "string(v)", fromGo: "datahub.String(%s)"},
+	datahub.TIMESTAMP: {goType: "time.Time", dhType: "Timestamp", zero: "time.Time{}", toGo: "time.UnixMicro(int64(v))",
+		fromGo: "datahub.Timestamp(%s.UnixMicro())", validate: `if %[1]s.IsZero() { return nil, fmt.Errorf("%[2]s: TIMESTAMP is not set") }
+if %[1]s.UnixMicro() < 0 { return nil, fmt.Errorf("%[2]s: TIMESTAMP must be positive") }`},
+	datahub.DECIMAL: {goType: "decimal.Decimal", dhType: "Decimal", zero: "decimal.Decimal{}", toGo: "decimal.Decimal(v)",
+		fromGo: "datahub.Decimal(%s)"},
+	datahub.JSON: {goType: "string", dhType: "Json", zero: `""`, toGo: "string(v)", fromGo: "datahub.Json(%s)",
+		validate: `if !json.Valid([]byte(%s)) { return nil, fmt.Errorf("%s: invalid json") }`},
+}
+
+type structField struct {
+	name      string
+	goName    string
+	fieldType fieldType
+	allowNull bool
+	typeName  datahub.FieldType
+}
+
+type generator struct {
+	buf      bytes.Buffer
+	pkg      string
+	typeName string
+	source   string
+}
+
+// Generate returns the formatted go source of the structs of the schema versions, the struct
+// of every version is named typeName + "V" + versionId if there are more than one version.
+func Generate(pkg, typeName, source string, versions []SchemaVersion) ([]byte, error) {
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no schema to generate")
+	}
+
+	g := &generator{pkg: pkg, typeName: typeName, source: source}
+	if err := g.generate(versions); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code failed, error:%v", err)
+	}
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(versions []SchemaVersion) error {
+	imports := []string{"fmt"}
+	thirdParty := []string{"github.com/aliyun/aliyun-datahub-sdk-go/datahub"}
+	for _, version := range versions {
+		for _, field := range version.Schema.Fields {
+			switch field.Type {
+			case datahub.TIMESTAMP:
+				imports = appendImport(imports, "time")
+			case datahub.DECIMAL:
+				thirdParty = appendImport(thirdParty, "github.com/shopspring/decimal")
+			case datahub.JSON:
+				imports = appendImport(imports, "encoding/json")
+			}
+		}
+	}
+	sort.Strings(imports)
+	sort.Strings(thirdParty)
+
+	g.printf("// Code generated by datahub-gen. DO NOT EDIT.\n")
+	g.printf("// source: %s\n\n", g.source)
+	g.printf("package %s\n\n", g.pkg)
+	g.printf("import (\n")
+	for _, imp := range imports {
+		g.printf("\t%q\n", imp)
+	}
+	g.printf("\n")
+	for _, imp := range thirdParty {
+		g.printf("\t%q\n", imp)
+	}
+	g.printf(")\n\n")
+
+	g.printf("func new%sSchema(fields []datahub.Field, props map[string]datahub.DecimalProp) *datahub.RecordSchema {\n", g.typeName)
+	g.printf("schema := datahub.NewRecordSchema()\n")
+	g.printf("for _, field := range fields {\n")
+	g.printf("if err := schema.AddDecimalField(field, props[field.Name]); err != nil {\npanic(err)\n}\n}\n")
+	g.printf("return schema\n}\n\n")
+
+	names := make([]string, 0, len(versions))
+	for _, version := range versions {
+		name := g.typeName
+		if len(versions) > 1 {
+			name = fmt.Sprintf("%sV%d", g.typeName, version.VersionId)
+		}
+		names = append(names, name)
+
+		if err := g.generateStruct(name, version); err != nil {
+			return err
+		}
+	}
+
+	g.generateDecoder(names)
+	return nil
+}
+
+func appendImport(imports []string, imp string) []string {
+	for _, existing := range imports {
+		if existing == imp {
+			return imports
+		}
+	}
+	return append(imports, imp)
+}
+
+func (g *generator) generateStruct(name string, version SchemaVersion) error {
+	fields := make([]structField, 0, version.Schema.Size())
+	goNames := make(map[string]bool)
+	for idx, field := range version.Schema.Fields {
+		ft, ok := fieldTypes[field.Type]
+		if !ok {
+			return fmt.Errorf("field [%s] type %s is not supported", field.Name, field.Type)
+		}
+
+		goName := toGoName(field.Name)
+		if goNames[goName] {
+			goName = fmt.Sprintf("%s%d", goName, idx)
+		}
+		goNames[goName] = true
+
+		fields = append(fields, structField{
+			name:      field.Name,
+			goName:    goName,
+			fieldType: ft,
+			allowNull: field.AllowNull,
+			typeName:  field.Type,
+		})
+	}
+
+	// schema
+	g.printf("// %sSchema is the schema of version %d\n", name, version.VersionId)
+	g.printf("var %sSchema = new%sSchema([]datahub.Field{\n", name, g.typeName)
+	props := make([]string, 0)
+	for _, field := range version.Schema.Fields {
+		g.printf("{Name: %q, Type: datahub.%s, AllowNull: %v, Comment: %q},\n",
+			field.Name, field.Type, field.AllowNull, field.Comment)
+		if prop := version.Schema.GetDecimalProp(field.Name); prop.Precision > 0 {
+			props = append(props, fmt.Sprintf("%q: {Precision: %d, Scale: %d},\n", field.Name, prop.Precision, prop.Scale))
+		}
+	}
+	if len(props) == 0 {
+		g.printf("}, nil)\n\n")
+	} else {
+		// the precision and scale are in the schema hash, Decode matches the records by it
+		g.printf("}, map[string]datahub.DecimalProp{\n%s})\n\n", strings.Join(props, ""))
+	}
+
+	// struct
+	g.printf("// %s is the record of schema version %d, the nullable fields are pointers.\n", name, version.VersionId)
+	for _, field := range fields {
+		if field.typeName == datahub.TIMESTAMP {
+			g.printf("// The zero time.Time of a TIMESTAMP field is rejected by ToTupleRecord as not set.\n")
+			break
+		}
+	}
+	g.printf("type %s struct {\n", name)
+	for _, field := range fields {
+		goType := field.fieldType.goType
+		if field.allowNull {
+			goType = "*" + goType
+		}
+		g.printf("%s %s `datahub:%q`\n", field.goName, goType, field.name)
+	}
+	g.printf("}\n\n")
+
+	g.generateToTupleRecord(name, fields)
+	g.generateFromTupleRecord(name, fields)
+	return nil
+}
+
+func (g *generator) generateToTupleRecord(name string, fields []structField) {
+	g.printf("// ToTupleRecord converts r to a record of %sSchema\n", name)
+	g.printf("func (r *%s) ToTupleRecord() (*datahub.TupleRecord, error) {\n", name)
+	g.printf("record := datahub.NewTupleRecord(%sSchema)\n", name)
+	for idx, field := range fields {
+		ft := field.fieldType
+		value := "r." + field.goName
+		if field.allowNull {
+			g.printf("if r.%s != nil {\n", field.goName)
+			g.printf("value := *r.%s\n", field.goName)
+			value = "value"
+		}
+		if len(ft.validate) > 0 {
+			g.printf(ft.validate+"\n", value, fmt.Sprintf("%s.%s", name, field.goName))
+		}
+		g.printf("record.Values[%d] = "+ft.fromGo+"\n", idx, value)
+		if field.allowNull {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return record, nil\n}\n\n")
+}
+
+func (g *generator) generateFromTupleRecord(name string, fields []structField) {
+	g.printf("// FromTupleRecord fills r with the values of the record of %sSchema\n", name)
+	g.printf("func (r *%s) FromTupleRecord(record *datahub.TupleRecord) error {\n", name)
+	g.printf("if len(record.Values) != %d {\n", len(fields))
+	g.printf("return fmt.Errorf(\"%s: values size %%d not match field size %d\", len(record.Values))\n}\n", name, len(fields))
+	for idx, field := range fields {
+		ft := field.fieldType
+		g.printf("switch v := record.Values[%d].(type) {\n", idx)
+		g.printf("case nil:\n")
+		if field.allowNull {
+			g.printf("r.%s = nil\n", field.goName)
+		} else {
+			g.printf("r.%s = %s\n", field.goName, ft.zero)
+		}
+		g.printf("case datahub.%s:\n", ft.dhType)
+		if field.allowNull {
+			g.printf("value := %s\n", ft.toGo)
+			g.printf("r.%s = &value\n", field.goName)
+		} else {
+			g.printf("r.%s = %s\n", field.goName, ft.toGo)
+		}
+		g.printf("default:\n")
+		g.printf("return fmt.Errorf(\"%s: field [%s] value type %%T not match %s\", v)\n}\n",
+			name, field.name, field.typeName)
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+func (g *generator) generateDecoder(names []string) {
+	g.printf("// Decode%s decodes the record by its schema, the result is one of *%s\n",
+		g.typeName, strings.Join(names, ", *"))
+	g.printf("func Decode%s(record *datahub.TupleRecord) (any, error) {\n", g.typeName)
+	g.printf("if record.RecordSchema == nil {\n")
+	g.printf("return nil, fmt.Errorf(\"%s: record schema is nil\")\n}\n\n", g.typeName)
+	g.printf("switch record.RecordSchema.HashCode() {\n")
+	for _, name := range names {
+		g.printf("case %sSchema.HashCode():\n", name)
+		g.printf("value := &%s{}\n", name)
+		g.printf("if err := value.FromTupleRecord(record); err != nil {\nreturn nil, err\n}\n")
+		g.printf("return value, nil\n")
+	}
+	g.printf("default:\n")
+	g.printf("return nil, fmt.Errorf(\"%s: unknown record schema %%s\", record.RecordSchema.String())\n}\n}\n", g.typeName)
+}
+
+// toGoName converts the field name like user_id to UserId
+func toGoName(name string) string {
+	var sb strings.Builder
+	upper := true
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			upper = true
+			continue
+		}
+		if upper {
+			c = unicode.ToUpper(c)
+			upper = false
+		}
+		sb.WriteRune(c)
+	}
+
+	goName := sb.String()
+	if len(goName) == 0 || unicode.IsDigit(rune(goName[0])) {
+		goName = "F" + goName
+	}
+	return goName
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/aliyun-datahub-sdk-go/datahub"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func genTestVersions(t *testing.T) []SchemaVersion {
+	v0 := datahub.NewRecordSchema()
+	assert.Nil(t, v0.AddField(datahub.Field{Name: "order_id", Type: datahub.BIGINT, Comment: "order id"}))
+	assert.Nil(t, v0.AddField(datahub.Field{Name: "user_name", Type: datahub.STRING, AllowNull: true}))
+	assert.Nil(t, v0.AddField(datahub.Field{Name: "create_time", Type: datahub.TIMESTAMP}))
+
+	v1 := datahub.NewRecordSchema()
+	for _, field := range v0.Fields {
+		assert.Nil(t, v1.AddField(field))
+	}
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "count", Type: datahub.INTEGER, AllowNull: true}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "level", Type: datahub.SMALLINT, AllowNull: true}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "flag", Type: datahub.TINYINT, AllowNull: true}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "score", Type: datahub.DOUBLE, AllowNull: true}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "ratio", Type: datahub.FLOAT, AllowNull: true}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "valid", Type: datahub.BOOLEAN, AllowNull: true}))
+	assert.Nil(t, v1.AddDecimalField(datahub.Field{Name: "amount", Type: datahub.DECIMAL, AllowNull: true}, datahub.DecimalProp{Precision: 10, Scale: 2}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "extra", Type: datahub.JSON, AllowNull: true}))
+	assert.Nil(t, v1.AddField(datahub.Field{Name: "pay_time", Type: datahub.TIMESTAMP, AllowNull: true}))
+
+	return []SchemaVersion{{VersionId: 0, Schema: v0}, {VersionId: 1, Schema: v1}}
+}
+
+func TestGenerateGolden(t *testing.T) {
+	src, err := Generate("events", "Order", "order.json", genTestVersions(t))
+	assert.Nil(t, err)
+
+	golden := filepath.Join("testdata", "order.golden")
+	if *update {
+		assert.Nil(t, os.WriteFile(golden, src, 0644))
+	}
+
+	expected, err := os.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(src))
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	_, err := Generate("events", "Order", "order.json", nil)
+	assert.NotNil(t, err)
+}
+
+func TestToGoName(t *testing.T) {
+	assert.Equal(t, "UserId", toGoName("user_id"))
+	assert.Equal(t, "F1st", toGoName("1st"))
+	assert.Equal(t, "ABC", toGoName("a.b-c"))
+}
+
+// the program run with the generated code, it exits with an error if a check fails
+const generatedMain = `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func check(ok bool, msg string) {
+	if !ok {
+		fmt.Println(msg)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	name := "test"
+	amount := decimal.RequireFromString("12.34")
+	extra := ` + "`" + `{"k":"v"}` + "`" + `
+	order := &OrderV1{OrderId: 1, UserName: &name, CreateTime: time.UnixMicro(1700000000000000), Amount: &amount, Extra: &extra}
+	record, err := order.ToTupleRecord()
+	check(err == nil, fmt.Sprintf("ToTupleRecord failed: %v", err))
+
+	value, err := DecodeOrder(record)
+	check(err == nil, fmt.Sprintf("DecodeOrder failed: %v", err))
+	result, ok := value.(*OrderV1)
+	check(ok, fmt.Sprintf("DecodeOrder returns %T", value))
+	check(result.OrderId == 1 && *result.UserName == name && result.Count == nil, "values not match")
+	check(result.CreateTime.Equal(order.CreateTime) && result.Amount.Equal(amount), "values not match")
+
+	_, err = (&OrderV0{OrderId: 1}).ToTupleRecord()
+	check(err != nil && err.Error() == "OrderV0.CreateTime: TIMESTAMP is not set", fmt.Sprintf("zero time error: %v", err))
+
+	fmt.Println(OrderV0Schema.HashCode(), OrderV1Schema.HashCode())
+}
+`
+
+func TestGenerateCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip running the generated code in short mode")
+	}
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	versions := genTestVersions(t)
+	src, err := Generate("main", "Order", "order.json", versions)
+	assert.Nil(t, err)
+
+	// the directory is in the module so that the generated code builds with its dependencies
+	dir, err := os.MkdirTemp(".", "generated")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "order.go"), src, 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(generatedMain), 0644))
+
+	out, err := exec.Command(goBin, "run", "./"+dir).CombinedOutput()
+	assert.Nil(t, err, string(out))
+
+	// the generated schemas have the hash of the source schemas, with the decimal precision
+	assert.Equal(t, fmt.Sprintf("%d %d\n", versions[0].Schema.HashCode(), versions[1].Schema.HashCode()), string(out))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aliyun/aliyun-datahub-sdk-go/datahub"
+)
+
+func Usage() {
+	fmt.Printf("Usage: %s [options]\n"+
+		"example:\n"+
+		"   # generate from the schemas of a topic\n"+
+		"   $ go run . -endpoint <your endpoint> -accessid <your accessid> -accesskey <your accesskey> -project <project> -topic <topic> -package events -out order.go\n"+
+		"   # generate from a schema json file\n"+
+		"   $ go run . -schema order.json -type Order -package events -out order.go\n"+
+		"option:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var endpoint, accessid, accesskey, project, topic, schemaFile, pkg, typeName, out string
+	flag.StringVar(&endpoint, "endpoint", "", "datahub server endpoint.")
+	flag.StringVar(&accessid, "accessid", "", "datahub account accessid.")
+	flag.StringVar(&accesskey, "accesskey", "", "datahub account accesskey.")
+	flag.StringVar(&project, "project", "", "project name.")
+	flag.StringVar(&topic, "topic", "", "topic name, all schema versions of the topic are generated.")
+	flag.StringVar(&schemaFile, "schema", "", "schema json file, used instead of the topic.")
+	flag.StringVar(&pkg, "package", "main", "package name of the generated code.")
+	flag.StringVar(&typeName, "type", "", "struct name, default is the topic or schema file name.")
+	flag.StringVar(&out, "out", "", "output file, default is stdout.")
+	flag.Parse()
+
+	var versions []SchemaVersion
+	var source string
+	var err error
+	switch {
+	case schemaFile != "":
+		source = filepath.Base(schemaFile)
+		versions, err = loadSchemaFile(schemaFile)
+		if typeName == "" {
+			typeName = toGoName(strings.TrimSuffix(source, filepath.Ext(source)))
+		}
+	case endpoint != "" && accessid != "" && accesskey != "" && project != "" && topic != "":
+		source = fmt.Sprintf("%s/%s", project, topic)
+		dh := datahub.New(accessid, accesskey, endpoint)
+		versions, err = loadTopicSchemas(dh, project, topic)
+		if typeName == "" {
+			typeName = toGoName(topic)
+		}
+	default:
+		Usage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load schema failed, error:%v\n", err)
+		os.Exit(1)
+	}
+
+	src, err := Generate(pkg, typeName, source, versions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate failed, error:%v\n", err)
+		os.Exit(1)
+	}
+
+	if out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+
+	if err = os.WriteFile(out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "write %s failed, error:%v\n", out, err)
+		os.Exit(1)
+	}
+}
+
+func loadSchemaFile(path string) ([]SchemaVersion, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := datahub.NewRecordSchemaFromJson(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return []SchemaVersion{{VersionId: 0, Schema: schema}}, nil
+}
+
+func loadTopicSchemas(dh datahub.DataHubApi, project, topic string) ([]SchemaVersion, error) {
+	gt, err := dh.GetTopic(project, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	if gt.RecordType != datahub.TUPLE {
+		return nil, fmt.Errorf("%s/%s is not a tuple topic", project, topic)
+	}
+
+	if !gt.EnableSchema {
+		return []SchemaVersion{{VersionId: 0, Schema: gt.RecordSchema}}, nil
+	}
+
+	ls, err := dh.ListTopicSchema(project, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]SchemaVersion, 0, len(ls.SchemaInfoList))
+	for idx := range ls.SchemaInfoList {
+		info := &ls.SchemaInfoList[idx]
+		versions = append(versions, SchemaVersion{VersionId: info.VersionId, Schema: &info.RecordSchema})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].VersionId < versions[j].VersionId
+	})
+	return versions, nil
+}